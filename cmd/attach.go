@@ -0,0 +1,303 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/danhale-git/craft/internal/console"
+	"github.com/danhale-git/craft/internal/logger"
+	"github.com/danhale-git/craft/mclog"
+	"github.com/moby/term"
+	"github.com/spf13/cobra"
+)
+
+const (
+	historyFileName = ".console_history" // Console history file in the backup directory, shared by all servers
+	historySize     = 1000               // Maximum number of lines kept in the console history
+)
+
+// bedrockCommands are the commands which can be run in the bedrock server cli, used for tab completion.
+var bedrockCommands = []string{ //nolint:gochecknoglobals
+	"allowlist", "alwaysday", "changesetting", "clear", "clearspawnpoint", "clone", "damage", "daylock", "deop",
+	"difficulty", "effect", "enchant", "event", "execute", "fill", "fog", "function", "gamemode", "gamerule", "give",
+	"help", "kick", "kill", "list", "locate", "loot", "me", "mobevent", "msg", "op", "particle", "permission",
+	"playanimation", "playsound", "reload", "replaceitem", "ride", "save", "say", "schedule", "scoreboard", "setblock",
+	"setmaxplayers", "setworldspawn", "spawnpoint", "spreadplayers", "stop", "stopsound", "structure", "summon", "tag",
+	"teleport", "tell", "tellraw", "testfor", "testforblock", "testforblocks", "tickingarea", "time", "title",
+	"titleraw", "toggledownfall", "tp", "transferserver", "w", "weather", "whitelist", "xp",
+}
+
+// targetSelectors may be completed wherever a player name can.
+var targetSelectors = []string{"@a", "@e", "@p", "@r", "@s"} //nolint:gochecknoglobals
+
+// NewAttachCmd returns the attach command which opens an interactive console for a server.
+func NewAttachCmd() *cobra.Command {
+	attachCmd := &cobra.Command{
+		Use:   "attach <server>",
+		Short: "Open an interactive console for a server",
+		Long: `Stream the server's output and run commands in its cli from a single terminal.
+Commands are edited with the arrow keys and common shortcuts (Ctrl-A, Ctrl-E, Ctrl-K, Ctrl-U, Ctrl-W). The up and
+down arrows recall previous commands, which are saved between sessions. Tab completes command names, online player
+names and target selectors. Press Ctrl-C or Ctrl-D to detach, the server keeps running.`,
+		Example: `craft attach myserver
+craft attach myserver --tail 100`,
+		Args: cobra.ExactArgs(1),
+		RunE: attachCommand,
+	}
+
+	attachCmd.Flags().Int("tail", 20,
+		"Number of lines of previous output to show when attaching.")
+
+	return attachCmd
+}
+
+func attachCommand(cmd *cobra.Command, args []string) error {
+	tail, err := cmd.Flags().GetInt("tail")
+	if err != nil {
+		logger.Panic(err)
+	}
+
+	fd, isTerminal := term.GetFdInfo(os.Stdin)
+	if !isTerminal {
+		return errors.New("attach requires an interactive terminal, use 'craft cmd' to run commands from a script")
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	m, err := newManager(cmd)
+	if err != nil {
+		return err
+	}
+
+	s, err := m.GetServer(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	logs, err := s.LogReader(ctx, tail)
+	if err != nil {
+		return err
+	}
+
+	conn, err := s.CommandWriter(ctx)
+	if err != nil {
+		return fmt.Errorf("attaching to server cli: %w", err)
+	}
+	defer conn.Close()
+
+	history, err := console.LoadHistory(filepath.Join(m.BackupDir, historyFileName), historySize)
+	if err != nil {
+		return fmt.Errorf("loading console history: %w", err)
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("setting terminal to raw mode: %w", err)
+	}
+	defer term.RestoreTerminal(fd, state) //nolint:errcheck
+
+	e := console.New(os.Stdin, os.Stdout, s.ContainerName+"> ")
+	e.History = history
+	defer e.Clear()
+
+	a := newAttachment(conn, e.Println)
+	e.Complete = a.complete
+
+	return a.run(ctx, logs, e.ReadLine)
+}
+
+// attachment is an interactive session in a server's cli. It tracks which players are online for tab completion.
+type attachment struct {
+	cli   io.Writer
+	print func(string)
+
+	mu      sync.Mutex
+	players map[string]bool
+	echoes  []string // Commands which have been sent and not yet echoed by the server cli
+	listing bool     // The next line is the list of players online
+}
+
+func newAttachment(cli io.Writer, print func(string)) *attachment {
+	return &attachment{
+		cli:     cli,
+		print:   print,
+		players: make(map[string]bool),
+	}
+}
+
+// run prints the server output and sends the lines returned by readLine to the server cli until the user detaches or
+// the server stops. The players who are online are listed when attaching.
+func (a *attachment) run(ctx context.Context, logs *bufio.Reader, readLine func() (string, error)) error {
+	streamErr := make(chan error, 1)
+
+	go func() {
+		streamErr <- a.stream(logs)
+	}()
+
+	if err := a.send("list"); err != nil {
+		return err
+	}
+
+	type input struct {
+		line string
+		err  error
+	}
+
+	lines := make(chan input)
+
+	// readLine can't be cancelled, the goroutine returns when the next line is read
+	go func() {
+		for {
+			l, err := readLine()
+
+			select {
+			case lines <- input{l, err}:
+			case <-ctx.Done():
+				return
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case in := <-lines:
+			if errors.Is(in.err, console.ErrInterrupt) || errors.Is(in.err, io.EOF) {
+				return nil
+			}
+
+			if in.err != nil {
+				return in.err
+			}
+
+			if strings.TrimSpace(in.line) == "" {
+				continue
+			}
+
+			if err := a.send(in.line); err != nil {
+				return err
+			}
+		case err := <-streamErr:
+			a.print("server output ended, the server has stopped")
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// send writes the command to the server cli.
+func (a *attachment) send(command string) error {
+	command = strings.TrimSpace(command)
+
+	a.mu.Lock()
+	a.echoes = append(a.echoes, command)
+	a.mu.Unlock()
+
+	if _, err := a.cli.Write([]byte(command + "\n")); err != nil {
+		return fmt.Errorf("writing command '%s': %w", command, err)
+	}
+
+	return nil
+}
+
+// stream prints each line of the server output until the end of the logs.
+func (a *attachment) stream(logs *bufio.Reader) error {
+	scanner := bufio.NewScanner(logs)
+
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); a.handle(line) {
+			a.print(line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	return nil
+}
+
+// handle updates the players who are online from a line of server output and returns false if it is the server cli's
+// echo of a command sent by the user, which should not be printed as it is already shown in the console.
+func (a *attachment) handle(line string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.echoes) > 0 && strings.TrimSpace(line) == a.echoes[0] {
+		a.echoes = a.echoes[1:]
+		return false
+	}
+
+	if a.listing {
+		a.listing = false
+		a.players = make(map[string]bool)
+
+		for _, p := range strings.Split(line, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				a.players[p] = true
+			}
+		}
+
+		return true
+	}
+
+	switch e := mclog.Parse(line); e.Kind { //nolint:exhaustive
+	case mclog.KindPlayerList:
+		a.listing = true
+	case mclog.KindPlayerConnected:
+		a.players[e.Player] = true
+	case mclog.KindPlayerDisconnected:
+		delete(a.players, e.Player)
+	}
+
+	return true
+}
+
+// complete returns the completions of the last word of line. The first word is completed with bedrock command names
+// and other words are completed with the names of online players and target selectors.
+func (a *attachment) complete(line string) []string {
+	word := line[strings.LastIndex(line, " ")+1:]
+
+	var candidates []string
+
+	if strings.TrimSpace(line) == word {
+		candidates = bedrockCommands
+	} else {
+		a.mu.Lock()
+		for p := range a.players {
+			// Names with spaces must be quoted in commands
+			if strings.Contains(p, " ") {
+				p = fmt.Sprintf("%q", p)
+			}
+
+			candidates = append(candidates, p)
+		}
+		a.mu.Unlock()
+
+		sort.Strings(candidates)
+		candidates = append(candidates, targetSelectors...)
+	}
+
+	matches := make([]string, 0)
+
+	for _, c := range candidates {
+		if strings.HasPrefix(strings.ToLower(c), strings.ToLower(word)) {
+			matches = append(matches, c)
+		}
+	}
+
+	return matches
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danhale-git/craft/internal/console"
+	"github.com/danhale-git/craft/internal/mock"
+	"github.com/danhale-git/craft/server"
+)
+
+func TestAttachment_Run(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	d := mock.NewDocker(server.ImageName)
+
+	s, err := server.New(ctx, d, "srv", server.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.RunBedrock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := d.Container("srv")
+	b.Connect("Steve", "123")
+
+	logs, err := s.LogReader(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := s.CommandWriter(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var mu sync.Mutex
+
+	printed := make([]string, 0)
+	output := make(chan string, 100)
+
+	a := newAttachment(conn, func(s string) {
+		mu.Lock()
+		printed = append(printed, s)
+		mu.Unlock()
+
+		output <- s
+	})
+
+	// waitFor waits until the line has been printed
+	waitFor := func(line string) {
+		for {
+			select {
+			case l := <-output:
+				if l == line {
+					return
+				}
+			case <-ctx.Done():
+				t.Fatalf("'%s' was not printed", line)
+			}
+		}
+	}
+
+	lines := []string{"time set 0600", ""}
+
+	err = a.run(ctx, logs, func() (string, error) {
+		if len(lines) == 0 {
+			waitFor("Set the time to 0600")
+			return "", console.ErrInterrupt
+		}
+
+		l := lines[0]
+		lines = lines[1:]
+
+		return l, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error detaching: %s", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	want := []string{"There are 1/10 players online:", "Steve", "Set the time to 0600"}
+	if !reflect.DeepEqual(printed, want) {
+		t.Errorf("unexpected output:\nwant %q\ngot  %q", want, printed)
+	}
+
+	a.handle("[INFO] Player connected: Alex Two, xuid: 456")
+
+	want = []string{`"Alex Two"`, "Steve", "@a", "@e", "@p", "@r", "@s"}
+	if got := a.complete("tp "); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected player completions: want %v: got %v", want, got)
+	}
+
+	a.handle("[INFO] Player disconnected: Steve, xuid: 123")
+
+	if got := a.complete("tp st"); len(got) != 0 {
+		t.Errorf("disconnected player was completed: %v", got)
+	}
+}
+
+func TestAttachment_complete(t *testing.T) {
+	a := newAttachment(nil, nil)
+	a.players["Steve"] = true
+
+	cases := map[string][]string{
+		"gamem":      {"gamemode"},
+		"  TIT":      {"title", "titleraw"},
+		"tp s":       {"Steve"},
+		"tp Steve @": {"@a", "@e", "@p", "@r", "@s"},
+		"xyz":        {},
+	}
+
+	for line, want := range cases {
+		if got := a.complete(line); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: want %v: got %v", line, want, got)
+		}
+	}
+
+	if got := a.complete(""); len(got) != len(bedrockCommands) || !strings.HasPrefix(got[0], "a") {
+		t.Errorf("all commands were not returned for an empty line: %v", got)
+	}
+}
@@ -1,12 +1,15 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"os"
 	"strings"
 
+	"github.com/danhale-git/craft/craft"
 	"github.com/danhale-git/craft/internal/files"
 
-	"github.com/danhale-git/craft/craft"
 	"github.com/danhale-git/craft/internal/logger"
 	"github.com/spf13/cobra"
 )
@@ -24,6 +27,7 @@ The backed up world is usually a few seconds behind the world state at the time
 Use the trim and skip-trim-file-removal-check flags with linux cron or windows task scheduler to automate backups.`,
 		Example: `craft backup myserver
 craft backup myserver -l
+craft backup myserver myotherserver -l -o json
 
 Linux cron (hourly):
 0 * * * * ~/craft_backups/backup.sh
@@ -31,10 +35,11 @@ Linux cron (hourly):
 	#!/usr/bin/env bash
 	~/go/bin/craft backup myserver myotherserver \ # path to craft executable and one or more servers
 	--skip-trim-file-removal-check --trim 3 \ # skip cmdline prompts and delete all except 3 newest files
-	--log ~/craft_backups/backup.log --log-level info # log to file with log level info
+	--log ~/craft_backups/backup.log --log-level info \ # log to file with log level info
+	--timeout 10m # give up if the backup hasn't finished after 10 minutes
 `,
 		Args: cobra.MinimumNArgs(1),
-		Run:  backupCommand,
+		RunE: backupCommand,
 	}
 
 	backupCmd.Flags().IntP("trim", "t", 0,
@@ -46,10 +51,16 @@ Linux cron (hourly):
 	backupCmd.Flags().Bool("skip-trim-file-removal-check", false,
 		"Don't prompt the user before removing files. Useful for automating backups.")
 
+	addOutputFlag(backupCmd)
+	addSaveFlags(backupCmd)
+
 	return backupCmd
 }
 
-func backupCommand(cmd *cobra.Command, args []string) {
+func backupCommand(cmd *cobra.Command, args []string) error {
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
 	trim, err := cmd.Flags().GetInt("trim")
 	if err != nil {
 		logger.Panic(err)
@@ -60,25 +71,49 @@ func backupCommand(cmd *cobra.Command, args []string) {
 		logger.Panic(err)
 	}
 
+	list, err := cmd.Flags().GetBool("list")
+	if err != nil {
+		logger.Panic(err)
+	}
+
+	m, err := newManager(cmd)
+	if err != nil {
+		return err
+	}
+
+	if list {
+		return listBackups(cmd, m, args)
+	}
+
 	created := make([]string, 0)
 	deleted := make([]string, 0)
+	failed := &serverErrors{total: len(args)}
+
+	var confirm func([]string) bool
+	if !skip {
+		confirm = confirmRemoval
+	}
 
 	for _, name := range args {
-		c := craft.GetServerOrExit(name)
+		c, err := m.GetServer(ctx, name)
+		if err != nil {
+			failed.add(name, err)
+			continue
+		}
 
 		// Take a new backup
-		name, err := craft.CopyBackup(c)
+		fileName, err := m.CopyBackup(ctx, c)
 		if err != nil {
-			logger.Error.Printf("%s: taking backup: %s", c.ContainerName, err)
+			failed.add(name, err)
 			continue
 		}
 
-		created = append(created, name)
+		created = append(created, fileName)
 
 		if trim > 0 {
-			del, err := craft.TrimBackups(c.ContainerName, trim, skip)
+			del, err := m.TrimBackups(c.ContainerName, trim, confirm)
 			if err != nil {
-				logger.Error.Printf("%s: trimming old backup files: %s", c.ContainerName, err)
+				failed.add(name, fmt.Errorf("trimming old backup files: %w", err))
 				continue
 			}
 
@@ -93,4 +128,50 @@ func backupCommand(cmd *cobra.Command, args []string) {
 	if len(deleted) > 0 {
 		logger.Info.Println("deleted:", strings.Join(deleted, " "))
 	}
+
+	return failed.err()
+}
+
+// listBackups writes the backup files for each of the named servers to stdout, in the format given by the output flag.
+func listBackups(cmd *cobra.Command, m *craft.Manager, names []string) error {
+	backups := make([]craft.BackupInfo, 0)
+
+	for _, name := range names {
+		b, err := m.Backups(name)
+		if err != nil {
+			return fmt.Errorf("%s: listing backups: %w", name, err)
+		}
+
+		backups = append(backups, b...)
+	}
+
+	return writeOutput(cmd, os.Stdout, backups, func(w io.Writer) error {
+		for _, b := range backups {
+			if _, err := fmt.Fprintln(w, b.File); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// confirmRemoval prints the names of the files and prompts the user to confirm that they should be removed.
+func confirmRemoval(files []string) bool {
+	fmt.Println()
+
+	for _, f := range files {
+		fmt.Println(f)
+	}
+
+	fmt.Print("Remove these files? (y/n): ")
+
+	text, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+
+	if strings.TrimSpace(text) != "y" {
+		fmt.Println("cancelled")
+		return false
+	}
+
+	return true
 }
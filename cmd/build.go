@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"regexp"
 
+	"github.com/danhale-git/craft/craft"
 	"github.com/danhale-git/craft/server"
 
 	"github.com/danhale-git/craft/internal/logger"
@@ -28,7 +29,7 @@ func NewBuildCommand() *cobra.Command {
 		Use:   "build",
 		Short: "Build the server image from a bedrock server download url",
 		Args:  cobra.NoArgs,
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			urlString, err := cmd.Flags().GetString("url")
 			if err != nil {
 				logger.Error.Panic(err)
@@ -40,17 +41,27 @@ func NewBuildCommand() *cobra.Command {
 			}
 
 			if urlString == "" {
-				logger.Error.Fatalf("Error: value of 'url' flag is an empty string. %s", webHelp)
+				return fmt.Errorf("value of 'url' flag is an empty string. %s", webHelp)
 			}
 
 			u, err := url.Parse(urlString)
 			if err != nil {
-				logger.Error.Fatalf("error parsing url: %s", err)
+				return fmt.Errorf("parsing url: %w", err)
 			}
 
-			if err := server.BuildDockerImage(u.String(), noCache); err != nil {
-				logger.Error.Fatalf("Error building image: %s", err)
+			ctx, cancel := commandContext(cmd)
+			defer cancel()
+
+			c, err := craft.DockerClient()
+			if err != nil {
+				return err
 			}
+
+			if err := server.BuildDockerImage(ctx, c, u.String(), noCache); err != nil {
+				return fmt.Errorf("building image: %w", err)
+			}
+
+			return nil
 		},
 	}
 
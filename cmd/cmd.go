@@ -1,15 +1,20 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/danhale-git/craft/server"
 
 	"github.com/danhale-git/craft/craft"
 
+	"github.com/danhale-git/craft/internal/backup"
 	"github.com/danhale-git/craft/internal/logger"
+	"github.com/docker/docker/client"
 	"github.com/spf13/cobra"
 )
 
@@ -29,14 +34,21 @@ func commands() []func() *cobra.Command {
 		NewRootCmd,
 		NewRunCmd,
 		NewCommandCmd,
+		NewAttachCmd,
+		NewExecCmd,
 		NewBackupCmd,
 		NewStartCmd,
 		NewStopCmd,
+		NewRestartCmd,
 		NewLogsCmd,
 		NewListCmd,
 		NewConfigureCmd,
 		NewExportCommand,
 		NewBuildCommand,
+		NewDoctorCmd,
+		NewDaemonCmd,
+		NewServeCmd,
+		NewMetricsCmd,
 		NewVersionCmd,
 	}
 }
@@ -45,7 +57,9 @@ func commands() []func() *cobra.Command {
 func NewRootCmd() *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use: "craft",
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Errors are written by Execute
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			logPath, err := cmd.Flags().GetString("log")
 			if err != nil {
 				panic(fmt.Sprintln(cmd.Name(), err))
@@ -58,14 +72,31 @@ func NewRootCmd() *cobra.Command {
 
 			logger.Init(logPath, logLevel, fmt.Sprintf("[%s]", cmd.Name()))
 
-			ok, err := server.DockerImageExists(craft.DockerClient())
+			// Arguments and flags are valid, don't print usage for errors returned after this point
+			cmd.SilenceUsage = true
+
+			c, err := craft.DockerClient()
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := commandContext(cmd)
+			defer cancel()
+
+			ok, err := server.DockerImageExists(ctx, c)
 			if err != nil {
-				log.Fatalf("Error checking docker images: %s", err)
+				if client.IsErrConnectionFailed(err) {
+					return fmt.Errorf("%w: %s", craft.ErrDockerUnreachable, err)
+				}
+
+				return fmt.Errorf("checking docker images: %w", err)
 			}
+
 			if !ok && cmd.Name() != "build" {
-				fmt.Println("server image doesn't exist, run 'craft build' to build it")
-				os.Exit(0)
+				return errors.New("server image doesn't exist, run 'craft build' to build it")
 			}
+
+			return nil
 		},
 	}
 
@@ -75,9 +106,99 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.PersistentFlags().String("log-level", "info",
 		"Minimum severity of logs to output. [info|warn|error].")
 
+	rootCmd.PersistentFlags().String("port-range", server.DefaultPortRange.String(),
+		"Range of ports which may be assigned to servers automatically e.g. 19132-19231.")
+
+	rootCmd.PersistentFlags().Duration("timeout", 0,
+		"Maximum time the command may run for before it is cancelled e.g. 10m. The default (0) is no timeout.")
+
 	return rootCmd
 }
 
+// commandContext returns a context derived from the command's context which is cancelled when the duration given by
+// the timeout flag has elapsed or craft receives an interrupt or termination signal. A zero timeout never expires. The
+// returned cancel function must be called.
+func commandContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	timeout, err := cmd.Flags().GetDuration("timeout")
+	if err != nil {
+		logger.Panic(err)
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// Cancel instead of exiting so commands can clean up e.g. resume saving after an interrupted backup
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+
+	if timeout <= 0 {
+		return ctx, stop
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// Execute runs the command given by the command line arguments and returns the exit code. Errors are written to
+// stderr, as JSON if the output flag is json, and to the log file if one was given.
+func Execute() int {
+	c, err := InitCobra().ExecuteC()
+	if err == nil {
+		return ExitOK
+	}
+
+	if logPath, _ := c.Flags().GetString("log"); logPath != "" {
+		logger.Error.Println(err)
+	}
+
+	writeError(c, os.Stderr, err)
+
+	return exitCode(err)
+}
+
+// newManager returns a craft.Manager with the default docker client and backup directory, configured by the command's
+// flags.
+func newManager(cmd *cobra.Command) (*craft.Manager, error) {
+	portRange, err := cmd.Flags().GetString("port-range")
+	if err != nil {
+		logger.Panic(err)
+	}
+
+	m, err := craft.NewManager()
+	if err != nil {
+		return nil, fmt.Errorf("creating craft manager: %w", err)
+	}
+
+	if m.Ports, err = server.ParsePortRange(portRange); err != nil {
+		return nil, err
+	}
+
+	if cmd.Flags().Lookup("save-retries") != nil {
+		if m.SaveRetries, err = cmd.Flags().GetInt("save-retries"); err != nil {
+			logger.Panic(err)
+		}
+
+		if m.SaveDelay, err = cmd.Flags().GetDuration("save-delay"); err != nil {
+			logger.Panic(err)
+		}
+	}
+
+	return m, nil
+}
+
+// addSaveFlags adds flags which configure how long to wait for world files to be ready when taking a backup.
+func addSaveFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("save-retries", backup.DefaultSaveRetries,
+		"The number of times to check whether world files are ready to be backed up before giving up.")
+	cmd.Flags().Duration("save-delay", backup.DefaultSaveDelay,
+		"The delay between each check that world files are ready to be backed up.")
+}
+
 // NewVersionCmd returns the version command which prints the current craft version
 func NewVersionCmd() *cobra.Command {
 	return &cobra.Command{
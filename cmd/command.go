@@ -1,47 +1,76 @@
 package cmd
 
 import (
+	"fmt"
+	"io"
+	"os"
 	"strings"
 
-	"github.com/danhale-git/craft/craft"
-	"github.com/danhale-git/craft/internal/logger"
+	"github.com/danhale-git/craft/server"
 	"github.com/spf13/cobra"
 )
 
 // NewCommandCmd returns the 'command' command which executes a mc server command on the given server.
 func NewCommandCmd() *cobra.Command {
-	return &cobra.Command{
+	commandCmd := &cobra.Command{
 		Use:     "command <server> <mc command>",
 		Aliases: []string{"cmd"},
 		Short:   "Run a command in the bedrock server cli",
-		Long:    `The first argument is the serer name. The following arguments will be executed in the server CLI.`,
+		Long: `The first argument is the serer name. The following arguments will be executed in the server CLI.
+The output of the command is printed. The command is complete when the server logs no more output for the quiet
+period. If the server reports an error, such as a syntax error, craft exits with exit code 7.`,
 		Example: "craft command myserver give PlayerName stone 1",
 		Args: func(cmd *cobra.Command, args []string) error {
 			return cobra.MinimumNArgs(2)(cmd, args)
 		},
-		Run: func(cmd *cobra.Command, args []string) {
-			c := craft.GetServerOrExit(args[0])
+		RunE: func(cmd *cobra.Command, args []string) error {
+			quietPeriod, err := cmd.Flags().GetDuration("quiet-period")
+			if err != nil {
+				panic(err)
+			}
 
-			logs, err := c.LogReader(0)
+			ctx, cancel := commandContext(cmd)
+			defer cancel()
+
+			m, err := newManager(cmd)
 			if err != nil {
-				logger.Error.Fatalf("retrieving log reader: %s", err)
+				return err
 			}
 
-			if err = c.Command(args[1:]); err != nil {
-				logger.Error.Fatalf("running command '%s': %s", strings.Join(args[1:], " "), err)
+			c, err := m.GetServer(ctx, args[0])
+			if err != nil {
+				return err
 			}
 
-			// Wait for command to return before exiting
-			for i := 0; i < 2; i++ {
-				response, err := logs.ReadString('\n')
-				if err != nil {
-					logger.Error.Fatalf("reading response %d from logs: %s", i, err)
-				}
+			console, err := c.Console(ctx)
+			if err != nil {
+				return err
+			}
+			defer console.Close()
 
-				if strings.HasPrefix(response, "Syntax error:") {
-					logger.Error.Printf("error reported from server cli: %s", response)
+			console.QuietPeriod = quietPeriod
+
+			resp, err := console.Exec(ctx, strings.Join(args[1:], " "))
+
+			if writeErr := writeOutput(cmd, os.Stdout, resp, func(w io.Writer) error {
+				for _, l := range resp.Lines {
+					if _, err := fmt.Fprintln(w, l); err != nil {
+						return err
+					}
 				}
+
+				return nil
+			}); writeErr != nil {
+				return writeErr
 			}
+
+			return err
 		},
 	}
+
+	commandCmd.Flags().Duration("quiet-period", server.DefaultQuietPeriod,
+		"The command is complete when no output is logged for this long.")
+	addOutputFlag(commandCmd)
+
+	return commandCmd
 }
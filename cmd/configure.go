@@ -1,7 +1,8 @@
 package cmd
 
 import (
-	"github.com/danhale-git/craft/craft"
+	"fmt"
+
 	"github.com/danhale-git/craft/internal/logger"
 	"github.com/spf13/cobra"
 )
@@ -14,17 +15,30 @@ func NewConfigureCmd() *cobra.Command {
 		Args: func(cmd *cobra.Command, args []string) error {
 			return cobra.RangeArgs(1, 1)(cmd, args)
 		},
-		Run: func(cmd *cobra.Command, args []string) {
-			c := craft.GetServerOrExit(args[0])
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := commandContext(cmd)
+			defer cancel()
 
 			props, err := cmd.Flags().GetStringSlice("prop")
 			if err != nil {
 				logger.Panic(err)
 			}
 
-			if err := craft.SetServerProperties(props, c); err != nil {
-				logger.Error.Fatalf("setting server properties: %s", err)
+			m, err := newManager(cmd)
+			if err != nil {
+				return err
+			}
+
+			c, err := m.GetServer(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			if err := m.SetServerProperties(ctx, props, c); err != nil {
+				return fmt.Errorf("setting server properties: %w", err)
 			}
+
+			return nil
 		},
 	}
 
@@ -0,0 +1,330 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/danhale-git/craft/craft"
+	"github.com/danhale-git/craft/internal/jobs"
+	"github.com/danhale-git/craft/internal/logger"
+	"github.com/danhale-git/craft/internal/schedule"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	daemonConfigFileName  = "daemon.yaml"          // Default daemon config file in the backup directory
+	daemonHistoryFileName = "daemon_history.jsonl" // Job history file in the backup directory
+)
+
+// Daemon job actions.
+const (
+	actionBackup  = "backup"
+	actionRestart = "restart"
+	actionCommand = "command"
+	actionSay     = "say"
+)
+
+// NewDaemonCmd returns the daemon command which runs scheduled jobs until it is stopped.
+func NewDaemonCmd() *cobra.Command {
+	daemonCmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Run scheduled backups, restarts and commands",
+		Long: `Run the jobs in the daemon config file on their schedules until craft is stopped.
+Each job runs an action on a server when its cron schedule is due. Schedules have five fields: minute, hour, day of
+month, month and day of week, or one of @hourly, @daily, @weekly, @monthly and @yearly.
+Jobs for the same server never run at the same time. If a job is due while another job for its server is still
+running, it is skipped. The result of each run is saved to the job history, run 'craft daemon --history' to view it.
+
+Actions:
+  backup   Take a backup. 'trim' deletes the oldest backups, leaving the given count of newest backups.
+  restart  Restart the server. 'warn' shows players a countdown first. 'backup' also backs up servers with a volume.
+  command  Run 'command' in the server cli.
+  say      Broadcast 'message' to players.`,
+		Example: `craft daemon
+craft daemon --config ~/daemon.yaml --log ~/craft_backups/daemon.log
+craft daemon --history -o json
+
+~/craft_backups/daemon.yaml:
+	jobs:
+	  - name: hourly-backup
+	    server: myserver
+	    schedule: "0 * * * *"
+	    action: backup
+	    trim: 24
+	  - server: myserver
+	    schedule: "0 4 * * *"
+	    action: restart
+	    warn: 5m
+	  - server: myserver
+	    schedule: "*/30 * * * *"
+	    action: say
+	    message: Remember to vote!`,
+		Args: cobra.NoArgs,
+		RunE: daemonCommand,
+	}
+
+	daemonCmd.Flags().String("config", "",
+		fmt.Sprintf("Path to the daemon config file. The default is %s in the backup directory.", daemonConfigFileName))
+	daemonCmd.Flags().Bool("history", false,
+		"List the results of previous job runs and take no other action.")
+	addOutputFlag(daemonCmd)
+	addSaveFlags(daemonCmd)
+
+	return daemonCmd
+}
+
+// daemonConfig is the schema of the daemon config file.
+type daemonConfig struct {
+	Jobs []jobConfig `yaml:"jobs"`
+}
+
+// jobConfig configures a scheduled job. Fields other than name, server, schedule and action only apply to some actions.
+type jobConfig struct {
+	Name     string `yaml:"name"` // Defaults to <server>-<action>
+	Server   string `yaml:"server"`
+	Schedule string `yaml:"schedule"`
+	Action   string `yaml:"action"`
+
+	Trim    int           `yaml:"trim"`    // backup
+	Warn    time.Duration `yaml:"warn"`    // restart
+	Backup  bool          `yaml:"backup"`  // restart
+	Command string        `yaml:"command"` // command
+	Message string        `yaml:"message"` // say
+}
+
+func daemonCommand(cmd *cobra.Command, args []string) error {
+	configPath, err := cmd.Flags().GetString("config")
+	if err != nil {
+		logger.Panic(err)
+	}
+
+	history, err := cmd.Flags().GetBool("history")
+	if err != nil {
+		logger.Panic(err)
+	}
+
+	m, err := newManager(cmd)
+	if err != nil {
+		return err
+	}
+
+	historyPath := filepath.Join(m.BackupDir, daemonHistoryFileName)
+
+	if history {
+		return listJobHistory(cmd, historyPath)
+	}
+
+	if configPath == "" {
+		configPath = filepath.Join(m.BackupDir, daemonConfigFileName)
+	}
+
+	cfg, err := loadDaemonConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	scheduled := make([]jobs.Job, len(cfg.Jobs))
+
+	for i, j := range cfg.Jobs {
+		if scheduled[i], err = j.job(m); err != nil {
+			return err
+		}
+
+		next := scheduled[i].Schedule.Next(time.Now())
+		if next.IsZero() {
+			return fmt.Errorf("job '%s': schedule '%s' is never due", j.Name, j.Schedule)
+		}
+
+		logger.Info.Printf("%s: next run at %s", j.Name, next.Format(time.RFC3339))
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	r := &jobs.Runner{
+		HistoryFile: historyPath,
+		Log:         logger.Info,
+		ErrorLog:    logger.Error,
+	}
+
+	logger.Info.Printf("running %d jobs from %s", len(scheduled), configPath)
+
+	r.Schedule(ctx, scheduled)
+
+	logger.Info.Println("daemon stopped")
+
+	return nil
+}
+
+// loadDaemonConfig reads and validates the daemon config file. Job names default to <server>-<action>.
+func loadDaemonConfig(path string) (daemonConfig, error) {
+	var cfg daemonConfig
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("reading daemon config: %w", err)
+	}
+
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parsing daemon config '%s': %w", path, err)
+	}
+
+	if len(cfg.Jobs) == 0 {
+		return cfg, fmt.Errorf("no jobs in daemon config '%s'", path)
+	}
+
+	names := make(map[string]bool)
+
+	for i := range cfg.Jobs {
+		j := &cfg.Jobs[i]
+
+		if j.Name == "" {
+			j.Name = fmt.Sprintf("%s-%s", j.Server, j.Action)
+		}
+
+		if names[j.Name] {
+			return cfg, fmt.Errorf("job %d: duplicate job name '%s', give each job a unique name", i+1, j.Name)
+		}
+
+		names[j.Name] = true
+
+		if err := j.validate(); err != nil {
+			return cfg, fmt.Errorf("job '%s': %w", j.Name, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+func (j jobConfig) validate() error {
+	if j.Server == "" {
+		return errors.New("server is required")
+	}
+
+	if _, err := schedule.Parse(j.Schedule); err != nil {
+		return err
+	}
+
+	switch j.Action {
+	case actionBackup:
+		if j.Trim < 0 {
+			return errors.New("trim must not be negative")
+		}
+	case actionRestart:
+		if j.Warn < 0 {
+			return errors.New("warn must not be negative")
+		}
+	case actionCommand:
+		if strings.TrimSpace(j.Command) == "" {
+			return errors.New("command is required")
+		}
+	case actionSay:
+		if strings.TrimSpace(j.Message) == "" {
+			return errors.New("message is required")
+		}
+	default:
+		return fmt.Errorf("invalid action '%s', must be one of %s, %s, %s or %s",
+			j.Action, actionBackup, actionRestart, actionCommand, actionSay)
+	}
+
+	return nil
+}
+
+// job returns a scheduled job which runs the configured action. Jobs for the same server share a lock.
+func (j jobConfig) job(m *craft.Manager) (jobs.Job, error) {
+	s, err := schedule.Parse(j.Schedule)
+	if err != nil {
+		return jobs.Job{}, fmt.Errorf("job '%s': %w", j.Name, err)
+	}
+
+	return jobs.Job{
+		Name:     j.Name,
+		Lock:     j.Server,
+		Schedule: s,
+		Run: func(ctx context.Context) error {
+			return j.run(ctx, m)
+		},
+	}, nil
+}
+
+// run runs the job's action once.
+func (j jobConfig) run(ctx context.Context, m *craft.Manager) error {
+	s, err := m.GetServer(ctx, j.Server)
+	if err != nil {
+		return err
+	}
+
+	switch j.Action {
+	case actionBackup:
+		fileName, err := m.CopyBackup(ctx, s)
+		if err != nil {
+			return err
+		}
+
+		logger.Info.Printf("%s: created: %s", j.Name, fileName)
+
+		if j.Trim > 0 {
+			deleted, err := m.TrimBackups(j.Server, j.Trim, nil)
+			if err != nil {
+				return fmt.Errorf("trimming old backup files: %w", err)
+			}
+
+			if len(deleted) > 0 {
+				logger.Info.Printf("%s: deleted: %s", j.Name, strings.Join(deleted, " "))
+			}
+		}
+	case actionRestart:
+		if j.Warn > 0 {
+			if err := s.WarnStop(ctx, j.Warn); err != nil {
+				return fmt.Errorf("warning players: %w", err)
+			}
+		}
+
+		if _, err := m.RestartServer(ctx, s, j.Backup); err != nil {
+			return err
+		}
+	case actionCommand:
+		resp, err := s.Exec(ctx, j.Command)
+
+		for _, l := range resp.Lines {
+			logger.Info.Printf("%s: %s", j.Name, l)
+		}
+
+		return err
+	case actionSay:
+		return s.Say(ctx, j.Message)
+	}
+
+	return nil
+}
+
+// listJobHistory writes the job history to stdout, in the format given by the output flag.
+func listJobHistory(cmd *cobra.Command, path string) error {
+	records, err := jobs.ReadHistory(path)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(cmd, os.Stdout, records, func(w io.Writer) error {
+		for _, r := range records {
+			line := fmt.Sprintf("%s  %s  %s", r.Start, r.Job, r.Status)
+			if r.Error != "" {
+				line += ": " + r.Error
+			}
+
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danhale-git/craft/craft"
+	"github.com/danhale-git/craft/internal/mock"
+	"github.com/danhale-git/craft/server"
+)
+
+func TestLoadDaemonConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daemon.yaml")
+
+	config := `jobs:
+  - name: hourly-backup
+    server: srv
+    schedule: "0 * * * *"
+    action: backup
+    trim: 3
+  - server: srv
+    schedule: "@daily"
+    action: restart
+    warn: 5m
+`
+
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := loadDaemonConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(cfg.Jobs) != 2 {
+		t.Fatalf("unexpected jobs: %+v", cfg.Jobs)
+	}
+
+	if j := cfg.Jobs[0]; j.Name != "hourly-backup" || j.Trim != 3 {
+		t.Errorf("unexpected backup job: %+v", j)
+	}
+
+	if j := cfg.Jobs[1]; j.Name != "srv-restart" || j.Warn != 5*time.Minute {
+		t.Errorf("unexpected restart job: %+v", j)
+	}
+
+	invalid := map[string]string{
+		"no jobs":          "jobs: []",
+		"unknown field":    "jobs:\n  - {server: srv, schedule: '@daily', action: backup, keep: 3}",
+		"no server":        "jobs:\n  - {schedule: '@daily', action: backup}",
+		"invalid schedule": "jobs:\n  - {server: srv, schedule: '61 * * * *', action: backup}",
+		"invalid action":   "jobs:\n  - {server: srv, schedule: '@daily', action: explode}",
+		"no command":       "jobs:\n  - {server: srv, schedule: '@daily', action: command}",
+		"no message":       "jobs:\n  - {server: srv, schedule: '@daily', action: say}",
+		"duplicate name":   "jobs:\n  - {server: srv, schedule: '@daily', action: backup}\n  - {server: srv, schedule: '@hourly', action: backup}", //nolint:lll
+	}
+
+	for name, config := range invalid {
+		if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := loadDaemonConfig(path); err == nil {
+			t.Errorf("%s: no error returned for invalid config", name)
+		}
+	}
+}
+
+func TestJobConfig_run(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	d := mock.NewDocker(server.ImageName)
+	m := &craft.Manager{Client: d, BackupDir: t.TempDir(), Now: time.Now}
+
+	s, err := m.NewServer(ctx, "srv", server.Config{Volume: true}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.RunBedrock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	backup := jobConfig{Name: "backup", Server: "srv", Action: actionBackup, Trim: 1}
+
+	// Backups taken in the same minute overwrite each other, so only the trim of an older file can be checked
+	if err := ioutil.WriteFile(filepath.Join(m.BackupDir, "srv", "srv_10-00_01-02-2021.zip"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backup.run(ctx, m); err != nil {
+		t.Fatalf("unexpected error running backup job: %s", err)
+	}
+
+	backups, err := m.Backups("srv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backups) != 1 || strings.HasPrefix(backups[0].File, "srv_10-00_01-02-2021") {
+		t.Errorf("unexpected backups after trim: %+v", backups)
+	}
+
+	command := jobConfig{Name: "command", Server: "srv", Action: actionCommand, Command: "time set 0600"}
+	if err := command.run(ctx, m); err != nil {
+		t.Errorf("unexpected error running command job: %s", err)
+	}
+
+	command.Command = "notacommand"
+	if err := command.run(ctx, m); err == nil {
+		t.Errorf("no error returned for an invalid command")
+	}
+
+	say := jobConfig{Name: "say", Server: "srv", Action: actionSay, Message: "hello"}
+	if err := say.run(ctx, m); err != nil {
+		t.Errorf("unexpected error running say job: %s", err)
+	}
+
+	missing := jobConfig{Name: "missing", Server: "nosuchserver", Action: actionSay, Message: "hello"}
+	if err := missing.run(ctx, m); err == nil {
+		t.Errorf("no error returned for a server which doesn't exist")
+	}
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/danhale-git/craft/craft"
+	"github.com/spf13/cobra"
+)
+
+// NewDoctorCmd returns the doctor command which finds and repairs problems left by interrupted craft commands.
+func NewDoctorCmd() *cobra.Command {
+	doctorCmd := &cobra.Command{
+		Use:   "doctor [servers...]",
+		Short: "Find and repair servers left in a bad state",
+		Long: `Check servers for problems left by interrupted craft commands and repair them.
+If a backup is interrupted before saving is resumed, the server is left in held-save state and changes to the world
+are not saved. Saving is resumed for any server left in this state. If no servers are given, all servers are checked.`,
+		Example: `craft doctor
+craft doctor myserver -o json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := commandContext(cmd)
+			defer cancel()
+
+			m, err := newManager(cmd)
+			if err != nil {
+				return err
+			}
+
+			names := args
+			if len(names) == 0 {
+				servers, err := m.Servers(ctx, true)
+				if err != nil {
+					return err
+				}
+
+				for _, s := range servers {
+					names = append(names, s.Name)
+				}
+			}
+
+			diagnoses := make([]craft.Diagnosis, 0)
+			failed := &serverErrors{total: len(names)}
+
+			for _, name := range names {
+				d, err := m.Diagnose(ctx, name)
+				if err != nil {
+					failed.add(name, err)
+					continue
+				}
+
+				diagnoses = append(diagnoses, d)
+			}
+
+			err = writeOutput(cmd, os.Stdout, diagnoses, func(w io.Writer) error {
+				for _, d := range diagnoses {
+					msg := "ok"
+					if d.Problem != "" {
+						msg = fmt.Sprintf("%s: %s", d.Problem, d.Repair)
+					}
+
+					if _, err := fmt.Fprintf(w, "%s: %s\n", d.Server, msg); err != nil {
+						return err
+					}
+				}
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			return failed.err()
+		},
+	}
+
+	addOutputFlag(doctorCmd)
+
+	return doctorCmd
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/danhale-git/craft/craft"
+	"github.com/danhale-git/craft/server"
+	"github.com/docker/docker/client"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes returned by craft. Scripts depend on these values so they must not be changed.
+const (
+	ExitOK                = 0
+	ExitError             = 1 // An error which has no specific exit code
+	ExitNotFound          = 2 // A server with the given name doesn't exist
+	ExitNotCraft          = 3 // A container with the given name exists but it is not a craft server
+	ExitPartialFailure    = 4 // The command failed for some, but not all, of the given servers
+	ExitDockerUnreachable = 5 // The docker daemon could not be reached
+	ExitBackupFailed      = 6 // A backup could not be taken
+	ExitCommandFailed     = 7 // The server reported that a command failed
+)
+
+// exitCode returns the exit code for an error returned by a command.
+func exitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+
+	var se *serverErrors
+	if errors.As(err, &se) {
+		if len(se.failed) < se.total {
+			return ExitPartialFailure
+		}
+
+		// Every server failed, use the shared exit code if there is one
+		code := exitCode(se.failed[0].err)
+
+		for _, f := range se.failed[1:] {
+			if exitCode(f.err) != code {
+				return ExitError
+			}
+		}
+
+		return code
+	}
+
+	switch {
+	case errors.Is(err, craft.ErrDockerUnreachable), client.IsErrConnectionFailed(err):
+		return ExitDockerUnreachable
+	case errors.Is(err, &server.NotFoundError{}):
+		return ExitNotFound
+	case errors.Is(err, &server.NotCraftError{}):
+		return ExitNotCraft
+	case errors.Is(err, &craft.BackupError{}):
+		return ExitBackupFailed
+	case errors.Is(err, &server.CommandError{}):
+		return ExitCommandFailed
+	default:
+		return ExitError
+	}
+}
+
+// serverErrors is returned by commands which operate on multiple servers, if the command failed for any of them.
+type serverErrors struct {
+	total  int // The number of servers the command operated on
+	failed []serverError
+}
+
+type serverError struct {
+	name string
+	err  error
+}
+
+func (e *serverErrors) Error() string {
+	msgs := make([]string, len(e.failed))
+	for i, f := range e.failed {
+		msgs[i] = fmt.Sprintf("%s: %s", f.name, f.err)
+	}
+
+	return fmt.Sprintf("failed for %d of %d servers: %s", len(e.failed), e.total, strings.Join(msgs, "; "))
+}
+
+// add records a failure for the named server.
+func (e *serverErrors) add(name string, err error) {
+	e.failed = append(e.failed, serverError{name: name, err: err})
+}
+
+// err returns e if any servers failed, otherwise nil.
+func (e *serverErrors) err() error {
+	if len(e.failed) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// errorOutput is the schema of errors written as JSON.
+type errorOutput struct {
+	Error    string              `json:"error"`
+	ExitCode int                 `json:"exit_code"`
+	Servers  []serverErrorOutput `json:"servers,omitempty"` // Each server which failed
+}
+
+type serverErrorOutput struct {
+	Name     string `json:"name"`
+	Error    string `json:"error"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// writeError writes err to w. If the command's output flag is json, the error is written as JSON.
+func writeError(cmd *cobra.Command, w io.Writer, err error) {
+	if format, _ := outputFormat(cmd); format != outputJSON {
+		fmt.Fprintln(w, "Error:", err)
+		return
+	}
+
+	out := errorOutput{
+		Error:    err.Error(),
+		ExitCode: exitCode(err),
+	}
+
+	var se *serverErrors
+	if errors.As(err, &se) {
+		for _, f := range se.failed {
+			out.Servers = append(out.Servers, serverErrorOutput{
+				Name:     f.name,
+				Error:    f.err.Error(),
+				ExitCode: exitCode(f.err),
+			})
+		}
+	}
+
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		fmt.Fprintln(w, "Error:", err)
+	}
+}
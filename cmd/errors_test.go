@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/danhale-git/craft/craft"
+	"github.com/danhale-git/craft/server"
+	"github.com/spf13/cobra"
+)
+
+func TestExitCode(t *testing.T) {
+	notFound := &server.NotFoundError{Name: "a"}
+	backupFailed := &craft.BackupError{Name: "b", Err: errors.New("timed out")}
+
+	cases := map[string]struct {
+		err  error
+		want int
+	}{
+		"nil":        {nil, ExitOK},
+		"other":      {errors.New("x"), ExitError},
+		"not found":  {fmt.Errorf("getting server: %w", notFound), ExitNotFound},
+		"not craft":  {&server.NotCraftError{Name: "a"}, ExitNotCraft},
+		"docker":     {fmt.Errorf("%w: refused", craft.ErrDockerUnreachable), ExitDockerUnreachable},
+		"backup":     {backupFailed, ExitBackupFailed},
+		"command":    {&server.CommandError{Command: "x", Message: "Syntax error"}, ExitCommandFailed},
+		"all failed": {&serverErrors{total: 2, failed: []serverError{{"a", notFound}, {"b", notFound}}}, ExitNotFound},
+		"mixed":      {&serverErrors{total: 2, failed: []serverError{{"a", notFound}, {"b", backupFailed}}}, ExitError},
+		"partial":    {&serverErrors{total: 2, failed: []serverError{{"b", backupFailed}}}, ExitPartialFailure},
+	}
+
+	for name, tc := range cases {
+		if got := exitCode(tc.err); got != tc.want {
+			t.Errorf("%s: unexpected exit code: want %d: got %d", name, tc.want, got)
+		}
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	cmd := &cobra.Command{}
+	addOutputFlag(cmd)
+
+	err := &serverErrors{total: 2, failed: []serverError{{"a", &server.NotFoundError{Name: "a"}}}}
+
+	var buf bytes.Buffer
+	writeError(cmd, &buf, err)
+
+	if !strings.HasPrefix(buf.String(), "Error: failed for 1 of 2 servers: a: ") {
+		t.Errorf("unexpected text error: %s", buf.String())
+	}
+
+	if err := cmd.Flags().Set("output", outputJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	writeError(cmd, &buf, err)
+
+	var got errorOutput
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("error output is not valid json: %s: %s", err, buf.String())
+	}
+
+	if got.ExitCode != ExitPartialFailure || len(got.Servers) != 1 || got.Servers[0].Name != "a" ||
+		got.Servers[0].ExitCode != ExitNotFound {
+		t.Errorf("unexpected json error: %+v", got)
+	}
+}
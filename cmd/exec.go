@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/danhale-git/craft/internal/logger"
+	"github.com/danhale-git/craft/server"
+	"github.com/spf13/cobra"
+)
+
+// NewExecCmd returns the exec command which runs a script of commands in the server cli.
+func NewExecCmd() *cobra.Command {
+	execCmd := &cobra.Command{
+		Use:   "exec <server>",
+		Short: "Run a script of commands in the bedrock server cli",
+		Long: `Run the commands in a script file, or from stdin, in order over a single connection to the server cli.
+Each line of the script is a server command. Empty lines and lines beginning with # are ignored. A line such as
+'wait 5s' pauses the script for the given duration. Each command is complete when the server logs no more output for
+the quiet period.
+If the server reports an error for a command, the rest of the script is skipped and craft exits with exit code 7. Use
+--continue-on-error to run the remaining commands anyway. The result of each command is printed when the script ends.`,
+		Example: `craft exec myserver -f reset.txt
+craft exec myserver < event.txt
+echo "time set 0600" | craft exec myserver -o json
+
+reset.txt:
+	# Reset the arena
+	gamerule pvp false
+	fill 0 64 0 20 70 20 air
+	wait 5s
+	tp @a 10 65 10`,
+		Args: cobra.ExactArgs(1),
+		RunE: execCommand,
+	}
+
+	execCmd.Flags().StringP("file", "f", "",
+		"Path to the script file. The script is read from stdin if this is empty or '-'.")
+	execCmd.Flags().Bool("continue-on-error", false,
+		"Run the rest of the script when a command fails.")
+	execCmd.Flags().Duration("quiet-period", server.DefaultQuietPeriod,
+		"Each command is complete when no output is logged for this long.")
+	addOutputFlag(execCmd)
+
+	return execCmd
+}
+
+func execCommand(cmd *cobra.Command, args []string) error {
+	path, err := cmd.Flags().GetString("file")
+	if err != nil {
+		logger.Panic(err)
+	}
+
+	continueOnError, err := cmd.Flags().GetBool("continue-on-error")
+	if err != nil {
+		logger.Panic(err)
+	}
+
+	quietPeriod, err := cmd.Flags().GetDuration("quiet-period")
+	if err != nil {
+		logger.Panic(err)
+	}
+
+	var script io.Reader = os.Stdin
+
+	if path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("opening script: %w", err)
+		}
+		defer f.Close()
+
+		script = f
+	}
+
+	steps, err := server.ParseScript(script)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	m, err := newManager(cmd)
+	if err != nil {
+		return err
+	}
+
+	s, err := m.GetServer(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	c, err := s.Console(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	c.QuietPeriod = quietPeriod
+
+	results, err := c.RunScript(ctx, steps, !continueOnError)
+
+	if writeErr := writeOutput(cmd, os.Stdout, results, func(w io.Writer) error {
+		return writeScriptResults(w, results)
+	}); writeErr != nil {
+		return writeErr
+	}
+
+	return err
+}
+
+// writeScriptResults writes the output of each command followed by a summary of the results.
+func writeScriptResults(w io.Writer, results []server.ScriptResult) error {
+	counts := make(map[string]int)
+
+	for _, r := range results {
+		counts[r.Status]++
+
+		if _, err := fmt.Fprintf(w, "[%s] line %d: %s\n", r.Status, r.Line, r.Command); err != nil {
+			return err
+		}
+
+		for _, l := range r.Lines {
+			if _, err := fmt.Fprintf(w, "    %s\n", l); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%d commands: %d ok, %d failed, %d skipped\n", len(results),
+		counts[server.StatusOK], counts[server.StatusFailed], counts[server.StatusSkipped])
+
+	return err
+}
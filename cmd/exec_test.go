@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/danhale-git/craft/server"
+)
+
+func TestWriteScriptResults(t *testing.T) {
+	results := []server.ScriptResult{
+		{Line: 1, Command: "time set 0600", Status: server.StatusOK, Lines: []string{"Set the time to 0600"}},
+		{Line: 3, Command: "notacommand", Status: server.StatusFailed, Lines: []string{"Syntax error"}},
+		{Line: 4, Command: "say hi", Status: server.StatusSkipped},
+	}
+
+	var buf bytes.Buffer
+	if err := writeScriptResults(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `[ok] line 1: time set 0600
+    Set the time to 0600
+[failed] line 3: notacommand
+    Syntax error
+[skipped] line 4: say hi
+3 commands: 1 ok, 1 failed, 1 skipped
+`
+
+	if buf.String() != want {
+		t.Errorf("unexpected output:\nwant %q\ngot  %q", want, buf.String())
+	}
+}
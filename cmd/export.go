@@ -1,8 +1,6 @@
 package cmd
 
 import (
-	"github.com/danhale-git/craft/craft"
-	"github.com/danhale-git/craft/internal/logger"
 	"github.com/spf13/cobra"
 )
 
@@ -14,24 +12,33 @@ func NewExportCommand() *cobra.Command {
 		Args: func(cmd *cobra.Command, args []string) error {
 			return cobra.ExactArgs(1)(cmd, args)
 		},
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			dir, err := cmd.Flags().GetString("destination")
 			if err != nil {
 				panic(err)
 			}
 
-			err = craft.ExportMCWorld(
-				craft.GetServerOrExit(args[0]),
-				dir,
-			)
+			ctx, cancel := commandContext(cmd)
+			defer cancel()
+
+			m, err := newManager(cmd)
+			if err != nil {
+				return err
+			}
+
+			s, err := m.GetServer(ctx, args[0])
 			if err != nil {
-				logger.Error.Fatal(err)
+				return err
 			}
+
+			return m.ExportMCWorld(ctx, s, dir)
 		},
 	}
 
 	command.Flags().StringP("destination", "d", "",
 		"Directory to save the .mcworld file.")
 
+	addSaveFlags(command)
+
 	return command
 }
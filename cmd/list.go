@@ -1,29 +1,46 @@
 package cmd
 
 import (
+	"io"
+	"os"
+
 	"github.com/danhale-git/craft/craft"
-	"github.com/danhale-git/craft/internal/logger"
 	"github.com/spf13/cobra"
 )
 
 // NewListCmd returns the list command which lists running and backed up servers.
 func NewListCmd() *cobra.Command {
 	listCmd := &cobra.Command{
-		Use:   "list <server>",
+		Use:   "list",
 		Short: "List servers",
 		Args:  cobra.NoArgs,
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			all, err := cmd.Flags().GetBool("all")
 			if err != nil {
 				panic(err)
 			}
 
-			if err := craft.PrintServers(all); err != nil {
-				logger.Error.Fatal(err)
+			ctx, cancel := commandContext(cmd)
+			defer cancel()
+
+			m, err := newManager(cmd)
+			if err != nil {
+				return err
+			}
+
+			servers, err := m.Servers(ctx, all)
+			if err != nil {
+				return err
 			}
+
+			return writeOutput(cmd, os.Stdout, servers, func(w io.Writer) error {
+				return craft.WriteServerTable(w, servers)
+			})
 		},
 	}
 
+	addOutputFlag(listCmd)
+
 	listCmd.Flags().BoolP("all", "a", false,
 		"Show all servers. The Default is to show only running servers.")
 
@@ -1,43 +1,390 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/danhale-git/craft/craft"
-	"github.com/danhale-git/craft/internal/logger"
+	"github.com/danhale-git/craft/mclog"
+	"github.com/danhale-git/craft/server"
+	"github.com/moby/term"
 	"github.com/spf13/cobra"
 )
 
+// prefixColors are the ANSI colors used for server name prefixes when printing the logs of multiple servers.
+var prefixColors = []int{36, 33, 35, 32, 34, 31} //nolint:gochecknoglobals
+
 // NewLogsCmd returns the logs command which tails the server cli output.
 func NewLogsCmd() *cobra.Command {
 	logsCmd := &cobra.Command{
-		Use:   "logs <server>",
+		Use:   "logs <servers...>",
 		Short: "Output server logs",
-		Args: func(cmd *cobra.Command, args []string) error {
-			return cobra.ExactArgs(1)(cmd, args)
-		},
-		Run: func(cmd *cobra.Command, args []string) {
-			c := craft.GetServerOrExit(args[0])
+		Long: `Output the logs of one or more servers, following new output until the command is cancelled.
+The logs of multiple servers are merged, each line prefixed with the name of its server. Lines can be filtered by a
+regular expression and by the minimum log level.
+Logs are archived when a server is stopped. The archived flag prints the latest archived log, or the log given by the
+file flag, and works for servers which no longer have a container. Container logs are rotated, so an archive holds the
+most recent output kept by Docker and may not start when the server did.`,
+		Example: `craft logs myserver --since 1h --no-follow --level warn
+craft logs server1 server2 --grep "Player (connected|disconnected)"
+craft logs myserver --archived --list
+craft logs myserver --archived --file myserver_10-00_01-02-2021.log`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := commandContext(cmd)
+			defer cancel()
+
+			opts, err := logOptions(cmd)
+			if err != nil {
+				return err
+			}
+
+			f, err := newLogFilter(cmd)
+			if err != nil {
+				return err
+			}
 
-			tail, err := cmd.Flags().GetInt("tail")
+			archived, err := cmd.Flags().GetBool("archived")
 			if err != nil {
 				panic(err)
 			}
 
-			logs, err := c.LogReader(tail)
+			m, err := newManager(cmd)
 			if err != nil {
-				logger.Error.Fatalf("reading logs from server: %s", err)
+				return err
 			}
 
-			if _, err := io.Copy(os.Stdout, logs); err != nil {
-				logger.Error.Fatalf("copying server output to stdout: %s", err)
+			if archived {
+				if len(args) > 1 || opts.Since != "" || opts.Until != "" {
+					return fmt.Errorf("archived logs can only be read for one server, without --since or --until")
+				}
+
+				if !cmd.Flags().Changed("tail") {
+					opts.Tail = -1
+				}
+
+				return archivedLogs(cmd, m, args[0], opts.Tail, f)
 			}
+
+			servers := make([]*server.Server, len(args))
+
+			for i, name := range args {
+				if servers[i], err = m.GetServer(ctx, name); err != nil {
+					return err
+				}
+			}
+
+			_, color := term.GetFdInfo(os.Stdout)
+
+			return printLogs(ctx, os.Stdout, servers, opts, f, color)
 		},
 	}
 
 	logsCmd.Flags().IntP("tail", "t", 20,
-		"The number of previous log lines to print immediately.")
+		"The number of previous log lines to print for each server. Archived logs are printed in full by default.")
+	logsCmd.Flags().String("since", "",
+		"Only print output logged after this time, a timestamp e.g. 2021-02-01T10:00:00 or a duration e.g. 30m.")
+	logsCmd.Flags().String("until", "",
+		"Only print output logged before this time, a timestamp or a duration. Logs are not followed.")
+	logsCmd.Flags().Bool("no-follow", false,
+		"Print the existing logs and exit instead of following new output.")
+	logsCmd.Flags().String("grep", "",
+		"Only print lines which match this regular expression.")
+	logsCmd.Flags().String("level", "",
+		"Only print lines logged at this level or above. [info|warn|error]")
+	logsCmd.Flags().Bool("archived", false,
+		"Print a log archived when the server was stopped.")
+	logsCmd.Flags().Bool("list", false,
+		"List the archived logs instead of printing one. Used with --archived.")
+	logsCmd.Flags().String("file", "",
+		"The archived log to print. Default (empty value) is the latest. Used with --archived.")
+	addOutputFlag(logsCmd)
 
 	return logsCmd
 }
+
+// logOptions returns the log options given by the command's flags.
+func logOptions(cmd *cobra.Command) (server.LogOptions, error) {
+	var opts server.LogOptions
+
+	var err error
+
+	if opts.Tail, err = cmd.Flags().GetInt("tail"); err != nil {
+		return opts, err
+	}
+
+	if opts.Since, err = cmd.Flags().GetString("since"); err != nil {
+		return opts, err
+	}
+
+	if opts.Until, err = cmd.Flags().GetString("until"); err != nil {
+		return opts, err
+	}
+
+	noFollow, err := cmd.Flags().GetBool("no-follow")
+	if err != nil {
+		return opts, err
+	}
+
+	opts.Follow = !noFollow && opts.Until == ""
+
+	return opts, nil
+}
+
+// logFilter selects log lines to be printed.
+type logFilter struct {
+	grep     *regexp.Regexp // Lines must match, if not nil
+	minLevel mclog.Level    // Lines must be logged at this level or above, if not LevelNone
+}
+
+// newLogFilter returns the log filter given by the command's flags.
+func newLogFilter(cmd *cobra.Command) (logFilter, error) {
+	var f logFilter
+
+	grep, err := cmd.Flags().GetString("grep")
+	if err != nil {
+		return f, err
+	}
+
+	if grep != "" {
+		if f.grep, err = regexp.Compile(grep); err != nil {
+			return f, fmt.Errorf("invalid grep expression: %w", err)
+		}
+	}
+
+	level, err := cmd.Flags().GetString("level")
+	if err != nil {
+		return f, err
+	}
+
+	if level != "" {
+		if f.minLevel, err = mclog.ParseLevel(level); err != nil {
+			return f, err
+		}
+	}
+
+	return f, nil
+}
+
+func (f logFilter) match(line string) bool {
+	if f.grep != nil && !f.grep.MatchString(line) {
+		return false
+	}
+
+	return f.minLevel == mclog.LevelNone || mclog.Parse(line).Level >= f.minLevel
+}
+
+// logLine is a line of output from a server's container.
+type logLine struct {
+	server string
+	time   time.Time
+	text   string
+}
+
+// printLogs writes the log lines of each server which match f to w. Lines from multiple servers are prefixed with the
+// server name, in color if color is true. If the logs are followed, lines are written as they are logged, otherwise
+// they are written in the order they were logged once all logs have been read.
+func printLogs(ctx context.Context, w io.Writer, servers []*server.Server, opts server.LogOptions, f logFilter, color bool) error { //nolint:lll
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	opts.Timestamps = true
+
+	lines := make(chan logLine)
+	errs := make(chan error, len(servers))
+
+	var wg sync.WaitGroup
+
+	for _, s := range servers {
+		logs, err := s.Logs(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("%s: reading logs: %w", s.ContainerName, err)
+		}
+
+		wg.Add(1)
+
+		go func(name string, r io.Reader) {
+			defer wg.Done()
+
+			errs <- readLogLines(ctx, name, r, lines)
+		}(s.ContainerName, logs)
+	}
+
+	go func() {
+		wg.Wait()
+		close(lines)
+		close(errs)
+	}()
+
+	prefix := logPrefixes(servers, color)
+	buffered := make([]logLine, 0)
+
+	for l := range lines {
+		if !f.match(l.text) {
+			continue
+		}
+
+		if !opts.Follow {
+			buffered = append(buffered, l)
+			continue
+		}
+
+		if _, err := fmt.Fprintln(w, prefix[l.server]+l.text); err != nil {
+			return err
+		}
+	}
+
+	sort.SliceStable(buffered, func(i, j int) bool {
+		return buffered[i].time.Before(buffered[j].time)
+	})
+
+	for _, l := range buffered {
+		if _, err := fmt.Fprintln(w, prefix[l.server]+l.text); err != nil {
+			return err
+		}
+	}
+
+	for err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readLogLines sends each timestamped line read from r to lines until the end of r or ctx is cancelled.
+func readLogLines(ctx context.Context, name string, r io.Reader, lines chan<- logLine) error {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		l := logLine{server: name, text: strings.TrimRight(scanner.Text(), "\r")}
+
+		if split := strings.SplitN(l.text, " ", 2); len(split) == 2 { //nolint:gomnd
+			if t, err := time.Parse(time.RFC3339Nano, split[0]); err == nil {
+				l.time, l.text = t, split[1]
+			}
+		}
+
+		select {
+		case lines <- l:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: reading logs: %w", name, err)
+	}
+
+	return nil
+}
+
+// logPrefixes returns the prefix for lines from each server. Lines have no prefix if there is only one server.
+func logPrefixes(servers []*server.Server, color bool) map[string]string {
+	prefixes := make(map[string]string, len(servers))
+
+	if len(servers) < 2 { //nolint:gomnd
+		return prefixes
+	}
+
+	width := 0
+
+	for _, s := range servers {
+		if len(s.ContainerName) > width {
+			width = len(s.ContainerName)
+		}
+	}
+
+	for i, s := range servers {
+		p := fmt.Sprintf("%-*s", width, s.ContainerName)
+
+		if color {
+			p = fmt.Sprintf("\x1b[%dm%s\x1b[0m", prefixColors[i%len(prefixColors)], p)
+		}
+
+		prefixes[s.ContainerName] = p + " | "
+	}
+
+	return prefixes
+}
+
+// archivedLogs prints the lines of the server's archived log which match f, or lists its archived logs if the list
+// flag is set. If tail is not negative, only that number of matching lines from the end of the log are printed.
+func archivedLogs(cmd *cobra.Command, m *craft.Manager, name string, tail int, f logFilter) error {
+	list, err := cmd.Flags().GetBool("list")
+	if err != nil {
+		panic(err)
+	}
+
+	if list {
+		logs, err := m.LogArchives(name)
+		if err != nil {
+			return fmt.Errorf("%s: listing archived logs: %w", name, err)
+		}
+
+		return writeOutput(cmd, os.Stdout, logs, func(w io.Writer) error {
+			for _, l := range logs {
+				if _, err := fmt.Fprintln(w, l.File); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	}
+
+	fileName, err := cmd.Flags().GetString("file")
+	if err != nil {
+		panic(err)
+	}
+
+	r, err := m.OpenLogArchive(name, fileName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return writeTail(os.Stdout, r, tail, f)
+}
+
+// writeTail writes the last n lines read from r which match f to w. If n is negative, all matching lines are written.
+func writeTail(w io.Writer, r io.Reader, n int, f logFilter) error {
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		l := strings.TrimRight(scanner.Text(), "\r")
+
+		if n == 0 || !f.match(l) {
+			continue
+		}
+
+		if len(lines) == n {
+			lines = lines[1:]
+		}
+
+		lines = append(lines, l)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, l := range lines {
+		if _, err := fmt.Fprintln(w, l); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
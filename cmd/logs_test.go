@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danhale-git/craft/internal/mock"
+	"github.com/danhale-git/craft/mclog"
+	"github.com/danhale-git/craft/server"
+)
+
+func TestWriteTail(t *testing.T) {
+	cases := map[int]string{
+		-1: "a\nb\nc\nd\n",
+		0:  "",
+		2:  "c\nd\n",
+		9:  "a\nb\nc\nd\n",
+	}
+
+	for n, want := range cases {
+		var buf bytes.Buffer
+
+		if err := writeTail(&buf, strings.NewReader("a\r\nb\r\nc\r\nd\r\n"), n, logFilter{}); err != nil {
+			t.Fatal(err)
+		}
+
+		if buf.String() != want {
+			t.Errorf("%d lines: want %q: got %q", n, want, buf.String())
+		}
+	}
+}
+
+func TestLogFilter_match(t *testing.T) {
+	lines := []string{
+		"[2021-02-01 10:00:00:000 INFO] Server started.",
+		"[2021-02-01 10:00:01:000 WARN] Unable to load world",
+		"[2021-02-01 10:00:02:000 ERROR] Crashed",
+		"[INFO] Player connected: Steve, xuid: 123",
+		"NO LOG FILE! - setting up server logging...",
+	}
+
+	cases := map[string]struct {
+		filter logFilter
+		want   []int
+	}{
+		"none":  {logFilter{}, []int{0, 1, 2, 3, 4}},
+		"warn":  {logFilter{minLevel: mclog.LevelWarn}, []int{1, 2}},
+		"grep":  {logFilter{grep: regexp.MustCompile(`Player|Crash`)}, []int{2, 3}},
+		"both":  {logFilter{grep: regexp.MustCompile(`e`), minLevel: mclog.LevelError}, []int{2}},
+		"info+": {logFilter{minLevel: mclog.LevelInfo}, []int{0, 1, 2, 3}},
+	}
+
+	for name, tc := range cases {
+		got := make([]int, 0)
+
+		for i, l := range lines {
+			if tc.filter.match(l) {
+				got = append(got, i)
+			}
+		}
+
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: unexpected matches: want %v: got %v", name, tc.want, got)
+			continue
+		}
+
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: unexpected matches: want %v: got %v", name, tc.want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestPrintLogs(t *testing.T) {
+	ctx := context.Background()
+	d := mock.NewDocker(server.ImageName)
+
+	servers := make([]*server.Server, 0)
+
+	for i, name := range []string{"a", "bb"} {
+		s, err := server.New(ctx, d, name, server.Config{Port: 19132 + i})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = s.RunBedrock(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		servers = append(servers, s)
+	}
+
+	// Log to each server alternately
+	for i, l := range []string{"[INFO] 1", "[WARN] 2", "[INFO] 3", "[WARN] 4"} {
+		b, _ := d.Container(servers[i%2].ContainerName)
+		b.Log(l)
+		time.Sleep(time.Millisecond)
+	}
+
+	opts := server.LogOptions{Tail: -1}
+	f := logFilter{grep: regexp.MustCompile(`^\[\w+\] \d$`)}
+
+	var buf bytes.Buffer
+	if err := printLogs(ctx, &buf, servers, opts, f, false); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "a  | [INFO] 1\nbb | [WARN] 2\na  | [INFO] 3\nbb | [WARN] 4\n"
+	if buf.String() != want {
+		t.Errorf("unexpected merged logs: want:\n%s\ngot:\n%s", want, buf.String())
+	}
+
+	buf.Reset()
+
+	f.minLevel = mclog.LevelWarn
+	if err := printLogs(ctx, &buf, servers[:1], opts, f, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "" {
+		t.Errorf("unexpected lines below the minimum level: %s", buf.String())
+	}
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/danhale-git/craft/internal/logger"
+	"github.com/danhale-git/craft/internal/metrics"
+	"github.com/spf13/cobra"
+)
+
+// scrapeTimeout is the time allowed to collect metrics for one request to the metrics endpoint.
+const scrapeTimeout = 10 * time.Second
+
+// NewMetricsCmd returns the metrics command which prints or serves server metrics in the Prometheus format.
+func NewMetricsCmd() *cobra.Command {
+	metricsCmd := &cobra.Command{
+		Use:   "metrics",
+		Short: "Print or serve server and backup metrics for Prometheus",
+		Long: `Print the metrics of every server in the Prometheus text format, or serve them at /metrics with --listen.
+Each metric is labeled with the server name. Server metrics are: whether it is up, online players, container CPU and
+memory use and uptime. Players are counted by running 'list' in the server cli, at most every 30 seconds. Backup
+metrics are: time of the last successful backup, its duration and size and the count of successful and failed backups.
+Backup metrics are recorded by every craft command which takes a backup. For older backups, the time and size of the
+newest backup file are used.`,
+		Example: `craft metrics
+craft metrics --listen :9180
+
+prometheus.yml:
+	scrape_configs:
+	  - job_name: craft
+	    static_configs:
+	      - targets: ["localhost:9180"]`,
+		Args: cobra.NoArgs,
+		RunE: metricsCommand,
+	}
+
+	metricsCmd.Flags().String("listen", "",
+		"Serve metrics at /metrics on this address e.g. :9180. Default (empty value) prints the metrics once.")
+
+	return metricsCmd
+}
+
+func metricsCommand(cmd *cobra.Command, args []string) error {
+	listen, err := cmd.Flags().GetString("listen")
+	if err != nil {
+		logger.Panic(err)
+	}
+
+	m, err := newManager(cmd)
+	if err != nil {
+		return err
+	}
+
+	c := &metrics.Collector{Manager: m, ErrorLog: logger.Error}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	if listen == "" {
+		families, err := c.Collect(ctx)
+		if err != nil {
+			return err
+		}
+
+		return metrics.Write(os.Stdout, families)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		scrapeCtx, cancel := context.WithTimeout(r.Context(), scrapeTimeout)
+		defer cancel()
+
+		families, err := c.Collect(scrapeCtx)
+		if err != nil {
+			logger.Error.Printf("collecting metrics: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := metrics.Write(&buf, families); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", metrics.ContentType)
+
+		if _, err := buf.WriteTo(w); err != nil {
+			logger.Error.Printf("writing metrics: %s", err)
+		}
+	})
+
+	srv := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second, //nolint:gomnd
+	}
+
+	served := make(chan error, 1)
+
+	go func() {
+		logger.Info.Printf("serving metrics on %s/metrics", listen)
+		served <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-served:
+		return fmt.Errorf("serving metrics: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error.Printf("stopping the metrics server: %s", err)
+	}
+
+	return nil
+}
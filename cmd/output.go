@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	outputTable = "table" // Human readable output, the default
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// addOutputFlag adds the output flag to a command which supports machine-readable output.
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP("output", "o", outputTable,
+		"Output format. [table|json|yaml]")
+}
+
+// outputFormat returns the value of the output flag, or an error if the format is not supported.
+func outputFormat(cmd *cobra.Command) (string, error) {
+	if cmd.Flags().Lookup("output") == nil {
+		return outputTable, nil
+	}
+
+	format, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return "", err
+	}
+
+	switch format {
+	case outputTable, outputJSON, outputYAML:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid output format '%s', must be one of table, json or yaml", format)
+	}
+}
+
+// writeOutput writes v to out in the format given by the output flag. If the format is table, writeTable is called
+// instead.
+func writeOutput(cmd *cobra.Command, out io.Writer, v interface{}, writeTable func(io.Writer) error) error {
+	format, err := outputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(v)
+	case outputYAML:
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		_, err = out.Write(b)
+
+		return err
+	default:
+		return writeTable(out)
+	}
+}
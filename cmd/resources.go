@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/danhale-git/craft/server"
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+)
+
+// addResourceFlags adds flags which limit the host resources a server can use.
+func addResourceFlags(cmd *cobra.Command) {
+	cmd.Flags().String("memory", "",
+		"Memory limit e.g. 2g or 512m. Default (empty value) is unlimited.")
+	cmd.Flags().Int64("cpu-shares", 0,
+		"CPU weight relative to other containers, docker's default is 1024. Default (0 value) doesn't set a weight.")
+	cmd.Flags().Float64("cpus", 0,
+		"Number of CPUs the server can use e.g. 1.5. Default (0 value) is unlimited.")
+	cmd.Flags().Int64("pids-limit", 0,
+		"Maximum number of processes in the server's container. Default (0 value) is unlimited.")
+}
+
+// resourceLimits returns the resource limits given by the flags added with addResourceFlags.
+func resourceLimits(cmd *cobra.Command) (server.Resources, error) {
+	var res server.Resources
+
+	memory, err := cmd.Flags().GetString("memory")
+	if err != nil {
+		return res, err
+	}
+
+	if memory != "" {
+		if res.Memory, err = units.RAMInBytes(memory); err != nil || res.Memory <= 0 {
+			return res, fmt.Errorf("invalid memory limit '%s'", memory)
+		}
+	}
+
+	if res.CPUShares, err = cmd.Flags().GetInt64("cpu-shares"); err != nil {
+		return res, err
+	}
+
+	cpus, err := cmd.Flags().GetFloat64("cpus")
+	if err != nil {
+		return res, err
+	}
+
+	// Microseconds per 100ms period
+	res.CPUQuota = int64(cpus * 100000) //nolint:gomnd
+
+	if res.PidsLimit, err = cmd.Flags().GetInt64("pids-limit"); err != nil {
+		return res, err
+	}
+
+	if res.CPUShares < 0 || res.CPUQuota < 0 || res.PidsLimit < 0 {
+		return res, fmt.Errorf("resource limits must not be negative")
+	}
+
+	return res, nil
+}
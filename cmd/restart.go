@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/danhale-git/craft/internal/logger"
+	"github.com/danhale-git/craft/server"
+	"github.com/spf13/cobra"
+)
+
+// NewRestartCmd returns the restart command which stops a server and starts it again on the same port.
+func NewRestartCmd() *cobra.Command {
+	restartCmd := &cobra.Command{
+		Use:   "restart <servers...>",
+		Short: "Restart a running server",
+		Long: `Stop the server and start it again on the same port.
+Servers without a volume are backed up first and recreated from that backup. If the backup fails the server is not
+restarted. Use the backup flag to also take a backup of servers with a volume.
+If the warn flag is given, players are shown a countdown before the server stops.`,
+		Example: `craft restart myserver --warn 5m`,
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			warn, err := cmd.Flags().GetDuration("warn")
+			if err != nil {
+				logger.Panic(err)
+			}
+
+			backup, err := cmd.Flags().GetBool("backup")
+			if err != nil {
+				logger.Panic(err)
+			}
+
+			ctx, cancel := commandContext(cmd)
+			defer cancel()
+
+			restarted := make([]string, 0)
+			failed := &serverErrors{total: len(args)}
+
+			m, err := newManager(cmd)
+			if err != nil {
+				return err
+			}
+
+			servers := make([]*server.Server, 0)
+
+			for _, name := range args {
+				c, err := m.GetServer(ctx, name)
+				if err != nil {
+					failed.add(name, err)
+					continue
+				}
+
+				servers = append(servers, c)
+			}
+
+			if warn > 0 {
+				servers = warnStop(ctx, servers, warn, failed)
+			}
+
+			for _, c := range servers {
+				if _, err := m.RestartServer(ctx, c, backup); err != nil {
+					failed.add(c.ContainerName, err)
+					continue
+				}
+
+				restarted = append(restarted, c.ContainerName)
+			}
+
+			if len(restarted) > 0 {
+				logger.Info.Println("restarted:", strings.Join(restarted, " "))
+			}
+
+			return failed.err()
+		},
+	}
+
+	restartCmd.Flags().Duration("warn", 0,
+		"Warn players with a countdown of the given length before restarting e.g. 60s.")
+	restartCmd.Flags().Bool("backup", false,
+		"Take a backup of servers with a volume. Servers without a volume are always backed up.")
+
+	addSaveFlags(restartCmd)
+
+	return restartCmd
+}
@@ -1,9 +1,12 @@
 package cmd
 
 import (
-	"github.com/danhale-git/craft/craft"
+	"fmt"
+	"net"
+
 	"github.com/danhale-git/craft/internal/logger"
 	"github.com/danhale-git/craft/mcworld"
+	"github.com/danhale-git/craft/server"
 	"github.com/spf13/cobra"
 )
 
@@ -15,12 +18,18 @@ func NewRunCmd() *cobra.Command {
 		Long: `Runs a new docker container and runs the server process within it.
 A .mcworld file and custom server.properties fields may be provided via command line flags.
 When setting multiple properties, provide each one as a separate flag. Each flag should define only property field.
-If no port flag is provided, the lowest available (unused by docker) port between 19132 and 19232 will be used.`,
-		Example: `craft run mynewserver --world C:\Users\MyUser\Downloads\exported_world.mcworld --prop difficulty=hard`,
+If no port flag is provided, the lowest available port in the range given by --port-range will be used. A port is
+available if no docker container binds it, no stopped server will reclaim it and it isn't in use on the host.
+With --network host the server listens on the host's ports directly and server-port is set in server.properties.
+Servers run as a non-root user with all capabilities dropped. Servers created from images built before this default
+run as root, rebuild the image with 'craft build' to run them as a non-root user. Resource limits are unlimited unless
+given.`,
+		Example: `craft run mynewserver --world C:\Users\MyUser\Downloads\exported_world.mcworld --prop difficulty=hard
+craft run mynewserver --port 19140 --ipv6-port 19141 --bind-ip 192.168.1.10`,
 		Args: func(cmd *cobra.Command, args []string) error {
 			return cobra.RangeArgs(1, 1)(cmd, args)
 		},
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			port, err := cmd.Flags().GetInt("port")
 			if err != nil {
 				logger.Panic(err)
@@ -41,31 +50,127 @@ If no port flag is provided, the lowest available (unused by docker) port betwee
 				logger.Panic(err)
 			}
 
+			image, err := cmd.Flags().GetString("image")
+			if err != nil {
+				logger.Panic(err)
+			}
+
+			tags, err := cmd.Flags().GetStringToString("tag")
+			if err != nil {
+				logger.Panic(err)
+			}
+
+			ipv6Port, err := cmd.Flags().GetInt("ipv6-port")
+			if err != nil {
+				logger.Panic(err)
+			}
+
+			bindIP, err := cmd.Flags().GetString("bind-ip")
+			if err != nil {
+				logger.Panic(err)
+			}
+
+			if bindIP != "" && net.ParseIP(bindIP) == nil {
+				return fmt.Errorf("invalid bind ip '%s'", bindIP)
+			}
+
+			network, err := cmd.Flags().GetString("network")
+			if err != nil {
+				logger.Panic(err)
+			}
+
+			if cmd.Flags().Changed("lan-visibility") {
+				lan, err := cmd.Flags().GetBool("lan-visibility")
+				if err != nil {
+					logger.Panic(err)
+				}
+
+				props = append(props, fmt.Sprintf("enable-lan-visibility=%t", lan))
+			}
+
+			user, err := cmd.Flags().GetString("user")
+			if err != nil {
+				logger.Panic(err)
+			}
+
+			unconfined, err := cmd.Flags().GetBool("unconfined")
+			if err != nil {
+				logger.Panic(err)
+			}
+
+			res, err := resourceLimits(cmd)
+			if err != nil {
+				return err
+			}
+
 			var mcwFile mcworld.ZipOpener
 			if mcwPath != "" {
 				mcwFile = mcworld.MCWorld{Path: mcwPath}
 			}
 
-			c, err := craft.NewServer(args[0], port, props, mcwFile, !noVolume)
+			ctx, cancel := commandContext(cmd)
+			defer cancel()
+
+			m, err := newManager(cmd)
 			if err != nil {
-				logger.Error.Fatalf("creating server: %s", err)
+				return err
+			}
+
+			cfg := server.Config{
+				Port:     port,
+				IPv6Port: ipv6Port,
+				BindIP:   bindIP,
+				Network:  network,
+				Volume:   !noVolume,
+				Image:    image,
+				Tags:     tags,
+
+				Resources:  res,
+				User:       user,
+				Unconfined: unconfined,
+			}
+
+			c, err := m.NewServer(ctx, args[0], cfg, props, mcwFile)
+			if err != nil {
+				return fmt.Errorf("creating server: %w", err)
 			}
 
 			// Run the server process
-			if err = c.RunBedrock(); err != nil {
-				logger.Error.Fatalf("starting server process: %s", err)
+			if err = c.RunBedrock(ctx); err != nil {
+				return fmt.Errorf("starting server process: %w", err)
 			}
+
+			return nil
 		},
 	}
 
 	runCmd.Flags().Int("port", 0,
 		"External port for players connect to. Default (0 value) will auto-assign a port.")
+	runCmd.Flags().Int("ipv6-port", 0,
+		"External port for players connecting over IPv6. Default (0 value) doesn't publish the IPv6 port.")
+	runCmd.Flags().String("bind-ip", "",
+		"Host IP address the ports are bound to. Default (empty value) binds all IPv4 addresses.")
+	runCmd.Flags().String("network", "",
+		"Docker network to attach the server to, or 'host' to use the host's network.")
+	runCmd.Flags().Bool("lan-visibility", true,
+		"Show the server to players on the local network (the enable-lan-visibility property).")
 	runCmd.Flags().String("world", "",
 		"Path to a .mcworld file to be loaded.")
 	runCmd.Flags().StringSlice("prop", nil,
 		"A server.properties field e.g. --prop gamemode=survival")
 	runCmd.Flags().Bool("no-volume", false,
 		"World data is only saved when the 'craft backup' command is run, no persistent storage.")
+	runCmd.Flags().String("image", "",
+		"Docker image to run the server in. Default (empty value) is the image built by 'craft build'.")
+	runCmd.Flags().StringToString("tag", nil,
+		"A label added to the server's container e.g. --tag owner=me")
+
+	runCmd.Flags().String("user", "",
+		"User the server runs as. Default (empty value) is the non-root user which owns the server files in the image.")
+	runCmd.Flags().Bool("unconfined", false,
+		"Don't drop the container's capabilities or prevent the server from gaining privileges.")
+
+	addResourceFlags(runCmd)
 
 	return runCmd
 }
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/danhale-git/craft/internal/api"
+	"github.com/danhale-git/craft/internal/jobs"
+	"github.com/danhale-git/craft/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+const (
+	apiTokenEnv     = "CRAFT_API_TOKEN" // Environment variable holding the API token, if no token file is given
+	shutdownTimeout = 10 * time.Second  // Time allowed for requests to complete when the API server stops
+)
+
+// NewServeCmd returns the serve command which serves the HTTP API.
+func NewServeCmd() *cobra.Command {
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve a JSON HTTP API for managing servers",
+		Long: fmt.Sprintf(`Serve a JSON HTTP API for managing servers until craft is stopped.
+Every request must have the header 'Authorization: Bearer <token>'. The token is read from the file given by
+--token-file or the %s environment variable.
+Run, start, stop and backup are run as jobs in the background. They respond with 202 Accepted and the job, which can
+be requested from the URL in the Location header until its status is no longer 'running'. Jobs for the same server
+never run at the same time, a request which would start another job for the server fails with 409 Conflict.
+
+Endpoints:
+  GET  /servers                     List running servers, add ?all=true to include stopped servers
+  POST /servers                     Run a new server {"name", "port", "properties", "no_volume", ...}
+  POST /servers/<name>/start        Start a stopped server {"port"}
+  POST /servers/<name>/stop         Stop a server, taking a backup if it has no volume {"warn": "60s"}
+  POST /servers/<name>/configure    Set server.properties values {"properties": {"gamemode": "creative"}}
+  POST /servers/<name>/command      Run a command in the server cli {"command": "time set 0600"}
+  GET  /servers/<name>/export       Download the world as a .mcworld file
+  GET  /servers/<name>/backups      List backup files
+  POST /servers/<name>/backups      Take a backup {"trim": 3}
+  POST /servers/<name>/backups/trim Delete the oldest backups {"keep": 3}
+  GET  /jobs                        List recent and running jobs
+  GET  /jobs/<id>                   Get a job`, apiTokenEnv),
+		Example: `CRAFT_API_TOKEN=secret craft serve --listen :8080
+craft serve --listen 0.0.0.0:8443 --token-file ~/.craft_token --tls-cert cert.pem --tls-key key.pem
+
+curl -H "Authorization: Bearer secret" localhost:8080/servers
+curl -H "Authorization: Bearer secret" -d '{"trim": 3}' localhost:8080/servers/myserver/backups`,
+		Args: cobra.NoArgs,
+		RunE: serveCommand,
+	}
+
+	serveCmd.Flags().String("listen", "localhost:8080",
+		"Address the API listens on e.g. :8080 for all interfaces.")
+	serveCmd.Flags().String("token-file", "",
+		fmt.Sprintf("Path to a file containing the API token. Default (empty value) reads the %s environment variable.",
+			apiTokenEnv))
+	serveCmd.Flags().String("tls-cert", "",
+		"Path to a TLS certificate file. If this and --tls-key are given, the API is served over HTTPS.")
+	serveCmd.Flags().String("tls-key", "",
+		"Path to the TLS private key file for --tls-cert.")
+	addSaveFlags(serveCmd)
+
+	return serveCmd
+}
+
+func serveCommand(cmd *cobra.Command, args []string) error {
+	listen, err := cmd.Flags().GetString("listen")
+	if err != nil {
+		logger.Panic(err)
+	}
+
+	tokenFile, err := cmd.Flags().GetString("token-file")
+	if err != nil {
+		logger.Panic(err)
+	}
+
+	certFile, err := cmd.Flags().GetString("tls-cert")
+	if err != nil {
+		logger.Panic(err)
+	}
+
+	keyFile, err := cmd.Flags().GetString("tls-key")
+	if err != nil {
+		logger.Panic(err)
+	}
+
+	if (certFile == "") != (keyFile == "") {
+		return errors.New("--tls-cert and --tls-key must be given together")
+	}
+
+	token, err := apiToken(tokenFile)
+	if err != nil {
+		return err
+	}
+
+	m, err := newManager(cmd)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	r := &jobs.Runner{
+		Log:      logger.Info,
+		ErrorLog: logger.Error,
+	}
+
+	srv := &http.Server{
+		Addr:              listen,
+		Handler:           api.New(ctx, m, token, r),
+		ReadHeaderTimeout: 10 * time.Second, //nolint:gomnd
+	}
+
+	served := make(chan error, 1)
+
+	go func() {
+		logger.Info.Printf("serving the API on %s", listen)
+
+		if certFile != "" {
+			served <- srv.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			served <- srv.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-served:
+		return fmt.Errorf("serving the API: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error.Printf("stopping the API: %s", err)
+	}
+
+	// Running jobs were cancelled with ctx
+	r.Wait()
+
+	logger.Info.Println("API stopped")
+
+	return nil
+}
+
+// apiToken returns the API token from the given file, or from the environment if the path is empty. The token must not
+// be empty.
+func apiToken(path string) (string, error) {
+	token := os.Getenv(apiTokenEnv)
+
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading API token: %w", err)
+		}
+
+		token = string(b)
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("no API token, set %s or use --token-file", apiTokenEnv)
+	}
+
+	return token, nil
+}
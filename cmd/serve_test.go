@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAPIToken(t *testing.T) {
+	defer os.Setenv(apiTokenEnv, os.Getenv(apiTokenEnv))
+
+	os.Setenv(apiTokenEnv, " from-env\n")
+
+	if token, err := apiToken(""); err != nil || token != "from-env" {
+		t.Errorf("unexpected token from the environment: %q, %v", token, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if token, err := apiToken(path); err != nil || token != "from-file" {
+		t.Errorf("unexpected token from a file: %q, %v", token, err)
+	}
+
+	os.Setenv(apiTokenEnv, "")
+
+	if _, err := apiToken(""); err == nil {
+		t.Errorf("no error returned for an empty token")
+	}
+
+	if _, err := apiToken(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("no error returned for a missing token file")
+	}
+}
@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"fmt"
+	"net"
 	"strings"
 
-	"github.com/danhale-git/craft/craft"
 	"github.com/danhale-git/craft/internal/logger"
+	"github.com/danhale-git/craft/server"
 	"github.com/spf13/cobra"
 )
 
@@ -16,33 +18,39 @@ func NewStartCmd() *cobra.Command {
 		Short: "Start a stopped server",
 		Long: `Start creates a new server from the latest backup for the given server name(s).
 
-If no port flag is provided, the lowest available (unused by docker) port between 19132 and 19232 will be used.
-If multiple arguments are provided, the --port flag is ignored and ports are assigned automatically.`,
+The server is started with the port, volume, image, tags, resource limits and security options it had when it was last
+backed up or created. The port, IPv6 port, bind IP, network, image and resource limit flags replace the saved settings
+they apply to and --tag adds to the saved tags. Changed settings are kept for future starts. If the server's container
+still exists because it has a volume, only resource limits can be changed.
+If multiple arguments are provided, the --port and --ipv6-port flags are ignored.`,
 		Args: cobra.MinimumNArgs(1),
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := commandContext(cmd)
+			defer cancel()
+
 			started := make([]string, 0)
+			failed := &serverErrors{total: len(args)}
 
-			var port int
-			var err error
+			m, err := newManager(cmd)
+			if err != nil {
+				return err
+			}
 
-			if len(args) > 1 {
-				port = 0
-			} else {
-				port, err = cmd.Flags().GetInt("port")
-				if err != nil {
-					panic(err)
-				}
+			override, err := startOverrides(cmd, len(args) > 1)
+			if err != nil {
+				return err
 			}
 
 			for _, name := range args {
-				c, err := craft.StartServer(name, port)
+				c, err := m.StartServer(ctx, name, override)
 				if err != nil {
-					logger.Error.Println(err)
+					failed.add(name, err)
 					continue
 				}
 
-				if err = c.RunBedrock(); err != nil {
-					logger.Error.Printf("%s: starting server process: %s", name, err)
+				if err = c.RunBedrock(ctx); err != nil {
+					failed.add(name, fmt.Errorf("starting server process: %w", err))
+					continue
 				}
 
 				started = append(started, name)
@@ -51,11 +59,69 @@ If multiple arguments are provided, the --port flag is ignored and ports are ass
 			if len(started) > 0 {
 				logger.Info.Println("started:", strings.Join(started, " "))
 			}
+
+			return failed.err()
 		},
 	}
 
 	startCmd.Flags().IntP("port", "p", 0,
-		"External port for players connect to. Default (0 value) will auto-assign a port.")
+		"External port for players connect to. Default (0 value) uses the saved port, or auto-assigns one if none was saved.")
+	startCmd.Flags().Int("ipv6-port", 0,
+		"External port for players connecting over IPv6. Default (0 value) uses the saved IPv6 port.")
+	startCmd.Flags().String("bind-ip", "",
+		"Host IP address the ports are bound to. Default (empty value) uses the saved bind IP.")
+	startCmd.Flags().String("network", "",
+		"Docker network to attach the server to, or 'host'. Default (empty value) uses the saved network.")
+	startCmd.Flags().String("image", "",
+		"Docker image to run the server in. Default (empty value) uses the saved image.")
+	startCmd.Flags().StringToString("tag", nil,
+		"A label added to the server's container e.g. --tag owner=me")
+
+	addResourceFlags(startCmd)
 
 	return startCmd
 }
+
+// startOverrides returns the settings given by the start command's flags which replace the saved configuration. If
+// multiple servers are started, the ports are not set.
+func startOverrides(cmd *cobra.Command, multiple bool) (server.Config, error) {
+	var cfg server.Config
+
+	var err error
+
+	if !multiple {
+		if cfg.Port, err = cmd.Flags().GetInt("port"); err != nil {
+			logger.Panic(err)
+		}
+
+		if cfg.IPv6Port, err = cmd.Flags().GetInt("ipv6-port"); err != nil {
+			logger.Panic(err)
+		}
+	}
+
+	if cfg.BindIP, err = cmd.Flags().GetString("bind-ip"); err != nil {
+		logger.Panic(err)
+	}
+
+	if cfg.BindIP != "" && net.ParseIP(cfg.BindIP) == nil {
+		return cfg, fmt.Errorf("invalid bind ip '%s'", cfg.BindIP)
+	}
+
+	if cfg.Network, err = cmd.Flags().GetString("network"); err != nil {
+		logger.Panic(err)
+	}
+
+	if cfg.Image, err = cmd.Flags().GetString("image"); err != nil {
+		logger.Panic(err)
+	}
+
+	if cfg.Tags, err = cmd.Flags().GetStringToString("tag"); err != nil {
+		logger.Panic(err)
+	}
+
+	if cfg.Resources, err = resourceLimits(cmd); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
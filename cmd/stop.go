@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/danhale-git/craft/craft"
 	"github.com/danhale-git/craft/internal/logger"
+	"github.com/danhale-git/craft/server"
 	"github.com/spf13/cobra"
 )
 
@@ -14,31 +18,112 @@ func NewStopCmd() *cobra.Command {
 	stopCmd := &cobra.Command{
 		Use:   "stop <servers...>",
 		Short: "Back up and stop a running server",
-		Long:  `Back up the server then stop it. If the backup process fails, the server will not be stopped. `,
-		Args:  cobra.MinimumNArgs(1),
-		Run: func(cmd *cobra.Command, args []string) {
+		Long: `Back up the server then stop it. If the backup process fails, the server will not be stopped.
+If the warn flag is given, players are shown a countdown before the server stops.
+The server is stopped gracefully and an error is reported if it doesn't shut down cleanly.
+The server's log is archived next to its backups, run 'craft logs --archived <server>' to view it. The container log is
+rotated, so the oldest output of a very long running server may be missing from the archive.`,
+		Example: `craft stop myserver --warn 60s`,
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			warn, err := cmd.Flags().GetDuration("warn")
+			if err != nil {
+				logger.Panic(err)
+			}
+
+			ctx, cancel := commandContext(cmd)
+			defer cancel()
+
 			stopped := make([]string, 0)
+			failed := &serverErrors{total: len(args)}
+
+			m, err := newManager(cmd)
+			if err != nil {
+				return err
+			}
+
+			servers := make([]*server.Server, 0)
 
 			for _, name := range args {
+				c, err := m.GetServer(ctx, name)
+				if err != nil {
+					failed.add(name, err)
+					continue
+				}
 
-				c := craft.GetServerOrExit(name)
+				servers = append(servers, c)
+			}
+
+			if warn > 0 {
+				servers = warnStop(ctx, servers, warn, failed)
+			}
+
+			for _, c := range servers {
+				hasVolume, err := c.HasVolume(ctx)
+				if err != nil {
+					failed.add(c.ContainerName, err)
+					continue
+				}
 
-				if !c.HasVolume() {
-					if _, err := craft.CopyBackup(c); err != nil {
-						logger.Error.Printf("%s: error while taking backup: %s", c.ContainerName, err)
+				if !hasVolume {
+					if _, err := m.CopyBackup(ctx, c); err != nil {
+						failed.add(c.ContainerName, err)
 						continue
 					}
 				}
 
-				if err := c.Stop(); err != nil {
-					logger.Error.Printf("%s: stopping server: %s", c.ContainerName, err)
+				if err := m.StopServer(ctx, c); err != nil {
+					failed.add(c.ContainerName, fmt.Errorf("stopping server: %w", err))
 					continue
 				}
 				stopped = append(stopped, c.ContainerName)
 			}
-			logger.Info.Println("stopped:", strings.Join(stopped, " "))
+
+			if len(stopped) > 0 {
+				logger.Info.Println("stopped:", strings.Join(stopped, " "))
+			}
+
+			return failed.err()
 		},
 	}
 
+	stopCmd.Flags().Duration("warn", 0,
+		"Warn players with a countdown of the given length before stopping e.g. 60s.")
+
+	addSaveFlags(stopCmd)
+
 	return stopCmd
 }
+
+// warnStop runs the stop countdown on all of the servers at the same time and returns the servers for which it
+// completed. Servers which failed are added to failed.
+func warnStop(ctx context.Context, servers []*server.Server, d time.Duration, failed *serverErrors) []*server.Server {
+	errs := make([]error, len(servers))
+
+	var wg sync.WaitGroup
+
+	for i, s := range servers {
+		wg.Add(1)
+
+		go func(i int, s *server.Server) {
+			defer wg.Done()
+
+			errs[i] = s.WarnStop(ctx, d)
+		}(i, s)
+	}
+
+	wg.Wait()
+
+	warned := make([]*server.Server, 0)
+
+	for i, s := range servers {
+		if errs[i] != nil {
+			failed.add(s.ContainerName, fmt.Errorf("warning players: %w", errs[i]))
+			continue
+		}
+
+		warned = append(warned, s)
+	}
+
+	return warned
+}
@@ -3,7 +3,6 @@ package craft
 import (
 	"archive/tar"
 	"archive/zip"
-	"bufio"
 	"context"
 	"fmt"
 	"io"
@@ -18,12 +17,8 @@ import (
 
 	"github.com/danhale-git/craft/mcworld"
 
-	"github.com/danhale-git/craft/internal/logger"
-
 	"github.com/danhale-git/craft/server"
 
-	"github.com/mitchellh/go-homedir"
-
 	"github.com/danhale-git/craft/internal/backup"
 )
 
@@ -36,10 +31,37 @@ func serverFiles() []string {
 	}
 }
 
-// CopyBackup copies the server world files to the server backup directory.
-func CopyBackup(s *server.Server) (string, error) {
-	backupPath := filepath.Join(backupDirectory(), s.ContainerName)
-	fileName := fmt.Sprintf("%s_%s.zip", s.ContainerName, time.Now().Format(backup.FileNameTimeLayout))
+// CopyBackup copies the server world files to the server backup directory and returns the name of the backup file.
+// Errors are of type BackupError. The result is recorded in the server's backup stats. Failing to save the server's
+// configuration is logged and doesn't cause the backup to fail.
+func (m *Manager) CopyBackup(ctx context.Context, s *server.Server) (string, error) {
+	start := time.Now()
+
+	fileName, err := m.copyBackup(ctx, s)
+	if err == nil {
+		// Keep the saved configuration up to date so the server can be restored as it was when backed up
+		if err := m.saveConfig(ctx, s); err != nil {
+			m.logf("%s: saving server configuration: %s", s.ContainerName, err)
+		}
+	}
+
+	m.recordBackup(s.ContainerName, fileName, time.Since(start), err)
+
+	if err != nil {
+		return "", &BackupError{Name: s.ContainerName, Err: err}
+	}
+
+	return fileName, nil
+}
+
+func (m *Manager) copyBackup(ctx context.Context, s *server.Server) (string, error) {
+	backupDir, err := m.backupDirectory()
+	if err != nil {
+		return "", err
+	}
+
+	backupPath := filepath.Join(backupDir, s.ContainerName)
+	fileName := fmt.Sprintf("%s_%s%s", s.ContainerName, m.now().Format(backup.FileNameTimeLayout), backupExt)
 	backupFilePath := path.Join(backupPath, fileName)
 
 	// Create the directory if it doesn't exist
@@ -50,52 +72,36 @@ func CopyBackup(s *server.Server) (string, error) {
 		}
 	}
 
-	// Create the file
-	f, err := os.Create(backupFilePath)
-	if err != nil {
-		return "", err
-	}
+	// Saving must be resumed on every path after this point, including when ctx is cancelled
+	worldFiles, resume, err := m.saveHold(ctx, s)
+	defer resume()
 
-	// Write to server CLI
-	cmd, err := s.CommandWriter()
 	if err != nil {
 		return "", err
 	}
 
-	// Read from server CLI
-	logs, err := s.LogReader(0)
-	if err != nil {
-		return "", err
-	}
-
-	paths, err := backup.SaveHoldQuery(cmd, logs)
+	// Create the file
+	f, err := os.Create(backupFilePath)
 	if err != nil {
 		return "", err
 	}
 
-	// Prepend path from server directory to world directory
-	for i, p := range paths {
-		paths[i] = filepath.Join(files.LocalPaths.Worlds, p)
-	}
-
-	paths = append(paths, serverFiles()...)
-
 	// Copy server files and write as zip data
-	if err = copyFiles(s, f, files.Directory, paths); err != nil {
+	if err = writeBackup(ctx, s, f, worldFiles); err != nil {
 		if err := f.Close(); err != nil {
-			logger.Error.Printf("failed to close backup file after error")
+			m.logf("failed to close backup file after error")
 		}
 
 		// Clean up bad backup file
 		if err := os.Remove(backupFilePath); err != nil {
-			logger.Error.Printf("failed to remove backup file after error: %s", err)
+			m.logf("failed to remove backup file after error: %s", err)
 		}
 
 		return "", err
 	}
 
-	if err := backup.SaveResume(cmd, logs); err != nil {
-		logger.Error.Printf("error when running `save resume` (server may be in a bad state)")
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("closing backup file: %s", err)
 	}
 
 	return fileName, nil
@@ -103,9 +109,14 @@ func CopyBackup(s *server.Server) (string, error) {
 
 // ExportMCWorld copies the server's current world files to a zipped .mcworld file at the given destination which must
 // be a directory.
-func ExportMCWorld(s *server.Server, dest string) error {
+func (m *Manager) ExportMCWorld(ctx context.Context, s *server.Server, dest string) error {
 	if dest == "" {
-		dest = backupDirectory()
+		backupDir, err := m.backupDirectory()
+		if err != nil {
+			return err
+		}
+
+		dest = backupDir
 	}
 
 	dir, err := os.Stat(dest)
@@ -119,51 +130,36 @@ func ExportMCWorld(s *server.Server, dest string) error {
 		return fmt.Errorf("'%s' is not a directory", dest)
 	}
 
-	// Create the file
-	f, err := os.Create(filePath)
-	if err != nil {
-		return err
-	}
-
-	// Write to server CLI
-	cmd, err := s.CommandWriter()
-	if err != nil {
-		return err
-	}
+	// Saving must be resumed on every path after this point, including when ctx is cancelled
+	worldFiles, resume, err := m.saveHold(ctx, s)
+	defer resume()
 
-	// Read from server CLI
-	logs, err := s.LogReader(0)
 	if err != nil {
 		return err
 	}
 
-	paths, err := backup.SaveHoldQuery(cmd, logs)
+	// Create the file
+	f, err := os.Create(filePath)
 	if err != nil {
 		return err
 	}
 
-	// Prepend path from server directory to world directory
-	for i, p := range paths {
-		paths[i] = filepath.Join(strings.Split(p, "/")[1:]...)
-	}
-
-	// Copy server files and write as zip data
-	if err = copyFiles(s, f, files.FullPaths.DefaultWorld, paths); err != nil {
+	// Copy world files and write as zip data
+	if err = writeMCWorld(ctx, s, f, worldFiles); err != nil {
 		if err := f.Close(); err != nil {
-			logger.Error.Printf("failed to close backup file after error")
+			m.logf("failed to close backup file after error")
 		}
 
 		// Clean up bad backup file
-		if err := os.Remove(dest); err != nil {
-			logger.Error.Printf("failed to remove backup file after error: %s", err)
+		if err := os.Remove(filePath); err != nil {
+			m.logf("failed to remove backup file after error: %s", err)
 		}
 
 		return err
 	}
 
-	if err := backup.SaveResume(cmd, logs); err != nil {
-		logger.Error.Printf(`error when running save resume (server may be in a bad state - try running 'craft
-cmd <server> save resume')`)
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing world file: %s", err)
 	}
 
 	mcw := mcworld.MCWorld{Path: filePath}
@@ -174,70 +170,187 @@ cmd <server> save resume')`)
 	return nil
 }
 
-func copyFiles(s *server.Server, f io.Writer, containerPrefix string, paths []string) error {
-	// Write zip data to out file
+// writeBackup writes a backup of the server to f as zip data. World files are written to the worlds directory and
+// other server files are written to their path relative to the server directory. The worlds directory is copied from
+// the container once.
+func writeBackup(ctx context.Context, s *server.Server, f io.Writer, worldFiles []backup.File) error {
 	zw := zip.NewWriter(f)
 
-	for _, p := range paths {
-		containerPath := filepath.Join(containerPrefix, p)
+	entries := make(map[string]zipEntry, len(worldFiles))
 
-		data, _, err := s.CopyFromContainer(
-			context.Background(),
-			s.ContainerID,
-			containerPath,
-		)
-		if err != nil {
-			return fmt.Errorf("copying data from server at '%s': %s", containerPath, err)
+	for _, wf := range worldFiles {
+		entries[wf.Path] = zipEntry{path: path.Join(files.LocalPaths.Worlds, wf.Path), length: wf.Length}
+	}
+
+	if err := copyFiles(ctx, s, zw, files.FullPaths.Worlds, entries); err != nil {
+		return err
+	}
+
+	for _, p := range serverFiles() {
+		if err := copyServerFile(ctx, s, zw, p); err != nil {
+			return err
 		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("closing zip writer: %s", err)
+	}
+
+	return nil
+}
+
+// writeMCWorld writes the server's world to f as .mcworld zip data. World files are written relative to the world
+// directory.
+func writeMCWorld(ctx context.Context, s *server.Server, f io.Writer, worldFiles []backup.File) error {
+	zw := zip.NewWriter(f)
 
-		tr := tar.NewReader(data)
+	entries := make(map[string]zipEntry, len(worldFiles))
+
+	for _, wf := range worldFiles {
+		entries[wf.Path] = zipEntry{path: path.Join(strings.Split(wf.Path, "/")[1:]...), length: wf.Length}
+	}
+
+	if err := copyFiles(ctx, s, zw, files.FullPaths.Worlds, entries); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("closing zip writer: %s", err)
+	}
+
+	return nil
+}
+
+// zipEntry is a file to be copied from the server to a zip archive.
+type zipEntry struct {
+	path   string // Path in the zip archive
+	length int64  // Number of bytes to copy
+}
+
+// copyFiles copies the directory at dir from the container as a single tar archive and streams each file in entries
+// into the zip archive. Entries are keyed by their path relative to dir. All other files in the directory are skipped.
+func copyFiles(ctx context.Context, s *server.Server, zw *zip.Writer, dir string, entries map[string]zipEntry) error {
+	data, _, err := s.CopyFromContainer(
+		ctx,
+		s.ContainerID,
+		dir,
+	)
+	if err != nil {
+		return fmt.Errorf("copying data from server at '%s': %s", dir, err)
+	}
+	defer data.Close()
+
+	tr := tar.NewReader(data)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
 
-		err = addTarToZip(p, tr, zw)
 		if err != nil {
+			return fmt.Errorf("reading tar archive: %s", err)
+		}
+
+		// Paths in the archive begin with the name of the directory
+		split := strings.SplitN(hdr.Name, "/", 2)
+		if len(split) < 2 || !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+
+		p := split[1]
+
+		e, ok := entries[p]
+		if !ok {
+			continue
+		}
+
+		if err = addTarToZip(e.path, e.length, hdr, tr, zw); err != nil {
 			return fmt.Errorf("copying file from server to zip: %s", err)
 		}
+
+		delete(entries, p)
 	}
 
-	if err := zw.Close(); err != nil {
-		return fmt.Errorf("closing zip writer: %s", err)
+	for p := range entries {
+		return fmt.Errorf("file '%s' was not found in '%s'", p, dir)
 	}
 
 	return nil
 }
 
-func TrimBackups(name string, keep int, skip bool) ([]string, error) {
+// copyServerFile copies a file from the server directory to the same path in the zip archive.
+func copyServerFile(ctx context.Context, s *server.Server, zw *zip.Writer, p string) error {
+	containerPath := path.Join(files.Directory, p)
+
+	data, _, err := s.CopyFromContainer(
+		ctx,
+		s.ContainerID,
+		containerPath,
+	)
+	if err != nil {
+		return fmt.Errorf("copying data from server at '%s': %s", containerPath, err)
+	}
+	defer data.Close()
+
+	tr := tar.NewReader(data)
+
+	hdr, err := tr.Next()
+	if err == io.EOF {
+		return fmt.Errorf("no file was found at '%s', got EOF reading tar archive", containerPath)
+	}
+
+	if err != nil {
+		return fmt.Errorf("reading tar archive: %s", err)
+	}
+
+	if err = addTarToZip(p, hdr.Size, hdr, tr, zw); err != nil {
+		return fmt.Errorf("copying file from server to zip: %s", err)
+	}
+
+	return nil
+}
+
+// TrimBackups deletes the oldest backups of the named server, leaving the given count of newest backups in place. If
+// confirm is not nil, it is called with the names of the files to be removed and no files are removed unless it
+// returns true. The names of the deleted files are returned.
+func (m *Manager) TrimBackups(name string, keep int, confirm func(files []string) bool) ([]string, error) {
 	deleted := make([]string, 0)
 
-	backups := serverBackups(name)
+	backups, err := m.serverBackups(name)
+	if err != nil {
+		return nil, err
+	}
+
 	if keep >= len(backups) {
 		// No backups need to be deleted
 		return nil, nil
 	}
 
 	remove := backups[:len(backups)-keep]
-	d := filepath.Join(backupDirectory(), name)
 
-	// Check before removing files
-	if !skip {
-		fmt.Println()
-
-		for _, f := range remove {
-			fmt.Println(f.Name())
-		}
+	backupDir, err := m.backupDirectory()
+	if err != nil {
+		return nil, err
+	}
 
-		fmt.Print("Remove these files? (y/n): ")
+	d := filepath.Join(backupDir, name)
 
-		text, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	// Check before removing files
+	if confirm != nil {
+		names := make([]string, len(remove))
+		for i, f := range remove {
+			names[i] = f.Name()
+		}
 
-		if strings.TrimSpace(text) != "y" {
-			fmt.Println("cancelled")
+		if !confirm(names) {
 			return nil, nil
 		}
 	}
 
 	for _, f := range remove {
 		if err := os.Remove(filepath.Join(d, f.Name())); err != nil {
-			logger.Error.Printf("removing file: %s", err)
+			m.logf("removing file: %s", err)
 			continue
 		}
 
@@ -248,19 +361,21 @@ func TrimBackups(name string, keep int, skip bool) ([]string, error) {
 }
 
 // backupExists returns true if a backed up server with the given server name exists.
-func backupExists(name string) bool {
-	for _, b := range stoppedServerNames() {
-		if name == b && len(serverBackups(name)) > 0 {
-			return true
-		}
+func (m *Manager) backupExists(name string) (bool, error) {
+	backups, err := m.serverBackups(name)
+	if err != nil {
+		return false, err
 	}
 
-	return false
+	return len(backups) > 0, nil
 }
 
 // latestBackupFile returns an os.FileInfo for the most recent backup
-func latestBackupFile(name string) (os.FileInfo, error) {
-	backups := serverBackups(name)
+func (m *Manager) latestBackupFile(name string) (os.FileInfo, error) {
+	backups, err := m.serverBackups(name)
+	if err != nil {
+		return nil, err
+	}
 
 	switch len(backups) {
 	case 0:
@@ -273,31 +388,50 @@ func latestBackupFile(name string) (os.FileInfo, error) {
 }
 
 // serverBackups returns a slice of os.FileInfo with each of the backups for the named server, ordered oldest first.
-func serverBackups(server string) []os.FileInfo {
-	infos := make([]os.FileInfo, 0)
-	d := filepath.Join(backupDirectory(), server)
+func (m *Manager) serverBackups(server string) ([]os.FileInfo, error) {
+	return m.backupDirFiles(server, backupExt)
+}
 
-	err := filepath.Walk(d, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			logger.Error.Printf("Error getting backup file: %s", err)
-		}
-		infos = append(infos, info)
-		return nil
-	})
+// backupDirFiles returns the files in the named server's backup directory with the given extension and a valid
+// timestamp in their name, ordered oldest first.
+func (m *Manager) backupDirFiles(server, ext string) ([]os.FileInfo, error) {
+	backupDir, err := m.backupDirectory()
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	d := filepath.Join(backupDir, server)
+
+	infos, err := ioutil.ReadDir(d)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("reading directory '%s': %w", d, err)
 	}
 
-	return backup.SortFilesByDate(infos)
+	matching := make([]os.FileInfo, 0)
+
+	for _, f := range infos {
+		if !f.IsDir() && filepath.Ext(f.Name()) == ext {
+			matching = append(matching, f)
+		}
+	}
+
+	return backup.SortFilesByDate(matching), nil
 }
 
 // stoppedServerNames returns a slice with the names of all backed up servers.
-func stoppedServerNames() []string {
-	backupDir := backupDirectory()
-	infos, err := ioutil.ReadDir(backupDir)
+func (m *Manager) stoppedServerNames() ([]string, error) {
+	backupDir, err := m.backupDirectory()
+	if err != nil {
+		return nil, err
+	}
 
+	infos, err := ioutil.ReadDir(backupDir)
 	if err != nil {
-		logger.Panicf("reading directory '%s': %s", backupDir, err)
+		return nil, fmt.Errorf("reading directory '%s': %w", backupDir, err)
 	}
 
 	names := make([]string, 0)
@@ -310,58 +444,47 @@ func stoppedServerNames() []string {
 		names = append(names, f.Name())
 	}
 
-	return names
+	return names, nil
 }
 
-func backupDirectory() string {
-	// Find home directory.
-	home, err := homedir.Dir()
-	if err != nil {
-		logger.Error.Fatalf("getting home directory: %s", err)
+// backupDirectory returns the path to the directory where backups are stored, creating it if it doesn't exist.
+func (m *Manager) backupDirectory() (string, error) {
+	backupDir := m.BackupDir
+	if backupDir == "" {
+		return "", fmt.Errorf("no backup directory was configured")
 	}
 
-	backupDir := filepath.Join(home, files.BackupDirName)
-
 	// Create directory if it doesn't exist
 	if _, err := os.Stat(backupDir); os.IsNotExist(err) {
 		err = os.MkdirAll(backupDir, 0755)
 		if err != nil {
-			logger.Error.Fatalf("checking backup directory exists: %s", err)
+			return "", fmt.Errorf("creating backup directory: %w", err)
 		}
 	}
 
-	return backupDir
+	return backupDir, nil
 }
 
-func addTarToZip(path string, tr *tar.Reader, zw *zip.Writer) error {
-	for {
-		// Next file or end of archive
-		_, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
-
-		if err != nil {
-			logger.Error.Fatal(err)
-		}
-
-		// Read from tar archive
-		b, err := ioutil.ReadAll(tr)
-		if err != nil {
-			return err
-		}
+// addTarToZip streams the current file in the tar archive to a new file in the zip archive at the given path. Exactly
+// length bytes are written.
+func addTarToZip(path string, length int64, hdr *tar.Header, tr io.Reader, zw *zip.Writer) error {
+	if length > hdr.Size {
+		return fmt.Errorf("'%s' is %d bytes, expected at least %d", path, hdr.Size, length)
+	}
 
-		// Create file in zip archive
-		f, err := zw.Create(path)
-		if err != nil {
-			logger.Error.Fatal(err)
-		}
+	// Create file in zip archive
+	f, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     path,
+		Method:   zip.Deflate,
+		Modified: hdr.ModTime,
+	})
+	if err != nil {
+		return err
+	}
 
-		// Write file to zip archive
-		_, err = f.Write(b)
-		if err != nil {
-			logger.Error.Fatal(err)
-		}
+	// Write file to zip archive
+	if _, err = io.CopyN(f, tr, length); err != nil {
+		return fmt.Errorf("writing '%s': %s", path, err)
 	}
 
 	return nil
@@ -0,0 +1,164 @@
+package craft
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManager_TrimBackups(t *testing.T) {
+	m := &Manager{BackupDir: t.TempDir()}
+
+	names := []string{
+		"srv_10-00_01-02-2021.zip",
+		"srv_11-00_01-02-2021.zip",
+		"srv_09-00_02-02-2021.zip",
+		"srv_12-00_01-02-2021.zip",
+	}
+
+	if err := os.Mkdir(filepath.Join(m.BackupDir, "srv"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range names {
+		if err := ioutil.WriteFile(filepath.Join(m.BackupDir, "srv", n), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing is removed if the removal isn't confirmed
+	deleted, err := m.TrimBackups("srv", 2, func([]string) bool { return false })
+	if err != nil {
+		t.Fatalf("error returned for valid input: %s", err)
+	}
+
+	if len(deleted) != 0 {
+		t.Errorf("files were deleted without confirmation: %v", deleted)
+	}
+
+	deleted, err = m.TrimBackups("srv", 2, nil)
+	if err != nil {
+		t.Fatalf("error returned for valid input: %s", err)
+	}
+
+	want := []string{"srv_10-00_01-02-2021.zip", "srv_11-00_01-02-2021.zip"}
+
+	if len(deleted) != len(want) {
+		t.Fatalf("unexpected deleted files: want %v: got %v", want, deleted)
+	}
+
+	for i := range want {
+		if deleted[i] != want[i] {
+			t.Errorf("unexpected deleted file at index %d: want %s: got %s", i, want[i], deleted[i])
+		}
+	}
+
+	latest, err := m.latestBackupFile("srv")
+	if err != nil {
+		t.Fatalf("error returned for valid input: %s", err)
+	}
+
+	if latest.Name() != "srv_09-00_02-02-2021.zip" {
+		t.Errorf("unexpected latest backup after trimming: %s", latest.Name())
+	}
+}
+
+func TestAddTarToZip(t *testing.T) {
+	content := "0123456789"
+
+	tests := []struct {
+		length int64
+		want   string
+	}{
+		{length: 0, want: ""},
+		{length: 4, want: "0123"},
+		{length: 10, want: content},
+	}
+
+	for _, tt := range tests {
+		var zipData bytes.Buffer
+
+		zw := zip.NewWriter(&zipData)
+
+		tr, hdr := mockTar("file", content)
+
+		if err := addTarToZip("dir/file", tt.length, hdr, tr, zw); err != nil {
+			t.Fatalf("error returned for valid input: %s", err)
+		}
+
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		got := readZipFile(t, zipData.Bytes(), "dir/file")
+		if got != tt.want {
+			t.Errorf("unexpected file content for length %d: want '%s': got '%s'", tt.length, tt.want, got)
+		}
+	}
+
+	tr, hdr := mockTar("file", content)
+	if err := addTarToZip("file", 11, hdr, tr, zip.NewWriter(&bytes.Buffer{})); err == nil {
+		t.Error("no error returned when the length is greater than the file size")
+	}
+}
+
+// mockTar returns a tar archive containing a single file and the header of that file.
+func mockTar(name, body string) (*tar.Reader, *tar.Header) {
+	var buf bytes.Buffer
+
+	tw := tar.NewWriter(&buf)
+
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(body))}); err != nil {
+		panic(err)
+	}
+
+	if _, err := tw.Write([]byte(body)); err != nil {
+		panic(err)
+	}
+
+	if err := tw.Close(); err != nil {
+		panic(err)
+	}
+
+	tr := tar.NewReader(&buf)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		panic(err)
+	}
+
+	return tr, hdr
+}
+
+func readZipFile(t *testing.T, data []byte, name string) string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(b)
+	}
+
+	t.Fatalf("file '%s' not found in zip", name)
+
+	return ""
+}
@@ -9,9 +9,10 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"os"
+	"log"
 	"path/filepath"
 	"strings"
+	"sync"
 	"text/tabwriter"
 	"time"
 
@@ -20,8 +21,10 @@ import (
 	"github.com/danhale-git/craft/mcworld"
 
 	docker "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
 
 	"github.com/docker/docker/client"
+	"github.com/mitchellh/go-homedir"
 
 	"github.com/danhale-git/craft/internal/backup"
 	"github.com/danhale-git/craft/internal/logger"
@@ -30,90 +33,184 @@ import (
 	"github.com/danhale-git/craft/server"
 )
 
-func DockerClient() *client.Client {
+// ErrDockerUnreachable is returned when the docker daemon can't be reached.
+var ErrDockerUnreachable = errors.New("docker daemon is unreachable")
+
+// ErrBackupRunning is returned when saving can't be held for a backup because another backup of the server is running.
+var ErrBackupRunning = errors.New("another backup is running")
+
+// BackupError is returned when a backup of a server can't be taken.
+type BackupError struct {
+	Name string
+	Err  error
+}
+
+func (e *BackupError) Error() string {
+	return fmt.Sprintf("taking backup of '%s': %s", e.Name, e.Err)
+}
+
+func (e *BackupError) Unwrap() error {
+	return e.Err
+}
+
+// Is implements Is(error) to support errors.Is
+func (e *BackupError) Is(tgt error) bool {
+	_, ok := tgt.(*BackupError)
+	return ok
+}
+
+// DockerClient returns a new docker client configured from the environment.
+func DockerClient() (*client.Client, error) {
 	c, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
-		logger.Error.Fatalf("Error: Failed to create new docker client: %s", err)
+		return nil, fmt.Errorf("creating docker client: %w", err)
 	}
 
-	return c
+	return c, nil
 }
 
-// GetServerOrExit is a convenience function for attempting to find an existing docker container with the given name.
-// If not found, a helpful error message is printed and the program exits without error.
-func GetServerOrExit(containerName string) *server.Server {
-	s, err := server.Get(DockerClient(), containerName)
+// Manager runs craft servers and manages their backups. Each of its dependencies may be replaced, allowing craft to be
+// embedded in other programs and tested without docker.
+type Manager struct {
+	Client    client.CommonAPIClient // Docker client used to manage server containers
+	BackupDir string                 // Directory where server backups are stored
+	Log       *log.Logger            // Logs errors which don't cause an operation to fail, may be nil
+	Now       func() time.Time       // Returns the current time, used to name backups
+	Ports     server.PortRange       // Ports allocated to new servers, server.DefaultPortRange if zero
+
+	SaveRetries int           // Times `save query` is run while taking a backup, backup.DefaultSaveRetries if zero
+	SaveDelay   time.Duration // Delay between each `save query`, backup.DefaultSaveDelay if zero
+
+	mu      sync.Mutex
+	holding map[string]bool // Servers with saving held by a backup in this process
+}
+
+// NewManager returns a Manager which uses a docker client configured from the environment and stores backups in the
+// default directory under the user's home directory.
+func NewManager() (*Manager, error) {
+	c, err := DockerClient()
 	if err != nil {
-		// Container was not found
-		if errors.Is(err, &server.NotFoundError{}) {
-			logger.Info.Println(err)
-			os.Exit(0)
-		} else if errors.Is(err, &server.NotCraftError{}) {
-			logger.Info.Println(err)
-			os.Exit(0)
-		} else if !s.IsRunning() {
-			logger.Info.Println(err)
-			os.Exit(0)
-		}
+		return nil, err
+	}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		return nil, fmt.Errorf("getting home directory: %w", err)
+	}
+
+	return &Manager{
+		Client:    c,
+		BackupDir: filepath.Join(home, files.BackupDirName),
+		Log:       logger.Error,
+		Now:       time.Now,
+	}, nil
+}
+
+func (m *Manager) logf(format string, v ...interface{}) {
+	if m.Log != nil {
+		m.Log.Printf(format, v...)
+	}
+}
+
+func (m *Manager) saveOptions() backup.SaveOptions {
+	return backup.SaveOptions{Retries: m.SaveRetries, Delay: m.SaveDelay}
+}
 
-		// Something else went wrong
-		logger.Error.Panic(err)
+func (m *Manager) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
 	}
 
-	return s
+	return time.Now()
 }
 
-// NewServer spawns a new craft server. Only the name is required. Full path to a .mcworld file, port and a slice of
-// "property=newvalue" strings may also be provided.
-func NewServer(name string, port int, props []string, mcw mcworld.ZipOpener, useVolume bool) (*server.Server, error) {
+// GetServer returns the craft server with the given name. If no container exists with that name, an error of type
+// server.NotFoundError is returned. If the container is not a craft server, an error of type server.NotCraftError is
+// returned.
+func (m *Manager) GetServer(ctx context.Context, containerName string) (*server.Server, error) {
+	return server.Get(ctx, m.Client, containerName)
+}
+
+// NewServer spawns a new craft server. Only the name is required. Full path to a .mcworld file, container configuration
+// and a slice of "property=newvalue" strings may also be provided. The configuration is saved so that the server can be
+// started again with the same configuration after it has been stopped.
+func (m *Manager) NewServer(ctx context.Context, name string, cfg server.Config, props []string, mcw mcworld.ZipOpener) (*server.Server, error) { //nolint:lll
 	// Check the server doesn't already exist
-	if backupExists(name) {
+	exists, err := m.backupExists(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
 		return nil, fmt.Errorf("server name '%s' is in use by a backup, run 'craft list -a'", name)
 	}
 
 	// Create a container for the server
-	c, err := server.New(port, name, useVolume)
+	if cfg.Port == 0 {
+		if cfg.Port, err = m.nextPort(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := m.checkIPv6Port(ctx, name, cfg); err != nil {
+		return nil, err
+	}
+
+	c, err := server.New(ctx, m.Client, name, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("creating new container: %s", err)
+		return nil, fmt.Errorf("creating new container: %w", err)
+	}
+
+	if err := m.saveConfig(ctx, c); err != nil {
+		return nil, m.stopAfterError(c, err)
 	}
 
 	// Copy world files to the server
 	if mcw != nil {
 		zr, err := mcw.Open()
 		if err != nil {
-			c.StopOrPanic()
-			return nil, fmt.Errorf("inavlid world file: %s", err)
+			return nil, m.stopAfterError(c, fmt.Errorf("inavlid world file: %w", err))
 		}
 
-		if err = backup.RestoreMCWorld(&zr.Reader, c.ContainerID, DockerClient()); err != nil {
-			c.StopOrPanic()
-			return nil, fmt.Errorf("restoring backup: %s", err)
+		if err = backup.RestoreMCWorld(ctx, &zr.Reader, c.ContainerID, c.ContainerAPIClient); err != nil {
+			_ = zr.Close()
+			return nil, m.stopAfterError(c, fmt.Errorf("restoring backup: %w", err))
 		}
 
 		if err = zr.Close(); err != nil {
-			logger.Panic(err)
+			return nil, m.stopAfterError(c, fmt.Errorf("closing world file: %w", err))
 		}
 	}
 
-	// Set the properties
-	if err := SetServerProperties(props, c); err != nil {
+	// Set the properties, those given override any required by the configuration
+	props = append(cfg.Properties(), props...)
+
+	if err := m.SetServerProperties(ctx, props, c); err != nil {
 		return nil, fmt.Errorf("setting server properties: %s", err)
 	}
 
 	return c, nil
 }
 
-// StartServer sorts all available backup files by date and starts a server from the latest backup.
-func StartServer(name string, port int) (*server.Server, error) {
-	s, err := server.Get(DockerClient(), name)
+// StartServer starts a stopped server. If the server's container no longer exists, a new container is created with the
+// saved configuration updated by override (see server.Config.Update) and the latest backup is restored to it. If the
+// container exists, only the resource limits in override are applied and the port is ignored. Other settings can't be
+// changed while the container exists. Overridden settings are saved for future starts.
+func (m *Manager) StartServer(ctx context.Context, name string, override server.Config) (*server.Server, error) {
+	s, err := m.GetServer(ctx, name)
 
 	if err != nil {
 		if errors.Is(err, &server.NotFoundError{}) {
-			if !backupExists(name) {
+			exists, err := m.backupExists(name)
+			if err != nil {
+				return nil, err
+			}
+
+			if !exists {
 				return nil, fmt.Errorf("stopped server with name '%s' doesn't exist", name)
 			}
 
-			s, err = startServerFromBackup(name, port)
+			s, err = m.startServerFromBackup(ctx, name, override)
 			if err != nil {
 				return nil, fmt.Errorf("starting server from backup: %w", err)
 			}
@@ -124,12 +221,31 @@ func StartServer(name string, port int) (*server.Server, error) {
 		}
 	}
 
-	if s.IsRunning() {
+	running, err := s.IsRunning(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if running {
 		return nil, fmt.Errorf("server '%s' is already running (run 'craft list')", name)
 	}
 
+	if o := override; o.IPv6Port != 0 || o.BindIP != "" || o.Network != "" || o.Image != "" || len(o.Tags) > 0 {
+		return nil, fmt.Errorf("the container of server '%s' still exists, only its resource limits can be changed", name)
+	}
+
+	if res := override.Resources; res != (server.Resources{}) {
+		if err := s.UpdateResources(ctx, res); err != nil {
+			return nil, err
+		}
+
+		if err := m.saveConfig(ctx, s); err != nil {
+			return nil, err
+		}
+	}
+
 	err = s.ContainerStart(
-		context.Background(),
+		ctx,
 		s.ContainerID,
 		docker.ContainerStartOptions{},
 	)
@@ -140,43 +256,214 @@ func StartServer(name string, port int) (*server.Server, error) {
 	return s, nil
 }
 
-func startServerFromBackup(name string, port int) (*server.Server, error) {
-	s, err := server.New(port, name, false)
+// RestartServer stops the server and starts it again on the same port, returning once the server process has started.
+// Servers without a volume are backed up and then recreated from the new backup. If backup is true, servers with a
+// volume are also backed up. If the backup fails the server is not stopped.
+func (m *Manager) RestartServer(ctx context.Context, s *server.Server, backup bool) (*server.Server, error) {
+	port, err := s.Port(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("%s: running server: %s", name, err)
+		return nil, err
 	}
 
-	f, err := latestBackupFile(name)
+	hasVolume, err := s.HasVolume(ctx)
 	if err != nil {
-		s.StopOrPanic()
 		return nil, err
 	}
 
-	backupPath := filepath.Join(backupDirectory(), s.ContainerName)
+	if backup || !hasVolume {
+		if _, err := m.CopyBackup(ctx, s); err != nil {
+			return nil, err
+		}
+	}
 
-	// Open backup zip
-	zr, err := zip.OpenReader(filepath.Join(backupPath, f.Name()))
+	var removed <-chan container.ContainerWaitOKBody
+
+	var waitErr <-chan error
+
+	if !hasVolume {
+		// The container is removed after it stops, it must be gone before it can be recreated
+		removed, waitErr = s.ContainerWait(ctx, s.ContainerID, container.WaitConditionRemoved)
+	}
+
+	if err := m.StopServer(ctx, s); err != nil {
+		if !errors.Is(err, server.ErrUncleanShutdown) {
+			return nil, err
+		}
+
+		// The container has stopped, it's better to start it again than to leave it stopped
+		m.logf("%s: %s", s.ContainerName, err)
+	}
+
+	if !hasVolume {
+		select {
+		case <-removed:
+		case err := <-waitErr:
+			return nil, fmt.Errorf("waiting for container to be removed: %w", err)
+		}
+	}
+
+	s, err = m.StartServer(ctx, s.ContainerName, server.Config{Port: port})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.RunBedrock(ctx); err != nil {
+		return nil, fmt.Errorf("starting server process: %w", err)
+	}
+
+	return s, nil
+}
+
+func (m *Manager) startServerFromBackup(ctx context.Context, name string, override server.Config) (*server.Server, error) { //nolint:lll
+	cfg, err := m.savedConfig(name)
 	if err != nil {
-		s.StopOrPanic()
 		return nil, err
 	}
 
-	if err = backup.Restore(&zr.Reader, s.ContainerID, DockerClient()); err != nil {
-		s.StopOrPanic()
+	cfg = cfg.Update(override)
+
+	if cfg.Port == 0 {
+		if cfg.Port, err = m.nextPort(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := m.checkIPv6Port(ctx, name, cfg); err != nil {
 		return nil, err
 	}
 
+	s, err := server.New(ctx, m.Client, name, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: running server: %s", name, err)
+	}
+
+	f, err := m.latestBackupFile(name)
+	if err != nil {
+		return nil, m.stopAfterError(s, err)
+	}
+
+	backupDir, err := m.backupDirectory()
+	if err != nil {
+		return nil, m.stopAfterError(s, err)
+	}
+
+	backupPath := filepath.Join(backupDir, s.ContainerName)
+
+	// Open backup zip
+	zr, err := zip.OpenReader(filepath.Join(backupPath, f.Name()))
+	if err != nil {
+		return nil, m.stopAfterError(s, err)
+	}
+
+	if err = backup.Restore(ctx, &zr.Reader, s.ContainerID, s.ContainerAPIClient); err != nil {
+		_ = zr.Close()
+		return nil, m.stopAfterError(s, err)
+	}
+
 	if err = zr.Close(); err != nil {
-		s.StopOrPanic()
-		return nil, fmt.Errorf("closing zip: %s", err)
+		return nil, m.stopAfterError(s, fmt.Errorf("closing zip: %w", err))
+	}
+
+	// The port may have changed since the backup was taken
+	if err := m.SetServerProperties(ctx, cfg.Properties(), s); err != nil {
+		return nil, m.stopAfterError(s, fmt.Errorf("setting server properties: %w", err))
+	}
+
+	// Keep overridden settings for future starts
+	if err := m.saveConfig(ctx, s); err != nil {
+		m.logf("%s: saving server configuration: %s", name, err)
 	}
 
 	return s, nil
 }
 
+// nextPort returns the next available port for the named server. Ports saved by other stopped servers are reserved
+// so that those servers can start again on the same ports.
+func (m *Manager) nextPort(ctx context.Context, name string) (int, error) {
+	r := m.Ports
+	if r == (server.PortRange{}) {
+		r = server.DefaultPortRange
+	}
+
+	reserved, err := m.reservedPorts(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return server.NextAvailablePort(ctx, m.Client, r, reserved)
+}
+
+// checkIPv6Port returns an error wrapping server.ErrPortUnavailable if the IPv6 port of the named server's
+// configuration is in use by another server or on the host, or is reserved by a stopped server.
+func (m *Manager) checkIPv6Port(ctx context.Context, name string, cfg server.Config) error {
+	if cfg.IPv6Port == 0 {
+		return nil
+	}
+
+	reserved, err := m.reservedPorts(name)
+	if err != nil {
+		return err
+	}
+
+	if err := server.CheckPortAvailable(ctx, m.Client, cfg.IPv6Port, reserved); err != nil {
+		return fmt.Errorf("IPv6 port: %w", err)
+	}
+
+	return nil
+}
+
+// reservedPorts returns the ports saved by stopped servers other than the named server, which they will bind again
+// when they start.
+func (m *Manager) reservedPorts(name string) ([]int, error) {
+	names, err := m.stoppedServerNames()
+	if err != nil {
+		return nil, err
+	}
+
+	reserved := make([]int, 0)
+
+	for _, n := range names {
+		if n == name {
+			continue
+		}
+
+		// Only servers with a backup can be started again
+		exists, err := m.backupExists(n)
+		if err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			continue
+		}
+
+		cfg, err := m.savedConfig(n)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range []int{cfg.Port, cfg.IPv6Port} {
+			if p != 0 {
+				reserved = append(reserved, p)
+			}
+		}
+	}
+
+	return reserved, nil
+}
+
+// stopAfterError cleans up a server which failed to start by stopping its container, then returns err.
+func (m *Manager) stopAfterError(s *server.Server, err error) error {
+	if stopErr := s.StopContainer(context.Background()); stopErr != nil {
+		m.logf("failed to stop %s after error: %s", s.ContainerName, stopErr)
+	}
+
+	return err
+}
+
 // SetServerProperties takes a slice of key=value strings and applies them to the server.properties configuration
 // file. If a key is missing, an error will be returned and no changes will be made.
-func SetServerProperties(propFlags []string, s *server.Server) error {
+func (m *Manager) SetServerProperties(ctx context.Context, propFlags []string, s *server.Server) error {
 	if len(propFlags) > 0 {
 		k := make([]string, len(propFlags))
 		v := make([]string, len(propFlags))
@@ -194,7 +481,7 @@ func SetServerProperties(propFlags []string, s *server.Server) error {
 		containerPath := files.FullPaths.ServerProperties
 
 		data, _, err := s.CopyFromContainer(
-			context.Background(),
+			ctx,
 			s.ContainerID,
 			containerPath,
 		)
@@ -239,11 +526,11 @@ func SetServerProperties(propFlags []string, s *server.Server) error {
 		}
 
 		err = s.CopyToContainer(
-			context.Background(),
+			ctx,
 			s.ContainerID,
 			filepath.Dir(containerPath),
 			&buf,
-			docker.CopyToContainerOptions{},
+			docker.CopyToContainerOptions{CopyUIDGID: true},
 		)
 		if err != nil {
 			return fmt.Errorf("copying files to '%s': %s", filepath.Dir(containerPath), err)
@@ -255,99 +542,73 @@ func SetServerProperties(propFlags []string, s *server.Server) error {
 
 // PrintServers prints a list of servers. If all is true then stopped servers will be printed. Running servers show the
 // port players should connect on and stopped servers show the date and time at which they were stopped.
-func PrintServers(all bool) error {
-	w := tabwriter.NewWriter(os.Stdout, 3, 3, 3, ' ', tabwriter.TabIndent)
-
-	stoppedContainers := make([]*server.Server, 0)
-
-	servers, err := server.All(DockerClient())
+func (m *Manager) PrintServers(ctx context.Context, out io.Writer, all bool) error {
+	servers, err := m.Servers(ctx, all)
 	if err != nil {
-		return fmt.Errorf("getting server clients: %s", err)
+		return err
 	}
 
+	return WriteServerTable(out, servers)
+}
+
+// WriteServerTable writes a table of servers in the format printed by PrintServers. Running servers are listed first,
+// followed by stopped servers without volumes and then stopped servers with volumes.
+func WriteServerTable(out io.Writer, servers []ServerInfo) error {
+	const layout = "02 Jan 2006 3:04PM"
+
+	w := tabwriter.NewWriter(out, 3, 3, 3, ' ', tabwriter.TabIndent)
+
 	// Print running servers
 	for _, s := range servers {
-		s, err := server.Get(DockerClient(), s.ContainerName)
-		if err != nil {
-			return fmt.Errorf("creating docker client: %s", err)
-		}
-		if !s.IsRunning() {
-			stoppedContainers = append(stoppedContainers, s)
+		if s.State != StateRunning {
 			continue
 		}
 
-		port, err := s.Port()
-		if err != nil {
-			return fmt.Errorf("getting port for container '%s': '%s'", s.ContainerName, err)
-		}
-
-		if _, err := fmt.Fprintf(w, "%s\trunning - port %d\n", s.ContainerName, port); err != nil {
+		if _, err := fmt.Fprintf(w, "%s\trunning - port %d\n", s.Name, s.Port); err != nil {
 			return fmt.Errorf("writing to table: %s", err)
 		}
 	}
 
-	if !all {
-		if err = w.Flush(); err != nil {
-			return fmt.Errorf("writing output to console: %s", err)
-		}
-
-		return nil
-	}
-
 	// Print stopped servers without mounted volumes
-	for _, n := range stoppedServerNames() {
-		if func() bool { // if n is an active server
-			for _, s := range servers {
-				if s.ContainerName == n {
-					return true
-				}
-			}
-			return false
-		}() {
+	for _, s := range servers {
+		if s.State != StateStopped || s.Volume {
 			continue
 		}
 
-		f, err := latestBackupFile(n)
-		if err != nil {
-			continue
-		}
+		stopped := "stopped"
 
-		t, err := backup.FileTime(f.Name())
-		if err != nil {
-			panic(err)
+		if s.LastBackup != "" {
+			t, err := time.Parse(time.RFC3339, s.LastBackup)
+			if err != nil {
+				return fmt.Errorf("reading time of last backup for '%s': %w", s.Name, err)
+			}
+
+			stopped = fmt.Sprintf("stopped - %s", t.Format(layout))
 		}
 
-		if _, err := fmt.Fprintf(w, "%s\tstopped - %s\n", n, t.Format("02 Jan 2006 3:04PM")); err != nil {
-			logger.Error.Fatalf("Error writing to table: %s", err)
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", s.Name, stopped); err != nil {
+			return fmt.Errorf("writing to table: %w", err)
 		}
 	}
 
 	// Print stopped servers with mounted volumes
-	for _, s := range stoppedContainers {
-		inspect, err := s.ContainerInspect(context.Background(), s.ContainerID)
-		if err != nil {
-			return err
-		}
-
-		layout := "2006-01-02T15:04:05"
-
-		t, err := time.Parse(layout, strings.Split(inspect.State.FinishedAt, ".")[0])
-		if err != nil {
-			return fmt.Errorf("failed to pass stopped time for server '%s': %w", s.ContainerName, err)
+	for _, s := range servers {
+		if s.State != StateStopped || !s.Volume {
+			continue
 		}
 
-		p, err := s.Port()
+		t, err := time.Parse(time.RFC3339, s.StoppedAt)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to pass stopped time for server '%s': %w", s.Name, err)
 		}
 
-		if _, err := fmt.Fprintf(w, "%s\tstopped (volume) - port %d - %s\n", s.ContainerName, p, t.Format("02 Jan 2006 3:04PM")); err != nil {
-			logger.Error.Fatalf("Error writing to table: %s", err)
+		if _, err := fmt.Fprintf(w, "%s\tstopped (volume) - port %d - %s\n", s.Name, s.Port, t.Local().Format(layout)); err != nil { //nolint:lll
+			return fmt.Errorf("writing to table: %w", err)
 		}
 	}
 
-	if err = w.Flush(); err != nil {
-		logger.Error.Fatalf("Error writing output to console: %s", err)
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("writing output to console: %w", err)
 	}
 
 	return nil
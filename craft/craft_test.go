@@ -0,0 +1,959 @@
+package craft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danhale-git/craft/internal/backup"
+	"github.com/danhale-git/craft/internal/files"
+	"github.com/danhale-git/craft/internal/mock"
+	"github.com/danhale-git/craft/mcworld"
+	"github.com/danhale-git/craft/server"
+)
+
+func newTestManager(t *testing.T) (*Manager, *mock.Docker) {
+	d := mock.NewDocker(server.ImageName)
+
+	return &Manager{
+		Client:    d,
+		BackupDir: t.TempDir(),
+		Now: func() time.Time {
+			return time.Date(2021, 2, 1, 10, 0, 0, 0, time.UTC)
+		},
+	}, d
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	return ctx
+}
+
+// runTestServer creates and runs a new server, failing the test if it doesn't start.
+func runTestServer(ctx context.Context, t *testing.T, m *Manager, name string, props []string, useVolume bool) *server.Server { //nolint:lll
+	s, err := m.NewServer(ctx, name, server.Config{Volume: useVolume}, props, nil)
+	if err != nil {
+		t.Fatalf("error creating server: %s", err)
+	}
+
+	if err = s.RunBedrock(ctx); err != nil {
+		t.Fatalf("error running server: %s", err)
+	}
+
+	return s
+}
+
+func TestManager_RunBackupStopStart(t *testing.T) {
+	ctx := testContext(t)
+	m, d := newTestManager(t)
+	d.SaveQueryRetries = 2
+
+	s := runTestServer(ctx, t, m, "srv", []string{"difficulty=hard"}, false)
+
+	port, err := s.Port(ctx)
+	if err != nil {
+		t.Fatalf("error getting port: %s", err)
+	}
+
+	if port != 19132 {
+		t.Errorf("unexpected port: want 19132: got %d", port)
+	}
+
+	fileName, err := m.CopyBackup(ctx, s)
+	if err != nil {
+		t.Fatalf("error taking backup: %s", err)
+	}
+
+	if want := "srv_10-00_01-02-2021.zip"; fileName != want {
+		t.Errorf("unexpected backup file name: want %s: got %s", want, fileName)
+	}
+
+	if b, _ := d.Container("srv"); b.Held() {
+		t.Errorf("saving was not resumed after taking a backup")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(m.BackupDir, "srv", fileName))
+	if err != nil {
+		t.Fatalf("reading backup file: %s", err)
+	}
+
+	// The log file is appended to after the save query, the backup should contain the queried length only
+	if got := readZipFile(t, data, "worlds/Bedrock level/db/000003.log"); got != "log" {
+		t.Errorf("unexpected db log file content in backup: want 'log': got '%s'", got)
+	}
+
+	if got := readZipFile(t, data, "server.properties"); !strings.Contains(got, "difficulty=hard") {
+		t.Errorf("server.properties in backup does not contain the property set when the server was created")
+	}
+
+	if err = s.Stop(ctx); err != nil {
+		t.Fatalf("error stopping server: %s", err)
+	}
+
+	if _, err = m.GetServer(ctx, "srv"); !errors.Is(err, &server.NotFoundError{}) {
+		t.Fatalf("unexpected error getting server without a volume after stopping: want NotFoundError: got %v", err)
+	}
+
+	s, err = m.StartServer(ctx, "srv", server.Config{})
+	if err != nil {
+		t.Fatalf("error starting server from backup: %s", err)
+	}
+
+	if err = s.RunBedrock(ctx); err != nil {
+		t.Fatalf("error running server: %s", err)
+	}
+
+	props, err := d.ReadFile("srv", files.FullPaths.ServerProperties)
+	if err != nil {
+		t.Fatalf("reading server.properties: %s", err)
+	}
+
+	if !strings.Contains(string(props), "difficulty=hard") {
+		t.Errorf("server.properties was not restored from the backup")
+	}
+
+	db, err := d.ReadFile("srv", path.Join(files.FullPaths.DefaultWorld, "db", "000003.log"))
+	if err != nil {
+		t.Fatalf("reading world file: %s", err)
+	}
+
+	if string(db) != "log" {
+		t.Errorf("unexpected world file content after restoring: want 'log': got '%s'", db)
+	}
+}
+
+func TestManager_StopStartVolume(t *testing.T) {
+	ctx := testContext(t)
+	m, _ := newTestManager(t)
+
+	s := runTestServer(ctx, t, m, "srv", nil, true)
+
+	hasVolume, err := s.HasVolume(ctx)
+	if err != nil {
+		t.Fatalf("error checking for volume: %s", err)
+	}
+
+	if !hasVolume {
+		t.Fatalf("server created with a volume reports no volume")
+	}
+
+	if err = s.Stop(ctx); err != nil {
+		t.Fatalf("error stopping server: %s", err)
+	}
+
+	running, err := s.IsRunning(ctx)
+	if err != nil {
+		t.Fatalf("error checking server status: %s", err)
+	}
+
+	if running {
+		t.Errorf("server is running after being stopped")
+	}
+
+	var buf bytes.Buffer
+	if err = m.PrintServers(ctx, &buf, true); err != nil {
+		t.Fatalf("error printing servers: %s", err)
+	}
+
+	if !strings.Contains(buf.String(), "stopped (volume) - port 19132") {
+		t.Errorf("stopped server with volume is not listed: got '%s'", buf.String())
+	}
+
+	if _, err = m.StartServer(ctx, "srv", server.Config{}); err != nil {
+		t.Fatalf("error starting server: %s", err)
+	}
+
+	if err = s.RunBedrock(ctx); err != nil {
+		t.Fatalf("error running server: %s", err)
+	}
+
+	buf.Reset()
+	if err = m.PrintServers(ctx, &buf, false); err != nil {
+		t.Fatalf("error printing servers: %s", err)
+	}
+
+	if !strings.Contains(buf.String(), "running - port 19132") {
+		t.Errorf("running server is not listed: got '%s'", buf.String())
+	}
+}
+
+func TestManager_ExportMCWorld(t *testing.T) {
+	ctx := testContext(t)
+	m, _ := newTestManager(t)
+
+	s := runTestServer(ctx, t, m, "srv", nil, true)
+
+	dest := t.TempDir()
+
+	if err := m.ExportMCWorld(ctx, s, dest); err != nil {
+		t.Fatalf("error exporting world: %s", err)
+	}
+
+	mcw := mcworld.MCWorld{Path: filepath.Join(dest, "srv.mcworld")}
+	if err := mcw.Check(); err != nil {
+		t.Fatalf("exported world is invalid: %s", err)
+	}
+
+	// The exported world can be used to create a new server
+	if _, err := m.NewServer(ctx, "imported", server.Config{}, nil, mcw); err != nil {
+		t.Fatalf("error creating server from exported world: %s", err)
+	}
+}
+
+func TestManager_NewServer_Ports(t *testing.T) {
+	ctx := testContext(t)
+	m, _ := newTestManager(t)
+
+	for i, name := range []string{"a", "b", "c"} {
+		s := runTestServer(ctx, t, m, name, nil, false)
+
+		port, err := s.Port(ctx)
+		if err != nil {
+			t.Fatalf("error getting port: %s", err)
+		}
+
+		if want := 19132 + i; port != want {
+			t.Errorf("unexpected port for server %s: want %d: got %d", name, want, port)
+		}
+	}
+
+	if _, err := m.NewServer(ctx, "a", server.Config{}, nil, nil); err == nil {
+		t.Errorf("no error creating a server with a name which is in use")
+	}
+
+	if err := os.MkdirAll(filepath.Join(m.BackupDir, "d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(m.BackupDir, "d", "d_10-00_01-02-2021.zip"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.NewServer(ctx, "d", server.Config{}, nil, nil); err == nil {
+		t.Errorf("no error creating a server with a name which is used by a backup")
+	}
+}
+
+func TestManager_Servers(t *testing.T) {
+	ctx := testContext(t)
+	m, _ := newTestManager(t)
+
+	running := runTestServer(ctx, t, m, "running", nil, true)
+	if _, err := m.CopyBackup(ctx, running); err != nil {
+		t.Fatalf("error taking backup: %s", err)
+	}
+
+	backedUp := runTestServer(ctx, t, m, "backedup", nil, false)
+	if _, err := m.CopyBackup(ctx, backedUp); err != nil {
+		t.Fatalf("error taking backup: %s", err)
+	}
+
+	if err := backedUp.Stop(ctx); err != nil {
+		t.Fatalf("error stopping server: %s", err)
+	}
+
+	infos, err := m.Servers(ctx, false)
+	if err != nil {
+		t.Fatalf("error getting servers: %s", err)
+	}
+
+	if len(infos) != 1 || infos[0].Name != "running" {
+		t.Fatalf("unexpected running servers: want [running]: got %+v", infos)
+	}
+
+	infos, err = m.Servers(ctx, true)
+	if err != nil {
+		t.Fatalf("error getting servers: %s", err)
+	}
+
+	if len(infos) != 2 {
+		t.Fatalf("unexpected server count: want 2: got %d", len(infos))
+	}
+
+	wantTime := time.Date(2021, 2, 1, 10, 0, 0, 0, time.Local).Format(time.RFC3339)
+
+	got := infos[0]
+	if got.Name != "backedup" || got.State != StateStopped || got.Port != 0 || got.Volume || got.BackupCount != 1 ||
+		got.LastBackup != wantTime || got.BackupSize == 0 || got.LastBackupSize != got.BackupSize {
+		t.Errorf("unexpected info for stopped server: %+v", got)
+	}
+
+	got = infos[1]
+	if got.Name != "running" || got.State != StateRunning || got.Port != 19132 || !got.Volume || got.BackupCount != 1 {
+		t.Errorf("unexpected info for running server: %+v", got)
+	}
+
+	backups, err := m.Backups("backedup")
+	if err != nil {
+		t.Fatalf("error getting backups: %s", err)
+	}
+
+	if len(backups) != 1 || backups[0].File != "backedup_10-00_01-02-2021.zip" || backups[0].Time != wantTime {
+		t.Errorf("unexpected backups: %+v", backups)
+	}
+}
+
+func TestManager_RestartServer(t *testing.T) {
+	ctx := testContext(t)
+	m, _ := newTestManager(t)
+
+	for _, useVolume := range []bool{false, true} {
+		name := fmt.Sprintf("volume-%t", useVolume)
+
+		s, err := m.NewServer(ctx, name, server.Config{Port: 19140, Volume: useVolume}, nil, nil)
+		if err != nil {
+			t.Fatalf("error creating server: %s", err)
+		}
+
+		if err = s.RunBedrock(ctx); err != nil {
+			t.Fatalf("error running server: %s", err)
+		}
+
+		restarted, err := m.RestartServer(ctx, s, false)
+		if err != nil {
+			t.Fatalf("%s: error restarting server: %s", name, err)
+		}
+
+		port, err := restarted.Port(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if port != 19140 {
+			t.Errorf("%s: unexpected port after restarting: want 19140: got %d", name, port)
+		}
+
+		running, err := restarted.IsRunning(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !running {
+			t.Errorf("%s: server is not running after restarting", name)
+		}
+
+		backups, err := m.Backups(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := map[bool]int{false: 1, true: 0}[useVolume]; len(backups) != want {
+			t.Errorf("%s: unexpected backup count: want %d: got %d", name, want, len(backups))
+		}
+
+		if err = restarted.Stop(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestManager_StartServer_SavedConfig(t *testing.T) {
+	ctx := testContext(t)
+	m, d := newTestManager(t)
+	d.Images = append(d.Images, "custom:latest")
+
+	cfg := server.Config{Port: 19150, Image: "custom:latest", Tags: map[string]string{"owner": "me"}}
+
+	s, err := m.NewServer(ctx, "srv", cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating server: %s", err)
+	}
+
+	if err = s.RunBedrock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = m.CopyBackup(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another server is created while srv is stopped
+	runTestServer(ctx, t, m, "other", nil, false)
+
+	s, err = m.StartServer(ctx, "srv", server.Config{})
+	if err != nil {
+		t.Fatalf("error starting server: %s", err)
+	}
+
+	if err = s.RunBedrock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Config(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Port != cfg.Port || got.Image != cfg.Image || got.Volume || got.Tags["owner"] != "me" {
+		t.Errorf("unexpected configuration after starting: want %+v: got %+v", cfg, got)
+	}
+
+	if err = s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The port flag overrides the saved port
+	s, err = m.StartServer(ctx, "srv", server.Config{Port: 19160})
+	if err != nil {
+		t.Fatalf("error starting server: %s", err)
+	}
+
+	if port, err := s.Port(ctx); err != nil || port != 19160 {
+		t.Errorf("unexpected port when overridden: want 19160: got %d (%v)", port, err)
+	}
+
+	if err = s.RunBedrock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flags override the other saved settings
+	override := server.Config{
+		IPv6Port: 19161, BindIP: "192.168.1.10", Network: "mynetwork", Image: server.ImageName,
+		Tags: map[string]string{"env": "test"},
+	}
+
+	if s, err = m.StartServer(ctx, "srv", override); err != nil {
+		t.Fatalf("error starting server: %s", err)
+	}
+
+	if got, err = s.Config(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := server.Config{
+		Port: 19160, IPv6Port: 19161, BindIP: "192.168.1.10", Network: "mynetwork", Image: server.ImageName,
+		Tags: map[string]string{"owner": "me", "env": "test"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected configuration after overriding: want %+v: got %+v", want, got)
+	}
+}
+
+func TestManager_NewServer_ReservedPort(t *testing.T) {
+	ctx := testContext(t)
+	m, _ := newTestManager(t)
+	m.Ports = server.PortRange{Min: 19170, Max: 19171}
+
+	s := runTestServer(ctx, t, m, "stopped", nil, false)
+	if _, err := m.CopyBackup(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stopped server's port is not reused
+	s = runTestServer(ctx, t, m, "new", nil, false)
+
+	if port, err := s.Port(ctx); err != nil || port != 19171 {
+		t.Errorf("unexpected port: want 19171: got %d (%v)", port, err)
+	}
+
+	if _, err := m.NewServer(ctx, "full", server.Config{}, nil, nil); !errors.Is(err, server.ErrNoAvailablePort) {
+		t.Errorf("unexpected error when the port range is full: want ErrNoAvailablePort: got %v", err)
+	}
+}
+
+func TestManager_NewServer_IPv6PortUnavailable(t *testing.T) {
+	ctx := testContext(t)
+	m, _ := newTestManager(t)
+
+	s, err := m.NewServer(ctx, "stopped", server.Config{Port: 19190, IPv6Port: 19191}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.RunBedrock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = m.CopyBackup(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	runTestServer(ctx, t, m, "running", nil, false)
+
+	cases := map[string]server.Config{
+		"same as port":         {Port: 19192, IPv6Port: 19192},
+		"bound by a container": {Port: 19192, IPv6Port: 19132},
+		"reserved":             {Port: 19192, IPv6Port: 19191},
+	}
+
+	for name, cfg := range cases {
+		if _, err := m.NewServer(ctx, "new", cfg, nil, nil); !errors.Is(err, server.ErrPortUnavailable) {
+			t.Errorf("%s: unexpected error: want ErrPortUnavailable: got %v", name, err)
+		}
+	}
+
+	// The stopped server can use its own IPv6 port
+	if _, err := m.StartServer(ctx, "stopped", server.Config{}); err != nil {
+		t.Errorf("unexpected error starting a server with its saved IPv6 port: %s", err)
+	}
+}
+
+func TestManager_NewServer_HostNetwork(t *testing.T) {
+	ctx := testContext(t)
+	m, d := newTestManager(t)
+
+	cfg := server.Config{Port: 19180, IPv6Port: 19181, Network: server.HostNetwork}
+
+	s, err := m.NewServer(ctx, "host", cfg, []string{"enable-lan-visibility=false"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := d.ReadFile(s.ContainerName, files.FullPaths.ServerProperties)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"server-port=19180", "server-portv6=19181", "enable-lan-visibility=false"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("server.properties doesn't contain '%s':\n%s", want, b)
+		}
+	}
+
+	saved, err := m.savedConfig("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if saved.Network != server.HostNetwork || saved.Port != 19180 || saved.IPv6Port != 19181 {
+		t.Errorf("unexpected saved config: %+v", saved)
+	}
+}
+
+func TestManager_StartServer_Resources(t *testing.T) {
+	ctx := testContext(t)
+	m, _ := newTestManager(t)
+
+	cfg := server.Config{Resources: server.Resources{Memory: 1 << 30, PidsLimit: 100}}
+
+	s, err := m.NewServer(ctx, "srv", cfg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.RunBedrock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = m.CopyBackup(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Recreated from the backup, the memory limit is replaced and the pids limit is kept
+	s, err = m.StartServer(ctx, "srv", server.Config{Resources: server.Resources{Memory: 2 << 30}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Config(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := server.Resources{Memory: 2 << 30, PidsLimit: 100}
+	if got.Resources != want {
+		t.Errorf("unexpected resources: want %+v: got %+v", want, got.Resources)
+	}
+
+	if got.User != "" || got.Unconfined {
+		t.Errorf("server is not running with the default security options: %+v", got)
+	}
+}
+
+func TestManager_StopServer_ArchivesLogs(t *testing.T) {
+	ctx := testContext(t)
+	m, _ := newTestManager(t)
+
+	s := runTestServer(ctx, t, m, "srv", nil, false)
+	if _, err := m.CopyBackup(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.StopServer(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+
+	logs, err := m.LogArchives("srv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(logs) != 1 || logs[0].File != "srv_10-00_01-02-2021.log" {
+		t.Fatalf("unexpected log archives: %+v", logs)
+	}
+
+	// Log archives are not backups
+	if backups, err := m.Backups("srv"); err != nil || len(backups) != 1 {
+		t.Errorf("unexpected backups: want 1: got %d (%v)", len(backups), err)
+	}
+
+	f, err := m.OpenLogArchive("srv", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"Server started.", "Quit correctly"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("archived log doesn't contain '%s':\n%s", want, b)
+		}
+	}
+
+	if _, err := m.OpenLogArchive("srv", "../manifest.json"); err == nil {
+		t.Errorf("no error returned opening a file which is not a log archive")
+	}
+}
+
+func TestManager_CopyBackup_SaveRetries(t *testing.T) {
+	ctx := testContext(t)
+	m, d := newTestManager(t)
+	d.SaveQueryRetries = 3
+	m.SaveRetries, m.SaveDelay = 2, time.Millisecond
+
+	s := runTestServer(ctx, t, m, "srv", nil, true)
+
+	if _, err := m.CopyBackup(ctx, s); !errors.Is(err, backup.ErrSaveHoldTimeout) {
+		t.Errorf("unexpected error: want %s: got %v", backup.ErrSaveHoldTimeout, err)
+	}
+
+	if b, _ := d.Container("srv"); b.Held() {
+		t.Errorf("saving was not resumed after the backup failed")
+	}
+
+	if backups, _ := m.Backups("srv"); len(backups) > 0 {
+		t.Errorf("backup file was not removed after the backup failed: %v", backups)
+	}
+
+	m.SaveRetries = 5
+
+	if _, err := m.CopyBackup(ctx, s); err != nil {
+		t.Errorf("error returned when the save query retries were not exceeded: %s", err)
+	}
+}
+
+func TestManager_BackupStats(t *testing.T) {
+	ctx := testContext(t)
+	m, d := newTestManager(t)
+	m.SaveRetries, m.SaveDelay = 1, time.Millisecond
+
+	s := runTestServer(ctx, t, m, "srv", nil, true)
+
+	stats, err := m.BackupStats("srv")
+	if err != nil || stats != (BackupStats{Server: "srv"}) {
+		t.Errorf("unexpected stats before any backups: %+v, %v", stats, err)
+	}
+
+	d.SaveQueryRetries = 3
+
+	if _, err := m.CopyBackup(ctx, s); err == nil {
+		t.Fatal("no error returned when the save query retries were exceeded")
+	}
+
+	d.SaveQueryRetries = 0
+
+	fileName, err := m.CopyBackup(ctx, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats, err = m.BackupStats("srv"); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := m.Backups("srv")
+	if err != nil || len(backups) != 1 || backups[0].File != fileName {
+		t.Fatalf("unexpected backups: %+v, %v", backups, err)
+	}
+
+	if stats.Successes != 1 || stats.Failures != 1 || stats.LastError == "" {
+		t.Errorf("unexpected backup counts: %+v", stats)
+	}
+
+	if stats.LastSuccess == "" || stats.LastFailure == "" || stats.LastDuration <= 0 {
+		t.Errorf("unexpected backup times: %+v", stats)
+	}
+
+	if stats.LastSize != backups[0].Size {
+		t.Errorf("unexpected last backup size: want %d: got %d", backups[0].Size, stats.LastSize)
+	}
+}
+
+func TestManager_CopyBackup_Cancelled(t *testing.T) {
+	ctx := testContext(t)
+	m, d := newTestManager(t)
+	d.SaveQueryRetries = 1000
+	m.SaveRetries, m.SaveDelay = 1000, 10*time.Millisecond
+
+	s := runTestServer(ctx, t, m, "srv", nil, true)
+
+	backupCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := m.CopyBackup(backupCtx, s); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: want %s: got %v", context.DeadlineExceeded, err)
+	}
+
+	if b, _ := d.Container("srv"); b.Held() {
+		t.Errorf("saving was not resumed after the backup was cancelled")
+	}
+
+	if held, err := m.SaveHeld("srv"); err != nil || held {
+		t.Errorf("held-save marker was not removed: held %t: error %v", held, err)
+	}
+}
+
+func TestManager_CopyBackup_ConfigNotSaved(t *testing.T) {
+	ctx := testContext(t)
+	m, _ := newTestManager(t)
+
+	var logs bytes.Buffer
+	m.Log = log.New(&logs, "", 0)
+
+	s := runTestServer(ctx, t, m, "srv", nil, true)
+
+	// The manifest can't be written over a directory
+	p := filepath.Join(m.BackupDir, "srv", manifestFileName)
+
+	if err := os.RemoveAll(p); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Mkdir(p, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	fileName, err := m.CopyBackup(ctx, s)
+	if err != nil {
+		t.Fatalf("backup failed when the configuration couldn't be saved: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(m.BackupDir, "srv", fileName)); err != nil {
+		t.Errorf("backup file was not kept: %s", err)
+	}
+
+	if !strings.Contains(logs.String(), "saving server configuration") {
+		t.Errorf("failing to save the configuration was not logged: %s", logs.String())
+	}
+}
+
+func TestManager_Diagnose(t *testing.T) {
+	ctx := testContext(t)
+	m, d := newTestManager(t)
+
+	s := runTestServer(ctx, t, m, "srv", nil, true)
+
+	got, err := m.Diagnose(ctx, "srv")
+	if err != nil {
+		t.Fatalf("error diagnosing healthy server: %s", err)
+	}
+
+	if got.Problem != "" {
+		t.Errorf("problem found for healthy server: %s", got.Problem)
+	}
+
+	// Simulate a backup which was killed while saving was held
+	interruptBackup(ctx, t, m, s)
+
+	if got, err = m.Diagnose(ctx, "srv"); err != nil {
+		t.Fatalf("error diagnosing server: %s", err)
+	}
+
+	if got.Problem == "" || got.Repair == "" {
+		t.Errorf("unexpected diagnosis for server in held-save state: %+v", got)
+	}
+
+	if b, _ := d.Container("srv"); b.Held() {
+		t.Errorf("saving was not resumed")
+	}
+
+	if held, err := m.SaveHeld("srv"); err != nil || held {
+		t.Errorf("held-save marker was not removed: held %t: error %v", held, err)
+	}
+
+	// A server which isn't running can't be held
+	interruptBackup(ctx, t, m, s)
+
+	if err := s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err = m.Diagnose(ctx, "srv"); err != nil {
+		t.Fatalf("error diagnosing stopped server: %s", err)
+	}
+
+	if held, err := m.SaveHeld("srv"); err != nil || held {
+		t.Errorf("held-save marker was not removed for stopped server: held %t: error %v", held, err)
+	}
+}
+
+func TestManager_CopyBackup_SaveLeftHeld(t *testing.T) {
+	ctx := testContext(t)
+	m, d := newTestManager(t)
+
+	s := runTestServer(ctx, t, m, "srv", nil, true)
+
+	interruptBackup(ctx, t, m, s)
+
+	if _, err := m.CopyBackup(ctx, s); err != nil {
+		t.Fatalf("error taking backup of server left in held-save state: %s", err)
+	}
+
+	if b, _ := d.Container("srv"); b.Held() {
+		t.Errorf("saving was not resumed")
+	}
+}
+
+func TestManager_CopyBackup_SaveHeldByRunningBackup(t *testing.T) {
+	ctx := testContext(t)
+	m, d := newTestManager(t)
+	d.SaveQueryRetries = 1000
+	m.SaveRetries, m.SaveDelay = 1000, 10*time.Millisecond
+
+	s := runTestServer(ctx, t, m, "srv", nil, true)
+
+	// A backup running in this process
+	backupCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		_, _ = m.CopyBackup(backupCtx, s)
+	}()
+
+	for b, _ := d.Container("srv"); !b.Held(); {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := m.CopyBackup(ctx, s); !errors.Is(err, ErrBackupRunning) {
+		t.Errorf("unexpected error taking a second backup: want %s: got %v", ErrBackupRunning, err)
+	}
+
+	if got, err := m.Diagnose(ctx, "srv"); err != nil || got.Problem != "" {
+		t.Errorf("unexpected diagnosis of server being backed up: %+v, %v", got, err)
+	}
+
+	if b, _ := d.Container("srv"); !b.Held() {
+		t.Errorf("saving was resumed during a running backup")
+	}
+
+	cancel()
+	<-done
+
+	// A backup running in another process
+	writeSaveHeldFile(t, m, "srv", os.Getppid())
+
+	if _, err := s.Exec(ctx, "save hold"); err != nil {
+		t.Fatal(err)
+	}
+
+	d.SaveQueryRetries = 0
+
+	if _, err := m.CopyBackup(ctx, s); !errors.Is(err, ErrBackupRunning) {
+		t.Errorf("unexpected error taking a backup held by another process: want %s: got %v", ErrBackupRunning, err)
+	}
+
+	if got, err := m.Diagnose(ctx, "srv"); err != nil || got.Problem != "" {
+		t.Errorf("unexpected diagnosis of server being backed up by another process: %+v, %v", got, err)
+	}
+
+	if b, _ := d.Container("srv"); !b.Held() {
+		t.Errorf("saving was resumed during a backup in another process")
+	}
+
+	// The other process has exited
+	exited := exec.Command(os.Args[0], "-test.run=^$")
+	if err := exited.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeSaveHeldFile(t, m, "srv", exited.Process.Pid)
+
+	if _, err := m.CopyBackup(ctx, s); err != nil {
+		t.Fatalf("error taking backup of server held by an exited process: %s", err)
+	}
+
+	if b, _ := d.Container("srv"); b.Held() {
+		t.Errorf("saving was not resumed")
+	}
+}
+
+// writeSaveHeldFile writes the held-save marker for the named server as if it was written by the given process.
+func writeSaveHeldFile(t *testing.T, m *Manager, name string, pid int) {
+	t.Helper()
+
+	p, err := m.saveHeldPath(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(saveHeldOwner{PID: pid})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(p, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// interruptBackup leaves the server in held-save state as if a backup had been killed before saving was resumed.
+func interruptBackup(ctx context.Context, t *testing.T, m *Manager, s *server.Server) {
+	t.Helper()
+
+	p, err := m.saveHeldPath(s.ContainerName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(p, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Exec(ctx, "save hold"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,198 @@
+package craft
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/danhale-git/craft/internal/backup"
+	"github.com/danhale-git/craft/server"
+)
+
+const (
+	StateRunning = "running" // The server container is running
+	StateStopped = "stopped" // The server container is stopped or the server only exists as a backup
+)
+
+// ServerInfo describes a running or stopped server. It is the schema for machine-readable output, fields may be added
+// but existing fields should not be changed or removed. Times are RFC3339 and sizes are in bytes.
+type ServerInfo struct {
+	Name           string `json:"name" yaml:"name"`
+	State          string `json:"state" yaml:"state"`                               // StateRunning or StateStopped
+	Port           int    `json:"port" yaml:"port"`                                 // 0 if there is no container
+	Volume         bool   `json:"volume" yaml:"volume"`                             // World is stored in a volume
+	StoppedAt      string `json:"stopped_at,omitempty" yaml:"stopped_at,omitempty"` // Stopped containers only
+	LastBackup     string `json:"last_backup,omitempty" yaml:"last_backup,omitempty"`
+	LastBackupSize int64  `json:"last_backup_size" yaml:"last_backup_size"`
+	BackupCount    int    `json:"backup_count" yaml:"backup_count"`
+	BackupSize     int64  `json:"backup_size" yaml:"backup_size"` // Total bytes of all backup files
+}
+
+// BackupInfo describes a backup or log archive file. It is the schema for machine-readable output, fields may be added but existing
+// fields should not be changed or removed.
+type BackupInfo struct {
+	Server string `json:"server" yaml:"server"`
+	File   string `json:"file" yaml:"file"` // Name of the file in the server's backup directory
+	Time   string `json:"time" yaml:"time"` // RFC3339
+	Size   int64  `json:"size" yaml:"size"` // Bytes
+}
+
+// Servers returns information about each server with a container. If all is true, servers which only exist as backups
+// are also included. Servers are sorted by name.
+func (m *Manager) Servers(ctx context.Context, all bool) ([]ServerInfo, error) {
+	servers, err := server.All(ctx, m.Client)
+	if err != nil {
+		return nil, fmt.Errorf("getting server clients: %s", err)
+	}
+
+	infos := make([]ServerInfo, 0)
+	names := make(map[string]bool)
+
+	for _, s := range servers {
+		info, err := m.containerInfo(ctx, s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.ContainerName, err)
+		}
+
+		names[s.ContainerName] = true
+
+		if info.State != StateRunning && !all {
+			continue
+		}
+
+		infos = append(infos, info)
+	}
+
+	if all {
+		stoppedNames, err := m.stoppedServerNames()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, n := range stoppedNames {
+			if names[n] {
+				continue
+			}
+
+			info := ServerInfo{Name: n, State: StateStopped}
+
+			if err := m.addBackupInfo(&info); err != nil {
+				return nil, err
+			}
+
+			// Directories without backups are not servers
+			if info.BackupCount == 0 {
+				continue
+			}
+
+			infos = append(infos, info)
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	return infos, nil
+}
+
+// containerInfo returns information about a server with a container.
+func (m *Manager) containerInfo(ctx context.Context, s *server.Server) (ServerInfo, error) {
+	info := ServerInfo{Name: s.ContainerName, State: StateStopped}
+
+	inspect, err := s.ContainerInspect(ctx, s.ContainerID)
+	if err != nil {
+		return info, err
+	}
+
+	if inspect.State.Running {
+		info.State = StateRunning
+	} else if inspect.State.FinishedAt != "" {
+		t, err := time.Parse(time.RFC3339Nano, inspect.State.FinishedAt)
+		if err != nil {
+			return info, fmt.Errorf("failed to parse stopped time: %w", err)
+		}
+
+		info.StoppedAt = t.Format(time.RFC3339)
+	}
+
+	if info.Port, err = s.Port(ctx); err != nil {
+		return info, err
+	}
+
+	if info.Volume, err = s.HasVolume(ctx); err != nil {
+		return info, err
+	}
+
+	if err := m.addBackupInfo(&info); err != nil {
+		return info, err
+	}
+
+	return info, nil
+}
+
+// addBackupInfo sets the backup fields of info from the backup files for the server.
+func (m *Manager) addBackupInfo(info *ServerInfo) error {
+	backups, err := m.Backups(info.Name)
+	if err != nil {
+		return err
+	}
+
+	info.BackupCount = len(backups)
+
+	for _, b := range backups {
+		info.BackupSize += b.Size
+	}
+
+	if len(backups) > 0 {
+		latest := backups[len(backups)-1]
+		info.LastBackup = latest.Time
+		info.LastBackupSize = latest.Size
+	}
+
+	return nil
+}
+
+// Backups returns information about each backup file for the named server, ordered oldest first.
+func (m *Manager) Backups(name string) ([]BackupInfo, error) {
+	files, err := m.serverBackups(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return fileInfos(name, files)
+}
+
+// fileInfos returns information about each of the named server's backup or log archive files.
+func fileInfos(name string, files []os.FileInfo) ([]BackupInfo, error) {
+	infos := make([]BackupInfo, len(files))
+
+	for i, f := range files {
+		t, err := backupTime(f.Name())
+		if err != nil {
+			return nil, fmt.Errorf("reading time of '%s': %w", filepath.Join(name, f.Name()), err)
+		}
+
+		infos[i] = BackupInfo{
+			Server: name,
+			File:   f.Name(),
+			Time:   t.Format(time.RFC3339),
+			Size:   f.Size(),
+		}
+	}
+
+	return infos, nil
+}
+
+// backupTime returns the time a backup was taken. Backup file names are in local time.
+func backupTime(fileName string) (time.Time, error) {
+	t, err := backup.FileTime(fileName)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.Local), nil
+}
@@ -0,0 +1,131 @@
+package craft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/danhale-git/craft/internal/backup"
+	"github.com/danhale-git/craft/server"
+)
+
+const (
+	backupExt     = ".zip"
+	logArchiveExt = ".log"
+
+	// logArchiveTimeout is the time allowed for the rest of the container log to be archived after the server stops.
+	logArchiveTimeout = 10 * time.Second
+)
+
+// StopServer stops the server and archives its container log in the backup directory, next to the server's backups.
+// Docker rotates the container log, so the archive holds the most recent output it kept rather than all output since
+// the server started. Failing to archive the log is logged and doesn't prevent the server from being stopped.
+func (m *Manager) StopServer(ctx context.Context, s *server.Server) error {
+	archiveCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+
+	logs, err := s.LogReader(archiveCtx, -1)
+	if err != nil {
+		done <- err
+	} else {
+		go func() {
+			done <- m.archiveLogs(s.ContainerName, logs)
+		}()
+	}
+
+	stopErr := s.Stop(ctx)
+
+	// The log reader returns EOF once the container has stopped
+	timer := time.NewTimer(logArchiveTimeout)
+	defer timer.Stop()
+
+	select {
+	case err = <-done:
+	case <-timer.C:
+		cancel()
+
+		err = <-done
+	}
+
+	if err != nil {
+		m.logf("%s: archiving container log: %s", s.ContainerName, err)
+	}
+
+	return stopErr
+}
+
+// archiveLogs writes the container log from r to a new log archive file for the named server.
+func (m *Manager) archiveLogs(name string, r io.Reader) error {
+	backupDir, err := m.backupDirectory()
+	if err != nil {
+		return err
+	}
+
+	d := filepath.Join(backupDir, name)
+
+	if err := os.MkdirAll(d, 0755); err != nil {
+		return err
+	}
+
+	fileName := fmt.Sprintf("%s_%s%s", name, m.now().Format(backup.FileNameTimeLayout), logArchiveExt)
+
+	f, err := os.Create(filepath.Join(d, fileName))
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil && !errors.Is(err, context.Canceled) {
+		_ = f.Close()
+		return fmt.Errorf("writing '%s': %w", fileName, err)
+	}
+
+	return f.Close()
+}
+
+// LogArchives returns information about each archived container log for the named server, ordered oldest first.
+func (m *Manager) LogArchives(name string) ([]BackupInfo, error) {
+	files, err := m.backupDirFiles(name, logArchiveExt)
+	if err != nil {
+		return nil, err
+	}
+
+	return fileInfos(name, files)
+}
+
+// OpenLogArchive opens the named server's archived container log with the given file name. If fileName is empty, the
+// most recent archive is opened.
+func (m *Manager) OpenLogArchive(name, fileName string) (io.ReadCloser, error) {
+	files, err := m.backupDirFiles(name, logArchiveExt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no archived logs found for server '%s'", name)
+	}
+
+	if fileName == "" {
+		fileName = files[len(files)-1].Name()
+	}
+
+	for _, f := range files {
+		if f.Name() != fileName {
+			continue
+		}
+
+		backupDir, err := m.backupDirectory()
+		if err != nil {
+			return nil, err
+		}
+
+		return os.Open(filepath.Join(backupDir, name, fileName))
+	}
+
+	return nil, fmt.Errorf("archived log '%s' not found for server '%s'", fileName, name)
+}
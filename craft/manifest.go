@@ -0,0 +1,73 @@
+package craft
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/danhale-git/craft/server"
+)
+
+// manifestFileName is the name of the file in a server's backup directory which records the server's configuration.
+const manifestFileName = "manifest.json"
+
+// manifest records the configuration of a server so that it can be created again with the same configuration after it
+// has been stopped.
+type manifest struct {
+	Name   string        `json:"name"`
+	Config server.Config `json:"config"`
+}
+
+// saveConfig writes the configuration of the server's container to its manifest file.
+func (m *Manager) saveConfig(ctx context.Context, s *server.Server) error {
+	cfg, err := s.Config(ctx)
+	if err != nil {
+		return fmt.Errorf("getting server configuration: %w", err)
+	}
+
+	backupDir, err := m.backupDirectory()
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(backupDir, s.ContainerName)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(manifest{Name: s.ContainerName, Config: cfg}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, manifestFileName), b, 0600)
+}
+
+// savedConfig returns the configuration recorded in the named server's manifest file. If the server has no manifest
+// the zero value is returned.
+func (m *Manager) savedConfig(name string) (server.Config, error) {
+	backupDir, err := m.backupDirectory()
+	if err != nil {
+		return server.Config{}, err
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(backupDir, name, manifestFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return server.Config{}, nil
+		}
+
+		return server.Config{}, err
+	}
+
+	var mf manifest
+	if err := json.Unmarshal(b, &mf); err != nil {
+		return server.Config{}, fmt.Errorf("reading %s for server '%s': %w", manifestFileName, name, err)
+	}
+
+	return mf.Config, nil
+}
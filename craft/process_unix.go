@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package craft
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// processRunning returns true if a process with the given id is running. The time the process is expected to have
+// started before is not checked.
+func processRunning(pid int, _ time.Time) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	// Signal 0 checks the process exists without sending a signal. EPERM means it exists but belongs to another user.
+	err = p.Signal(syscall.Signal(0))
+
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,40 @@
+package craft
+
+import (
+	"syscall"
+	"time"
+)
+
+const (
+	processQueryLimitedInformation = 0x1000 // Access right needed to get the exit code and times of a process
+	stillActive                    = 259    // Exit code of a process which hasn't exited
+)
+
+// processRunning returns true if a process with the given id is running and, if before is not zero, it started before
+// that time. Process ids are reused, so a process which started later is not the one being checked for.
+func processRunning(pid int, before time.Time) bool {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		// The process exists but belongs to another user
+		return err == syscall.ERROR_ACCESS_DENIED
+	}
+	defer syscall.CloseHandle(h) //nolint:errcheck
+
+	// A process can be opened after it has exited while another process has a handle to it
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil || code != stillActive {
+		return false
+	}
+
+	if before.IsZero() {
+		return true
+	}
+
+	var created, exited, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(h, &created, &exited, &kernel, &user); err != nil {
+		return true
+	}
+
+	// before is truncated to the second
+	return !time.Unix(0, created.Nanoseconds()).After(before.Add(time.Second))
+}
@@ -0,0 +1,305 @@
+package craft
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/danhale-git/craft/internal/backup"
+	"github.com/danhale-git/craft/server"
+)
+
+const (
+	// saveHeldFile is written to a server's backup directory while saving is held and removed when it is resumed. It
+	// records the craft process holding saving. If it exists and that process has exited, a backup was interrupted and
+	// the server was left in held-save state.
+	saveHeldFile = ".save-held"
+
+	// saveResumeTimeout is the time allowed for `save resume` to run after a backup or export has ended.
+	saveResumeTimeout = 30 * time.Second
+)
+
+// saveHeldOwner is the content of the held-save marker.
+type saveHeldOwner struct {
+	PID  int    `json:"pid"`  // ID of the craft process holding saving
+	Time string `json:"time"` // Time saving was held, from the system clock so it can be compared with process start times
+}
+
+// processRunning returns true if the process which wrote the marker is still running. A process started after saving
+// was held has reused the ID of the process which held it.
+func (o saveHeldOwner) processRunning() bool {
+	held, _ := time.Parse(time.RFC3339, o.Time) // Zero if not recorded
+
+	return o.PID > 0 && processRunning(o.PID, held)
+}
+
+// Diagnosis is the result of checking a server for problems. It is the schema for machine-readable output, fields may
+// be added but existing fields should not be changed or removed.
+type Diagnosis struct {
+	Server  string `json:"server" yaml:"server"`
+	Problem string `json:"problem,omitempty" yaml:"problem,omitempty"` // Empty if no problem was found
+	Repair  string `json:"repair,omitempty" yaml:"repair,omitempty"`   // The action taken to repair the problem
+}
+
+// Diagnose checks the named server for problems left by interrupted craft commands and repairs them. Currently, the
+// only problem checked for is a server left in held-save state by an interrupted backup. Saving held by a backup which
+// is still running is not a problem.
+func (m *Manager) Diagnose(ctx context.Context, name string) (Diagnosis, error) {
+	d := Diagnosis{Server: name}
+
+	held, err := m.SaveHeld(name)
+	if err != nil || !held {
+		return d, err
+	}
+
+	d.Problem = "saving was left on hold by an interrupted backup"
+
+	s, err := m.GetServer(ctx, name)
+	if err != nil && !errors.Is(err, &server.NotFoundError{}) {
+		return d, err
+	}
+
+	running := false
+	if s != nil {
+		if running, err = s.IsRunning(ctx); err != nil {
+			return d, err
+		}
+	}
+
+	// Saving is never held when the server process starts
+	if !running {
+		d.Repair = "removed the held-save marker, the server is not running"
+		return d, m.removeSaveHeldFile(name)
+	}
+
+	if err := m.ResumeSave(ctx, s); err != nil {
+		return d, fmt.Errorf("resuming save: %w", err)
+	}
+
+	d.Repair = "resumed saving"
+
+	return d, nil
+}
+
+// SaveHeld returns true if a backup of the named server was interrupted before saving was resumed. It returns false
+// while the backup holding saving is still running.
+func (m *Manager) SaveHeld(name string) (bool, error) {
+	owner, err := m.readSaveHeldFile(name)
+	if err != nil || owner == nil {
+		return false, err
+	}
+
+	return !m.holdRunning(name, *owner), nil
+}
+
+// ResumeSave runs the `save resume` command in the server cli, ending any save hold, and removes the held-save marker.
+func (m *Manager) ResumeSave(ctx context.Context, s *server.Server) error {
+	cmd, err := s.CommandWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer cmd.Close()
+
+	// Stop reading logs when the response has been read
+	logCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	logs, err := s.LogReader(logCtx, 0)
+	if err != nil {
+		return err
+	}
+
+	if err := backup.SaveResume(cmd, logs); err != nil {
+		return err
+	}
+
+	return m.removeSaveHeldFile(s.ContainerName)
+}
+
+// saveHold runs `save hold` and `save query` in the server cli and returns the world files which are ready to be
+// copied. The held-save marker is written first. If it already exists and the backup which wrote it is still running,
+// an error wrapping ErrBackupRunning is returned. Otherwise saving was left on hold by an interrupted backup and is
+// resumed before holding it again. The returned function resumes saving and must be called, even if saveHold fails.
+func (m *Manager) saveHold(ctx context.Context, s *server.Server) ([]backup.File, func(), error) {
+	noResume := func() {}
+
+	if !m.claimSaveHold(s.ContainerName) {
+		return nil, noResume, fmt.Errorf("%w: '%s' is being backed up by this craft process",
+			ErrBackupRunning, s.ContainerName)
+	}
+
+	owner, err := m.readSaveHeldFile(s.ContainerName)
+	if err != nil {
+		m.releaseSaveHold(s.ContainerName)
+		return nil, noResume, err
+	}
+
+	if owner != nil && owner.PID != os.Getpid() && owner.processRunning() {
+		// Saving is held by another process, it must not be resumed by this one
+		m.releaseSaveHold(s.ContainerName)
+
+		return nil, noResume, fmt.Errorf("%w: '%s' is being backed up by craft process %d",
+			ErrBackupRunning, s.ContainerName, owner.PID)
+	}
+
+	resume := func() { m.resumeSave(s) }
+	worldFiles, err := m.holdSave(ctx, s, owner != nil)
+
+	return worldFiles, resume, err
+}
+
+// holdSave writes the held-save marker and runs `save hold` and `save query`. If held is true, saving was left on hold
+// by an interrupted backup and is resumed first.
+func (m *Manager) holdSave(ctx context.Context, s *server.Server, held bool) ([]backup.File, error) {
+	if held {
+		m.logf("%s: saving was left on hold by an interrupted backup, resuming", s.ContainerName)
+
+		if err := m.ResumeSave(ctx, s); err != nil {
+			return nil, fmt.Errorf("resuming save left on hold: %w", err)
+		}
+	}
+
+	p, err := m.saveHeldPath(s.ContainerName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(saveHeldOwner{PID: os.Getpid(), Time: time.Now().Format(time.RFC3339)})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(p, b, 0644); err != nil { //nolint:gosec
+		return nil, fmt.Errorf("writing held-save marker: %w", err)
+	}
+
+	// Write to server CLI
+	cmd, err := s.CommandWriter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cmd.Close()
+
+	// Stop reading logs when the query has finished
+	logCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	logs, err := s.LogReader(logCtx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return backup.SaveHoldQuery(ctx, cmd, logs, m.saveOptions())
+}
+
+// resumeSave runs ResumeSave with a new context so that saving is resumed when the context of the backup was
+// cancelled e.g. because the user interrupted craft. Errors are logged.
+func (m *Manager) resumeSave(s *server.Server) {
+	defer m.releaseSaveHold(s.ContainerName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), saveResumeTimeout)
+	defer cancel()
+
+	if err := m.ResumeSave(ctx, s); err != nil {
+		m.logf("%s: error running `save resume` (try running 'craft doctor %s'): %s",
+			s.ContainerName, s.ContainerName, err)
+	}
+}
+
+// saveHeldPath returns the path to the held-save marker for the named server.
+func (m *Manager) saveHeldPath(name string) (string, error) {
+	backupDir, err := m.backupDirectory()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(backupDir, name, saveHeldFile), nil
+}
+
+func (m *Manager) removeSaveHeldFile(name string) error {
+	p, err := m.saveHeldPath(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// readSaveHeldFile returns the owner recorded in the held-save marker for the named server, or nil if there is no
+// marker. The owner of a marker which can't be parsed has no PID, so it is never running.
+func (m *Manager) readSaveHeldFile(name string) (*saveHeldOwner, error) {
+	p, err := m.saveHeldPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var owner saveHeldOwner
+	if err := json.Unmarshal(b, &owner); err != nil {
+		return &saveHeldOwner{}, nil //nolint:nilerr // Written by an older version of craft
+	}
+
+	return &owner, nil
+}
+
+// holdRunning returns true if the backup which wrote the held-save marker for the named server is still running.
+func (m *Manager) holdRunning(name string, owner saveHeldOwner) bool {
+	if owner.PID <= 0 {
+		return false
+	}
+
+	if owner.PID == os.Getpid() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		return m.holding[name]
+	}
+
+	return owner.processRunning()
+}
+
+// claimSaveHold records that this process is holding saving for the named server. It returns false if it already is.
+func (m *Manager) claimSaveHold(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.holding[name] {
+		return false
+	}
+
+	if m.holding == nil {
+		m.holding = make(map[string]bool)
+	}
+
+	m.holding[name] = true
+
+	return true
+}
+
+func (m *Manager) releaseSaveHold(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.holding, name)
+}
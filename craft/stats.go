@@ -0,0 +1,103 @@
+package craft
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// backupStatsFileName is the name of the file in a server's backup directory which records the results of backups.
+const backupStatsFileName = "backup_stats.json"
+
+// BackupStats records the results of a server's backups. It is kept in the server's backup directory so it persists
+// between craft commands. It is the schema for machine-readable output, fields may be added but existing fields should
+// not be changed or removed. Times are RFC3339 and sizes are in bytes.
+type BackupStats struct {
+	Server       string  `json:"server" yaml:"server"`
+	LastSuccess  string  `json:"last_success,omitempty" yaml:"last_success,omitempty"` // Time the last backup finished
+	LastDuration float64 `json:"last_duration" yaml:"last_duration"`                   // Seconds taken by the last backup
+	LastSize     int64   `json:"last_size" yaml:"last_size"`                           // Size of the last backup file
+	LastFailure  string  `json:"last_failure,omitempty" yaml:"last_failure,omitempty"` // Time the last failed backup ended
+	LastError    string  `json:"last_error,omitempty" yaml:"last_error,omitempty"`     // Error of the last failed backup
+	Successes    int     `json:"successes" yaml:"successes"`                           // Total successful backups
+	Failures     int     `json:"failures" yaml:"failures"`                             // Total failed backups
+}
+
+// BackupStats returns the recorded results of the named server's backups. If no backup has been taken by this version
+// of craft, only Server is set.
+func (m *Manager) BackupStats(name string) (BackupStats, error) {
+	stats := BackupStats{Server: name}
+
+	backupDir, err := m.backupDirectory()
+	if err != nil {
+		return stats, err
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(backupDir, name, backupStatsFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return stats, nil
+		}
+
+		return stats, err
+	}
+
+	if err := json.Unmarshal(b, &stats); err != nil {
+		return stats, fmt.Errorf("reading %s for server '%s': %w", backupStatsFileName, name, err)
+	}
+
+	return stats, nil
+}
+
+// recordBackup adds the result of a backup to the named server's backup stats. The file name is ignored if the backup
+// failed. Failing to record the result is logged and doesn't cause the backup to fail.
+func (m *Manager) recordBackup(name, fileName string, d time.Duration, backupErr error) {
+	if err := m.writeBackupStats(name, fileName, d, backupErr); err != nil {
+		m.logf("%s: recording backup stats: %s", name, err)
+	}
+}
+
+func (m *Manager) writeBackupStats(name, fileName string, d time.Duration, backupErr error) error {
+	stats, err := m.BackupStats(name)
+	if err != nil {
+		return err
+	}
+
+	backupDir, err := m.backupDirectory()
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(backupDir, name)
+	now := m.now().Format(time.RFC3339)
+
+	if backupErr != nil {
+		stats.Failures++
+		stats.LastFailure = now
+		stats.LastError = backupErr.Error()
+	} else {
+		info, err := os.Stat(filepath.Join(dir, fileName))
+		if err != nil {
+			return err
+		}
+
+		stats.Successes++
+		stats.LastSuccess = now
+		stats.LastDuration = d.Seconds()
+		stats.LastSize = info.Size()
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, backupStatsFileName), b, 0600)
+}
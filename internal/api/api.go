@@ -0,0 +1,257 @@
+// Package api serves a JSON HTTP API for managing craft servers. Every request must have a bearer token. Operations
+// which take a long time run as background jobs and the status of each job can be requested.
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danhale-git/craft/craft"
+	"github.com/danhale-git/craft/internal/jobs"
+	"github.com/danhale-git/craft/internal/logger"
+	"github.com/danhale-git/craft/server"
+	"github.com/docker/docker/client"
+)
+
+// maxBodySize is the maximum size of a request body in bytes.
+const maxBodySize = 1 << 20
+
+// errBadRequest is wrapped by errors caused by an invalid request.
+var errBadRequest = errors.New("bad request")
+
+// serverNameRegexp matches valid server names. They are docker container names and are used in backup file paths.
+var serverNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`) //nolint:gochecknoglobals
+
+// Handler serves the API. Jobs for the same server never run at the same time. A request which would start a job while
+// another job for the server is running fails with 409 Conflict.
+type Handler struct {
+	manager *craft.Manager
+	token   string
+	jobs    *jobs.Runner
+	ctx     context.Context // Background jobs are cancelled when this is done
+	routes  []route
+}
+
+// route is an API endpoint. Segments of the path which are '*' match any value and are passed to the handler.
+type route struct {
+	method string
+	path   string
+	handle func(w http.ResponseWriter, r *http.Request, params []string) error
+}
+
+// New returns a Handler which manages servers with m and accepts requests with the given bearer token. Background jobs
+// are run by runner and are cancelled when ctx is done.
+func New(ctx context.Context, m *craft.Manager, token string, runner *jobs.Runner) *Handler {
+	h := &Handler{
+		manager: m,
+		token:   token,
+		jobs:    runner,
+		ctx:     ctx,
+	}
+
+	h.routes = []route{
+		{http.MethodGet, "/servers", h.listServers},
+		{http.MethodPost, "/servers", h.runServer},
+		{http.MethodPost, "/servers/*/start", h.startServer},
+		{http.MethodPost, "/servers/*/stop", h.stopServer},
+		{http.MethodPost, "/servers/*/configure", h.configureServer},
+		{http.MethodPost, "/servers/*/command", h.command},
+		{http.MethodGet, "/servers/*/export", h.export},
+		{http.MethodGet, "/servers/*/backups", h.listBackups},
+		{http.MethodPost, "/servers/*/backups", h.backup},
+		{http.MethodPost, "/servers/*/backups/trim", h.trimBackups},
+		{http.MethodGet, "/jobs", h.listJobs},
+		{http.MethodGet, "/jobs/*", h.getJob},
+	}
+
+	return h
+}
+
+// errorResponse is the body of every response with an error status.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// ServeHTTP authenticates the request and calls the handler for its path and method.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="craft"`)
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "missing or invalid bearer token"})
+
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+
+	allowed := make([]string, 0)
+
+	for _, rt := range h.routes {
+		params, ok := match(rt.path, r.URL.Path)
+		if !ok {
+			continue
+		}
+
+		if rt.method != r.Method {
+			allowed = append(allowed, rt.method)
+			continue
+		}
+
+		// The server name is the first parameter of every server endpoint
+		if strings.HasPrefix(rt.path, "/servers/*") {
+			if err := validateName(params[0]); err != nil {
+				writeError(w, err)
+				return
+			}
+		}
+
+		if err := rt.handle(w, r, params); err != nil {
+			writeError(w, err)
+		}
+
+		return
+	}
+
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: fmt.Sprintf("method %s not allowed", r.Method)})
+
+		return
+	}
+
+	writeJSON(w, http.StatusNotFound, errorResponse{Error: fmt.Sprintf("no endpoint %s", r.URL.Path)})
+}
+
+// authorized returns true if the request has the handler's bearer token. No request is authorized if the token is
+// empty.
+func (h *Handler) authorized(r *http.Request) bool {
+	const prefix = "Bearer "
+
+	auth := r.Header.Get("Authorization")
+	if h.token == "" || !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, prefix)), []byte(h.token)) == 1
+}
+
+// match returns the values of the '*' segments of pattern if path matches it.
+func match(pattern, path string) ([]string, bool) {
+	want := strings.Split(strings.Trim(pattern, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+
+	if len(want) != len(got) {
+		return nil, false
+	}
+
+	params := make([]string, 0)
+
+	for i, w := range want {
+		switch {
+		case w == "*" && got[i] != "":
+			params = append(params, got[i])
+		case w != got[i]:
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// validateName returns an error wrapping errBadRequest if name is not a valid server name.
+func validateName(name string) error {
+	// '.' and '..' match the pattern but are not safe in a path
+	if !serverNameRegexp.MatchString(name) || name == "." || name == ".." {
+		return fmt.Errorf("%w: invalid server name '%s'", errBadRequest, name)
+	}
+
+	return nil
+}
+
+// startJob runs fn as a background job for the named server and responds with the job's record. Its status can be
+// requested from the URL in the Location header.
+func (h *Handler) startJob(w http.ResponseWriter, name, action string, fn jobs.Func) error {
+	rec, err := h.jobs.Run(h.ctx, fmt.Sprintf("%s-%s", name, action), name, fn)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/jobs/%d", rec.ID))
+	writeJSON(w, http.StatusAccepted, rec)
+
+	return nil
+}
+
+// decode reads the JSON request body into v. An empty body leaves v unchanged.
+func decode(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: invalid request body: %s", errBadRequest, err)
+	}
+
+	return nil
+}
+
+// properties returns server properties as a sorted slice of key=value strings.
+func properties(props map[string]string) []string {
+	s := make([]string, 0, len(props))
+	for k, v := range props {
+		s = append(s, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	sort.Strings(s)
+
+	return s
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error.Printf("writing response: %s", err)
+	}
+}
+
+// writeError writes an error response with the status code for err.
+func writeError(w http.ResponseWriter, err error) {
+	writeJSON(w, statusCode(err), errorResponse{Error: err.Error()})
+}
+
+// statusCode returns the HTTP status code for an error returned by a handler.
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, errBadRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, &server.NotFoundError{}):
+		return http.StatusNotFound
+	case errors.Is(err, &server.NotCraftError{}), errors.Is(err, jobs.ErrLocked):
+		return http.StatusConflict
+	case errors.Is(err, &server.CommandError{}):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, craft.ErrDockerUnreachable), client.IsErrConnectionFailed(err):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// jobID parses the id of a job from a URL.
+func jobID(s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid job id '%s'", errBadRequest, s)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,374 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danhale-git/craft/craft"
+	"github.com/danhale-git/craft/internal/jobs"
+	"github.com/danhale-git/craft/internal/mock"
+	"github.com/danhale-git/craft/server"
+)
+
+const testToken = "secret"
+
+// newTestAPI returns a test server for the API which manages servers in a fake docker daemon.
+func newTestAPI(t *testing.T) (*httptest.Server, *craft.Manager, *jobs.Runner) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	d := mock.NewDocker(server.ImageName)
+	m := &craft.Manager{Client: d, BackupDir: t.TempDir(), Now: time.Now}
+	r := &jobs.Runner{}
+
+	ts := httptest.NewServer(New(ctx, m, testToken, r))
+
+	t.Cleanup(func() {
+		ts.Close()
+		cancel()
+		r.Wait()
+	})
+
+	return ts, m, r
+}
+
+// request sends an authorized request with the given JSON body, if it isn't empty, and returns the response.
+func request(t *testing.T, ts *httptest.Server, method, path, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+testToken)
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+func decodeBody(t *testing.T, resp *http.Response, v interface{}) {
+	t.Helper()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("decoding response body: %s", err)
+	}
+}
+
+// runJob starts a job with the request and waits for it to finish, returning its final record.
+func runJob(t *testing.T, ts *httptest.Server, r *jobs.Runner, method, path, body string) jobs.Record {
+	t.Helper()
+
+	resp := request(t, ts, method, path, body)
+	if resp.StatusCode != http.StatusAccepted {
+		b, _ := ioutil.ReadAll(resp.Body)
+		t.Fatalf("%s %s: unexpected status %d: %s", method, path, resp.StatusCode, b)
+	}
+
+	var rec jobs.Record
+	decodeBody(t, resp, &rec)
+
+	if rec.Status != jobs.StatusRunning {
+		t.Errorf("%s %s: unexpected status for a new job: %s", method, path, rec.Status)
+	}
+
+	r.Wait()
+
+	resp = request(t, ts, http.MethodGet, resp.Header.Get("Location"), "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("getting job %d: unexpected status %d", rec.ID, resp.StatusCode)
+	}
+
+	decodeBody(t, resp, &rec)
+
+	return rec
+}
+
+func TestHandler_Auth(t *testing.T) {
+	ts, _, _ := newTestAPI(t)
+
+	for _, auth := range []string{"", "Bearer wrong", "Basic " + testToken, testToken} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/servers", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("authorization %q: unexpected status: want %d: got %d", auth, http.StatusUnauthorized, resp.StatusCode)
+		}
+	}
+
+	if resp := request(t, ts, http.MethodGet, "/servers", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status with a valid token: %d", resp.StatusCode)
+	}
+}
+
+func TestHandler_Routes(t *testing.T) {
+	ts, _, _ := newTestAPI(t)
+
+	cases := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/nothing", http.StatusNotFound},
+		{http.MethodGet, "/servers/srv", http.StatusNotFound},
+		{http.MethodDelete, "/servers", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/servers/srv/export", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/jobs/abc", http.StatusBadRequest},
+		{http.MethodGet, "/jobs/99", http.StatusNotFound},
+		{http.MethodPost, "/servers/nosuchserver/backups", http.StatusNotFound},
+		{http.MethodGet, "/servers/%2E%2E/backups", http.StatusBadRequest},
+		{http.MethodGet, "/servers/%2E/backups", http.StatusBadRequest},
+		{http.MethodGet, "/servers/-srv/backups", http.StatusBadRequest},
+		{http.MethodGet, "/servers/srv%5Cx/backups", http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		resp := request(t, ts, tc.method, tc.path, "")
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s %s: unexpected status: want %d: got %d", tc.method, tc.path, tc.want, resp.StatusCode)
+		}
+
+		var e errorResponse
+		decodeBody(t, resp, &e)
+
+		if e.Error == "" {
+			t.Errorf("%s %s: no error message in response", tc.method, tc.path)
+		}
+	}
+
+	if got := request(t, ts, http.MethodDelete, "/servers", "").Header.Get("Allow"); got != "GET, POST" {
+		t.Errorf("unexpected Allow header: %s", got)
+	}
+}
+
+func TestHandler_Servers(t *testing.T) {
+	ts, m, r := newTestAPI(t)
+	d := m.Client.(*mock.Docker)
+
+	if resp := request(t, ts, http.MethodPost, "/servers", `{"port": 19132}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status running a server without a name: %d", resp.StatusCode)
+	}
+
+	for _, name := range []string{"..", "../srv", "srv/x", ".srv"} {
+		body := fmt.Sprintf(`{"name": %q}`, name)
+		if resp := request(t, ts, http.MethodPost, "/servers", body); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("unexpected status running a server named '%s': %d", name, resp.StatusCode)
+		}
+	}
+
+	resp := request(t, ts, http.MethodPost, "/servers", `{"name": "srv", "volume": true}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status for an unknown field: %d", resp.StatusCode)
+	}
+
+	body := `{"name": "srv", "port": 19132, "properties": {"gamemode": "creative"}}`
+
+	rec := runJob(t, ts, r, http.MethodPost, "/servers", body)
+	if rec.Status != jobs.StatusOK || rec.Job != "srv-run" {
+		t.Fatalf("unexpected record for the run job: %+v", rec)
+	}
+
+	var servers []craft.ServerInfo
+	decodeBody(t, request(t, ts, http.MethodGet, "/servers", ""), &servers)
+
+	if len(servers) != 1 || servers[0].Port != 19132 || servers[0].State != craft.StateRunning {
+		t.Errorf("unexpected servers: %+v", servers)
+	}
+
+	resp = request(t, ts, http.MethodPost, "/servers/srv/configure", `{"properties": {"difficulty": "hard"}}`)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("unexpected status configuring server: %d", resp.StatusCode)
+	}
+
+	props, err := d.ReadFile("srv", "/bedrock/server.properties")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"gamemode=creative", "difficulty=hard"} {
+		if !strings.Contains(string(props), want) {
+			t.Errorf("%s not set in server.properties:\n%s", want, props)
+		}
+	}
+
+	rec = runJob(t, ts, r, http.MethodPost, "/servers/srv/stop", "")
+	if rec.Status != jobs.StatusOK {
+		t.Fatalf("unexpected record for the stop job: %+v", rec)
+	}
+
+	decodeBody(t, request(t, ts, http.MethodGet, "/servers?all=true", ""), &servers)
+
+	if len(servers) != 1 || servers[0].State != craft.StateStopped {
+		t.Errorf("unexpected servers after stopping: %+v", servers)
+	}
+
+	rec = runJob(t, ts, r, http.MethodPost, "/servers/srv/start", "")
+	if rec.Status != jobs.StatusOK {
+		t.Fatalf("unexpected record for the start job: %+v", rec)
+	}
+
+	// Jobs must not leave logs being read after they end
+	for deadline := time.Now().Add(time.Second); d.LogStreams() > 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d log streams are still open after the jobs ended", d.LogStreams())
+		}
+	}
+
+	var records []jobs.Record
+	decodeBody(t, request(t, ts, http.MethodGet, "/jobs", ""), &records)
+
+	if len(records) != 4 {
+		t.Errorf("unexpected job records: %+v", records)
+	}
+}
+
+func TestHandler_Command(t *testing.T) {
+	ts, _, r := newTestAPI(t)
+
+	runJob(t, ts, r, http.MethodPost, "/servers", `{"name": "srv"}`)
+
+	var out commandResponse
+
+	resp := request(t, ts, http.MethodPost, "/servers/srv/command", `{"command": "time set 0600"}`)
+	decodeBody(t, resp, &out)
+
+	if resp.StatusCode != http.StatusOK || len(out.Lines) != 1 || out.Lines[0] != "Set the time to 0600" {
+		t.Errorf("unexpected response to a command: %d: %+v", resp.StatusCode, out)
+	}
+
+	resp = request(t, ts, http.MethodPost, "/servers/srv/command", `{"command": "notacommand"}`)
+	decodeBody(t, resp, &out)
+
+	if resp.StatusCode != http.StatusUnprocessableEntity || out.Error == "" {
+		t.Errorf("unexpected response to an invalid command: %d: %+v", resp.StatusCode, out)
+	}
+
+	if resp := request(t, ts, http.MethodPost, "/servers/srv/command", `{}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status for a missing command: %d", resp.StatusCode)
+	}
+}
+
+func TestHandler_Backups(t *testing.T) {
+	ts, m, r := newTestAPI(t)
+
+	runJob(t, ts, r, http.MethodPost, "/servers", `{"name": "srv"}`)
+
+	rec := runJob(t, ts, r, http.MethodPost, "/servers/srv/backups", "")
+	if rec.Status != jobs.StatusOK || rec.Job != "srv-backup" {
+		t.Fatalf("unexpected record for the backup job: %+v", rec)
+	}
+
+	var backups []craft.BackupInfo
+	decodeBody(t, request(t, ts, http.MethodGet, "/servers/srv/backups", ""), &backups)
+
+	if len(backups) != 1 || backups[0].Server != "srv" || backups[0].Size == 0 {
+		t.Fatalf("unexpected backups: %+v", backups)
+	}
+
+	// Backups taken in the same minute overwrite each other, so add an older one to trim
+	old := "srv_10-00_01-02-2021.zip"
+	if err := ioutil.WriteFile(filepath.Join(m.BackupDir, "srv", old), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := request(t, ts, http.MethodPost, "/servers/srv/backups/trim", `{}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status trimming without keep: %d", resp.StatusCode)
+	}
+
+	// Names which would resolve to another directory are rejected before anything is deleted
+	resp = request(t, ts, http.MethodPost, "/servers/%2E%2E/backups/trim", `{"keep": 0}`)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status trimming the parent of the backup directory: %d", resp.StatusCode)
+	}
+
+	var trimmed trimResponse
+	decodeBody(t, request(t, ts, http.MethodPost, "/servers/srv/backups/trim", `{"keep": 1}`), &trimmed)
+
+	if len(trimmed.Deleted) != 1 || trimmed.Deleted[0] != old {
+		t.Errorf("unexpected files deleted: want [%s]: got %v", old, trimmed.Deleted)
+	}
+
+	// A job for the server can't start while it is held by another request
+	release := make(chan struct{})
+
+	if _, err := r.Run(context.Background(), "held", "srv", func(ctx context.Context) error {
+		<-release
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp := request(t, ts, http.MethodPost, "/servers/srv/backups", ""); resp.StatusCode != http.StatusConflict {
+		t.Errorf("unexpected status starting a job while another is running: %d", resp.StatusCode)
+	}
+
+	if resp := request(t, ts, http.MethodGet, "/servers/srv/export", ""); resp.StatusCode != http.StatusConflict {
+		t.Errorf("unexpected status exporting while another job is running: %d", resp.StatusCode)
+	}
+
+	close(release)
+	r.Wait()
+}
+
+func TestHandler_Export(t *testing.T) {
+	ts, m, r := newTestAPI(t)
+	d := m.Client.(*mock.Docker)
+
+	runJob(t, ts, r, http.MethodPost, "/servers", `{"name": "srv"}`)
+
+	resp := request(t, ts, http.MethodGet, "/servers/srv/export", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+
+	if got := resp.Header.Get("Content-Disposition"); got != `attachment; filename="srv.mcworld"` {
+		t.Errorf("unexpected Content-Disposition: %s", got)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("exported world is not a zip file: %s", err)
+	}
+
+	if len(zr.File) == 0 {
+		t.Errorf("exported world is empty")
+	}
+
+	if b, _ := d.Container("srv"); b.Held() {
+		t.Errorf("saving was not resumed after exporting")
+	}
+}
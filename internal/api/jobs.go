@@ -0,0 +1,29 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func (h *Handler) listJobs(w http.ResponseWriter, _ *http.Request, _ []string) error {
+	writeJSON(w, http.StatusOK, h.jobs.Records())
+
+	return nil
+}
+
+func (h *Handler) getJob(w http.ResponseWriter, _ *http.Request, params []string) error {
+	id, err := jobID(params[0])
+	if err != nil {
+		return err
+	}
+
+	rec, ok := h.jobs.Record(id)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: fmt.Sprintf("job %d not found", id)})
+		return nil
+	}
+
+	writeJSON(w, http.StatusOK, rec)
+
+	return nil
+}
@@ -0,0 +1,413 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danhale-git/craft/internal/logger"
+	"github.com/danhale-git/craft/server"
+)
+
+// runRequest is the body of a request to create and run a new server. The user and confinement of a server can't be
+// changed through the API.
+type runRequest struct {
+	Name       string            `json:"name"`
+	Port       int               `json:"port"`      // 0 auto-assigns a port
+	IPv6Port   int               `json:"ipv6_port"` // 0 doesn't publish the IPv6 port
+	BindIP     string            `json:"bind_ip"`
+	Network    string            `json:"network"`
+	NoVolume   bool              `json:"no_volume"` // World data is only saved when a backup is taken
+	Image      string            `json:"image"`
+	Tags       map[string]string `json:"tags"`
+	Properties map[string]string `json:"properties"` // server.properties values
+	Resources  server.Resources  `json:"resources"`
+}
+
+// startRequest is the body of a request to start a stopped server. Empty values use the saved configuration.
+type startRequest struct {
+	Port      int               `json:"port"`
+	IPv6Port  int               `json:"ipv6_port"`
+	BindIP    string            `json:"bind_ip"`
+	Network   string            `json:"network"`
+	Image     string            `json:"image"`
+	Tags      map[string]string `json:"tags"` // Added to the saved tags
+	Resources server.Resources  `json:"resources"`
+}
+
+// stopRequest is the body of a request to stop a server.
+type stopRequest struct {
+	Warn string `json:"warn"` // Duration of a countdown shown to players before the server stops e.g. 60s
+}
+
+// backupRequest is the body of a request to take a backup.
+type backupRequest struct {
+	Trim int `json:"trim"` // If more than 0, delete the oldest backups leaving this many
+}
+
+// trimRequest is the body of a request to delete old backups.
+type trimRequest struct {
+	Keep *int `json:"keep"` // Number of newest backups to keep, required
+}
+
+// trimResponse lists the backup files deleted by a trim request.
+type trimResponse struct {
+	Deleted []string `json:"deleted"`
+}
+
+// configureRequest is the body of a request to set server.properties values.
+type configureRequest struct {
+	Properties map[string]string `json:"properties"`
+}
+
+// commandRequest is the body of a request to run a command in the server cli.
+type commandRequest struct {
+	Command string `json:"command"`
+}
+
+// commandResponse is the output of a command. Error is set if the server reported that the command failed.
+type commandResponse struct {
+	server.Response
+	Error string `json:"error,omitempty"`
+}
+
+func (h *Handler) listServers(w http.ResponseWriter, r *http.Request, _ []string) error {
+	all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+
+	servers, err := h.manager.Servers(r.Context(), all)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, servers)
+
+	return nil
+}
+
+func (h *Handler) runServer(w http.ResponseWriter, r *http.Request, _ []string) error {
+	var req runRequest
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+
+	if req.Name == "" {
+		return fmt.Errorf("%w: name is required", errBadRequest)
+	}
+
+	if err := validateName(req.Name); err != nil {
+		return err
+	}
+
+	cfg := server.Config{
+		Port:      req.Port,
+		IPv6Port:  req.IPv6Port,
+		BindIP:    req.BindIP,
+		Network:   req.Network,
+		Volume:    !req.NoVolume,
+		Image:     req.Image,
+		Tags:      req.Tags,
+		Resources: req.Resources,
+	}
+
+	return h.startJob(w, req.Name, "run", func(ctx context.Context) error {
+		s, err := h.manager.NewServer(ctx, req.Name, cfg, properties(req.Properties), nil)
+		if err != nil {
+			return fmt.Errorf("creating server: %w", err)
+		}
+
+		if err = s.RunBedrock(ctx); err != nil {
+			return fmt.Errorf("starting server process: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (h *Handler) startServer(w http.ResponseWriter, r *http.Request, params []string) error {
+	name := params[0]
+
+	var req startRequest
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+
+	return h.startJob(w, name, "start", func(ctx context.Context) error {
+		s, err := h.manager.StartServer(ctx, name, server.Config{
+			Port:      req.Port,
+			IPv6Port:  req.IPv6Port,
+			BindIP:    req.BindIP,
+			Network:   req.Network,
+			Image:     req.Image,
+			Tags:      req.Tags,
+			Resources: req.Resources,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err = s.RunBedrock(ctx); err != nil {
+			return fmt.Errorf("starting server process: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (h *Handler) stopServer(w http.ResponseWriter, r *http.Request, params []string) error {
+	var req stopRequest
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+
+	var warn time.Duration
+
+	if req.Warn != "" {
+		var err error
+		if warn, err = time.ParseDuration(req.Warn); err != nil || warn < 0 {
+			return fmt.Errorf("%w: invalid warn duration '%s'", errBadRequest, req.Warn)
+		}
+	}
+
+	s, err := h.manager.GetServer(r.Context(), params[0])
+	if err != nil {
+		return err
+	}
+
+	return h.startJob(w, s.ContainerName, "stop", func(ctx context.Context) error {
+		if warn > 0 {
+			if err := s.WarnStop(ctx, warn); err != nil {
+				return fmt.Errorf("warning players: %w", err)
+			}
+		}
+
+		hasVolume, err := s.HasVolume(ctx)
+		if err != nil {
+			return err
+		}
+
+		if !hasVolume {
+			if _, err := h.manager.CopyBackup(ctx, s); err != nil {
+				return err
+			}
+		}
+
+		if err := h.manager.StopServer(ctx, s); err != nil {
+			return fmt.Errorf("stopping server: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (h *Handler) configureServer(w http.ResponseWriter, r *http.Request, params []string) error {
+	var req configureRequest
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+
+	if len(req.Properties) == 0 {
+		return fmt.Errorf("%w: properties are required", errBadRequest)
+	}
+
+	s, err := h.manager.GetServer(r.Context(), params[0])
+	if err != nil {
+		return err
+	}
+
+	_, err = h.jobs.Do(r.Context(), s.ContainerName+"-configure", s.ContainerName, func(ctx context.Context) error {
+		if err := h.manager.SetServerProperties(ctx, properties(req.Properties), s); err != nil {
+			return fmt.Errorf("setting server properties: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) command(w http.ResponseWriter, r *http.Request, params []string) error {
+	var req commandRequest
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(req.Command) == "" {
+		return fmt.Errorf("%w: command is required", errBadRequest)
+	}
+
+	s, err := h.manager.GetServer(r.Context(), params[0])
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Exec(r.Context(), req.Command)
+	if err != nil && !errors.Is(err, &server.CommandError{}) {
+		return err
+	}
+
+	// The output of a failed command is returned with the error
+	status := http.StatusOK
+	out := commandResponse{Response: resp}
+
+	if err != nil {
+		status = http.StatusUnprocessableEntity
+		out.Error = err.Error()
+	}
+
+	if out.Lines == nil {
+		out.Lines = make([]string, 0)
+	}
+
+	writeJSON(w, status, out)
+
+	return nil
+}
+
+// export writes the server's world to the response as a .mcworld file. The file is exported to a temporary directory
+// which is removed after it has been sent.
+func (h *Handler) export(w http.ResponseWriter, r *http.Request, params []string) error {
+	s, err := h.manager.GetServer(r.Context(), params[0])
+	if err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir("", "craft-export")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			logger.Error.Printf("removing exported world: %s", err)
+		}
+	}()
+
+	_, err = h.jobs.Do(r.Context(), s.ContainerName+"-export", s.ContainerName, func(ctx context.Context) error {
+		return h.manager.ExportMCWorld(ctx, s, dir)
+	})
+	if err != nil {
+		return err
+	}
+
+	fileName := fmt.Sprintf("%s.mcworld", s.ContainerName)
+
+	f, err := os.Open(filepath.Join(dir, fileName))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	http.ServeContent(w, r, fileName, info.ModTime(), f)
+
+	return nil
+}
+
+func (h *Handler) listBackups(w http.ResponseWriter, _ *http.Request, params []string) error {
+	backups, err := h.manager.Backups(params[0])
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, backups)
+
+	return nil
+}
+
+func (h *Handler) backup(w http.ResponseWriter, r *http.Request, params []string) error {
+	var req backupRequest
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+
+	if req.Trim < 0 {
+		return fmt.Errorf("%w: trim must not be negative", errBadRequest)
+	}
+
+	s, err := h.manager.GetServer(r.Context(), params[0])
+	if err != nil {
+		return err
+	}
+
+	return h.startJob(w, s.ContainerName, "backup", func(ctx context.Context) error {
+		fileName, err := h.manager.CopyBackup(ctx, s)
+		if err != nil {
+			return err
+		}
+
+		logger.Info.Printf("%s: created: %s", s.ContainerName, fileName)
+
+		if req.Trim > 0 {
+			if _, err := h.trim(s.ContainerName, req.Trim); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (h *Handler) trimBackups(w http.ResponseWriter, r *http.Request, params []string) error {
+	name := params[0]
+
+	var req trimRequest
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+
+	if req.Keep == nil || *req.Keep < 0 {
+		return fmt.Errorf("%w: keep is required and must not be negative", errBadRequest)
+	}
+
+	var deleted []string
+
+	_, err := h.jobs.Do(r.Context(), name+"-trim", name, func(ctx context.Context) error {
+		var err error
+		deleted, err = h.trim(name, *req.Keep)
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, trimResponse{Deleted: deleted})
+
+	return nil
+}
+
+// trim deletes the oldest backups of the named server, leaving the given count of newest backups.
+func (h *Handler) trim(name string, keep int) ([]string, error) {
+	deleted, err := h.manager.TrimBackups(name, keep, nil)
+	if err != nil {
+		return nil, fmt.Errorf("trimming old backup files: %w", err)
+	}
+
+	if deleted == nil {
+		deleted = make([]string, 0)
+	}
+
+	if len(deleted) > 0 {
+		logger.Info.Printf("%s: deleted: %s", name, strings.Join(deleted, " "))
+	}
+
+	return deleted, nil
+}
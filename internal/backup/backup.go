@@ -4,31 +4,38 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"bufio"
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/danhale-git/craft/internal/files"
+	"github.com/danhale-git/craft/mclog"
 
 	docker "github.com/docker/docker/api/types"
 
 	"github.com/docker/docker/client"
-
-	"github.com/danhale-git/craft/internal/logger"
 )
 
 const (
-	saveQueryRetries = 100 // The number of times save query can run without the expected response
-	saveQueryDelayMS = 100 // The delay between save query retries, in milliseconds
+	DefaultSaveRetries = 100                    // The number of times save query can run without the expected response
+	DefaultSaveDelay   = 100 * time.Millisecond // The delay between save query retries
 
 	FileNameTimeLayout = "15-04_02-01-2006" // The format of the file timestamp for the Go time package formatter
 )
 
+var (
+	// ErrSaveHoldTimeout is returned when the server doesn't report that files are ready to be copied after the
+	// maximum number of `save query` retries.
+	ErrSaveHoldTimeout = errors.New("timed out waiting for save hold")
+
+	// ErrUnexpectedResponse is returned when the server cli responds to a command with an unexpected message.
+	ErrUnexpectedResponse = errors.New("unexpected response")
+)
+
 // FileTime returns the time.Time the backup was taken, given the file name.
 func FileTime(name string) (time.Time, error) {
 	split := strings.SplitN(name, "_", 2)
@@ -40,11 +47,7 @@ func FileTime(name string) (time.Time, error) {
 
 	t, err := time.Parse(FileNameTimeLayout, backupTime)
 	if err != nil {
-		if _, ok := err.(*time.ParseError); ok {
-			return time.Time{}, err
-		}
-
-		panic(err)
+		return time.Time{}, err
 	}
 
 	return t, nil
@@ -52,143 +55,253 @@ func FileTime(name string) (time.Time, error) {
 
 // Restore reads from the given zip.ReadCloser, copying each of the files to the directory containing the server
 // files.
-func Restore(zr *zip.Reader, containerID string, dc client.ContainerAPIClient) error {
-	for _, f := range zr.File {
-		if err := restoreFile(f, files.Directory, containerID, dc); err != nil {
-			return fmt.Errorf("restoring %s: %s", f.Name, err)
-		}
+func Restore(ctx context.Context, zr *zip.Reader, containerID string, dc client.ContainerAPIClient) error {
+	return restore(ctx, zr, files.Directory, containerID, dc)
+}
+
+// RestoreMCWorld reads from the given zip.Reader, copying each of the files to the default world directory.
+func RestoreMCWorld(ctx context.Context, zr *zip.Reader, containerID string, dc client.ContainerAPIClient) error {
+	return restore(ctx, zr, files.FullPaths.DefaultWorld, containerID, dc)
+}
+
+// restore streams every file in the zip archive to the container as a single tar archive which is extracted at dest.
+// Missing parent directories are created by docker when the archive is extracted.
+func restore(ctx context.Context, zr *zip.Reader, dest string, containerID string, dc client.ContainerAPIClient) error {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+
+	go func() {
+		err := writeTar(zr, pw)
+		_ = pw.CloseWithError(err)
+		done <- err
+	}()
+
+	err := dc.CopyToContainer(
+		ctx,
+		containerID,
+		dest,
+		pr,
+		// Files are owned by the container's user, which may not be root
+		docker.CopyToContainerOptions{CopyUIDGID: true},
+	)
+
+	// Unblock the writer if the copy returned before reading the whole archive
+	_ = pr.Close()
+
+	if tarErr := <-done; tarErr != nil && tarErr != io.ErrClosedPipe {
+		return tarErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("copying files to '%s': %s", dest, err)
 	}
 
 	return nil
 }
 
-// RestoreMCWorld reads from the given zip.Reader, copying each of the files to the default world directory.
-func RestoreMCWorld(zr *zip.Reader, containerID string, dc client.ContainerAPIClient) error {
+// writeTar converts the zip archive to a tar archive, streaming each file to w.
+func writeTar(zr *zip.Reader, w io.Writer) error {
+	tw := tar.NewWriter(w)
+
 	for _, f := range zr.File {
-		if err := restoreFile(f, files.FullPaths.DefaultWorld, containerID, dc); err != nil {
+		if err := addZipFileToTar(f, tw); err != nil {
 			return fmt.Errorf("restoring %s: %s", f.Name, err)
 		}
 	}
 
-	return nil
+	return tw.Close()
 }
 
-func restoreFile(f *zip.File, dest string, containerID string, dc client.ContainerAPIClient) error {
-	var data bytes.Buffer
-	tw := tar.NewWriter(&data)
-
-	file, err := f.Open()
-	if err != nil {
-		return err
+func addZipFileToTar(f *zip.File, tw *tar.Writer) error {
+	if f.FileInfo().IsDir() {
+		return tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     f.Name,
+			Mode:     0755,
+			ModTime:  f.Modified,
+		})
 	}
 
-	b, err := ioutil.ReadAll(file)
-	if err != nil {
-		return err
-	}
-
-	// Create tar file
-	name := filepath.Base(f.Name)
-	dir := filepath.Dir(f.Name)
-
 	hdr := &tar.Header{
-		Name: name,
-		Size: int64(len(b)),
+		Name:    f.Name,
+		Mode:    0644,
+		Size:    int64(f.UncompressedSize64),
+		ModTime: f.Modified,
 	}
 	if err := tw.WriteHeader(hdr); err != nil {
 		return err
 	}
 
-	if _, err := tw.Write(b); err != nil {
+	file, err := f.Open()
+	if err != nil {
 		return err
 	}
 
-	// Close zipped file and tar writer
-	if err = file.Close(); err != nil {
+	if _, err := io.Copy(tw, file); err != nil {
+		_ = file.Close()
 		return err
 	}
 
-	if err = tw.Close(); err != nil {
-		return err
+	return file.Close()
+}
+
+// File is a world file reported by the `save query` command. Path is relative to the worlds directory and Length is
+// the number of bytes which must be copied. Bedrock may still be appending to a file while saving is held, so files
+// must be truncated to Length to produce a consistent backup.
+type File struct {
+	Path   string
+	Length int64
+}
+
+// SaveOptions configures how long SaveHoldQuery waits for world files to be ready to copy.
+type SaveOptions struct {
+	Retries int           // The number of times `save query` is run before giving up, DefaultSaveRetries if zero
+	Delay   time.Duration // The delay before each `save query`, DefaultSaveDelay if zero
+}
+
+func (o SaveOptions) retries() int {
+	if o.Retries == 0 {
+		return DefaultSaveRetries
 	}
 
-	return dc.CopyToContainer(
-		context.Background(),
-		containerID,
-		filepath.Join(dest, dir),
-		&data,
-		docker.CopyToContainerOptions{},
-	)
+	return o.Retries
+}
+
+func (o SaveOptions) delay() time.Duration {
+	if o.Delay == 0 {
+		return DefaultSaveDelay
+	}
+
+	return o.Delay
 }
 
 // SaveHoldQuery runs the `save hold` bedrock server command. It then repeatedly runs the `save query` command.
-// When the server is ready for world files to be copied, a list of suggested files to back up is returned. SaveResume
-// must be run after SaveHoldQuery.
-func SaveHoldQuery(command io.Writer, logs *bufio.Reader) ([]string, error) {
+// When the server is ready for world files to be copied, a list of files to back up and their lengths is returned.
+// Responses are found by scanning the logs, so other output such as players joining or chatting is ignored.
+// SaveResume must be run after SaveHoldQuery. Cancelling ctx stops the retries, logs should also be cancelled by ctx to
+// stop reads from blocking.
+func SaveHoldQuery(ctx context.Context, command io.Writer, logs *bufio.Reader, opts SaveOptions) ([]File, error) {
 	// `save hold`
-	runCommand("save hold", command, logs)
-
-	saveHoldResponse := readLine(logs)
-	if strings.TrimSpace(saveHoldResponse) != "Saving..." {
-		return nil, fmt.Errorf("unexpected response to `save hold`: '%s'", saveHoldResponse)
+	if _, err := runCommand(ctx, "save hold", command, logs, mclog.KindSaveHeld); err != nil {
+		return nil, err
 	}
 
 	// Query until ready for backups
-	for i := 0; i < saveQueryRetries; i++ {
-		time.Sleep(saveQueryDelayMS * time.Millisecond)
+	for i := 0; i < opts.retries(); i++ {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for `save query`: %w", ctx.Err())
+		case <-time.After(opts.delay()):
+		}
 
 		// `save query`
-		runCommand("save query", command, logs)
-
-		saveQueryResponse := readLine(logs)
+		e, err := runCommand(ctx, "save query", command, logs, mclog.KindSaveReady, mclog.KindSaveNotReady)
+		if err != nil {
+			return nil, err
+		}
 
 		// Ready for backup
-		if strings.HasPrefix(saveQueryResponse, "Data saved. Files are now ready to be copied.") {
-			worldFilesString := readLine(logs)
+		if e.Kind == mclog.KindSaveReady {
+			return readFiles(ctx, logs)
+		}
+	}
 
-			worldFiles := strings.Split(worldFilesString, ", ")
-			for i, f := range worldFiles {
-				worldFiles[i] = strings.Split(f, ":")[0]
-			}
+	return nil, fmt.Errorf("%w: exceeded %d retries of the 'save query' command", ErrSaveHoldTimeout, opts.retries())
+}
+
+// readFiles reads the list of files which follows the `save query` response reporting that files are ready to copy.
+// Lines which are not a list of files are ignored.
+func readFiles(ctx context.Context, logs *bufio.Reader) ([]File, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("reading `save query` file list: %w", err)
+		}
+
+		line, err := readLine(logs)
+		if err != nil {
+			return nil, fmt.Errorf("reading `save query` file list: %w", err)
+		}
+
+		if mclog.Parse(line).Level != mclog.LevelNone {
+			continue
+		}
 
+		if worldFiles, err := parseFiles(line); err == nil {
 			return worldFiles, nil
 		}
 	}
+}
+
+// parseFiles parses the list of files returned by `save query` in the format 'path:length, path:length'.
+func parseFiles(s string) ([]File, error) {
+	fields := strings.Split(strings.TrimSpace(s), ", ")
+	worldFiles := make([]File, len(fields))
 
-	return nil, fmt.Errorf("exceeded %d retries of the 'save query' command", saveQueryRetries)
+	for i, f := range fields {
+		sep := strings.LastIndex(f, ":")
+		if sep < 0 {
+			return nil, fmt.Errorf("%w: missing length for file '%s' in `save query` response", ErrUnexpectedResponse, f)
+		}
+
+		length, err := strconv.ParseInt(f[sep+1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid length for file '%s' in `save query` response: %s",
+				ErrUnexpectedResponse, f, err)
+		}
+
+		worldFiles[i] = File{Path: f[:sep], Length: length}
+	}
+
+	return worldFiles, nil
 }
 
 // SaveResume runs the `save resume` bedrock server command and validates the successful response. It must be run after
 // after every call to SaveHoldQuery.
 func SaveResume(command io.Writer, logs *bufio.Reader) error {
 	// `save resume`
-	runCommand("save resume", command, logs)
-
-	saveResumeResponse := readLine(logs)
-	if strings.TrimSpace(saveResumeResponse) != "Changes to the level are resumed." {
-		return fmt.Errorf("unexpected response to `save resume`: '%s'", saveResumeResponse)
-	}
+	_, err := runCommand(context.Background(), "save resume", command, logs, mclog.KindSaveResumed)
 
-	return nil
+	return err
 }
 
-func runCommand(cmd string, cli io.Writer, logs *bufio.Reader) {
+// runCommand writes the command to the server cli and scans the logs until a response of one of the given kinds is
+// found, which is returned. Other output is ignored. If the server reports a command error, an error wrapping
+// ErrUnexpectedResponse is returned.
+func runCommand(ctx context.Context, cmd string, cli io.Writer, logs *bufio.Reader, kinds ...mclog.Kind) (mclog.Event, error) { //nolint:lll
 	_, err := cli.Write([]byte(cmd + "\n"))
 	if err != nil {
-		logger.Error.Fatalf("backup.go: running command `%s`: %s", cmd, err)
+		return mclog.Event{}, fmt.Errorf("running command `%s`: %w", cmd, err)
 	}
 
-	// Read command echo to discard it
-	if _, err := logs.ReadString('\n'); err != nil {
-		logger.Error.Fatalf("backup.go: retrieving echo for command `%s`: %s", cmd, err)
+	for {
+		if err := ctx.Err(); err != nil {
+			return mclog.Event{}, fmt.Errorf("waiting for response to command `%s`: %w", cmd, err)
+		}
+
+		line, err := readLine(logs)
+		if err != nil {
+			return mclog.Event{}, fmt.Errorf("retrieving response to command `%s`: %w", cmd, err)
+		}
+
+		e := mclog.Parse(line)
+
+		if e.Kind == mclog.KindCommandError {
+			return e, fmt.Errorf("%w to `%s`: '%s'", ErrUnexpectedResponse, cmd, e.Message)
+		}
+
+		for _, k := range kinds {
+			if e.Kind == k {
+				return e, nil
+			}
+		}
 	}
 }
 
-func readLine(logs *bufio.Reader) string {
+func readLine(logs *bufio.Reader) (string, error) {
 	res, err := logs.ReadString('\n')
 	if err != nil {
-		logger.Error.Fatalf("backup.go: reading logs: %s", err)
+		return "", fmt.Errorf("reading logs: %w", err)
 	}
 
-	return res
+	return res, nil
 }
@@ -4,6 +4,8 @@ import (
 	"archive/zip"
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"sort"
 	"testing"
@@ -96,11 +98,11 @@ func TestRestore(t *testing.T) {
 	}
 }
 
-func testRestoreFunc(z *zip.Reader, restoreFunc func(*zip.Reader, string, client.ContainerAPIClient) error) ([]string, error) { //nolint:lll
+func testRestoreFunc(z *zip.Reader, restoreFunc func(context.Context, *zip.Reader, string, client.ContainerAPIClient) error) ([]string, error) { //nolint:lll
 	mockClient := &mock.DockerContainerClient{}
 	mockClient.CopyToFileNames = make([]string, 0)
 
-	if err := restoreFunc(z, "", mockClient); err != nil {
+	if err := restoreFunc(context.Background(), z, "", mockClient); err != nil {
 		return nil, fmt.Errorf("error returned when calling with valid input: %s", err)
 	}
 
@@ -149,13 +151,123 @@ Bedrock level/db/MANIFEST-000051:258, Bedrock level/db/000050.ldb:1281520, Bedro
 
 	bytes.NewBuffer([]byte{})
 
-	_, err := SaveHoldQuery(
+	got, err := SaveHoldQuery(
+		context.Background(),
 		bytes.NewBuffer([]byte{}),
 		bufio.NewReader(logs),
+		SaveOptions{},
 	)
 	if err != nil {
 		t.Errorf("error returned when calling with valid input: %s", err)
 	}
+
+	want := []File{
+		{Path: "Bedrock level/db/MANIFEST-000051", Length: 258},
+		{Path: "Bedrock level/db/000050.ldb", Length: 1281520},
+		{Path: "Bedrock level/db/000053.log", Length: 0},
+		{Path: "Bedrock level/db/000052.ldb", Length: 150713},
+		{Path: "Bedrock level/db/CURRENT", Length: 16},
+		{Path: "Bedrock level/level.dat", Length: 2209},
+		{Path: "Bedrock level/level.dat_old", Length: 2209},
+		{Path: "Bedrock level/levelname.txt", Length: 13},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("unexpected number of files: want %d: got %d", len(want), len(got))
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("unexpected file at index %d: want %+v: got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestSaveHoldQuery_UnexpectedResponse(t *testing.T) {
+	logs := bytes.NewReader([]byte(`save hold
+Unknown command: save. Please check that the command exists and that you have permission to use it.
+`))
+
+	_, err := SaveHoldQuery(
+		context.Background(),
+		bytes.NewBuffer([]byte{}),
+		bufio.NewReader(logs),
+		SaveOptions{},
+	)
+	if !errors.Is(err, ErrUnexpectedResponse) {
+		t.Errorf("unexpected error: want %s: got %v", ErrUnexpectedResponse, err)
+	}
+}
+
+func TestSaveHoldQuery_Cancelled(t *testing.T) {
+	logs := bytes.NewReader([]byte(`save hold
+Saving...
+`))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := SaveHoldQuery(
+		ctx,
+		bytes.NewBuffer([]byte{}),
+		bufio.NewReader(logs),
+		SaveOptions{},
+	)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error: want %s: got %v", context.Canceled, err)
+	}
+}
+
+func TestSaveHoldQuery_InterleavedOutput(t *testing.T) {
+	// Players join and chat while the backup is taken
+	logs := bytes.NewReader([]byte(`[INFO] Running AutoCompaction...
+save hold
+[2021-02-01 10:00:00:000 INFO] Player connected: Steve, xuid: 123
+Saving...
+save query
+A previous save has not been completed.
+save query
+[2021-02-01 10:00:01:000 INFO] Player disconnected: Alex, xuid: 456
+Data saved. Files are now ready to be copied.
+[2021-02-01 10:00:01:500 INFO] Player connected: Alex, xuid: 456
+Bedrock level/db/CURRENT:16, Bedrock level/level.dat:2209
+`))
+
+	got, err := SaveHoldQuery(
+		context.Background(),
+		bytes.NewBuffer([]byte{}),
+		bufio.NewReader(logs),
+		SaveOptions{Delay: time.Millisecond},
+	)
+	if err != nil {
+		t.Fatalf("error returned when unrelated output was logged: %s", err)
+	}
+
+	want := []File{{Path: "Bedrock level/db/CURRENT", Length: 16}, {Path: "Bedrock level/level.dat", Length: 2209}}
+
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("unexpected files: want %+v: got %+v", want, got)
+	}
+}
+
+func TestSaveHoldQuery_Retries(t *testing.T) {
+	logs := bytes.NewReader([]byte(`save hold
+Saving...
+save query
+A previous save has not been completed.
+save query
+A previous save has not been completed.
+`))
+
+	_, err := SaveHoldQuery(
+		context.Background(),
+		bytes.NewBuffer([]byte{}),
+		bufio.NewReader(logs),
+		SaveOptions{Retries: 2, Delay: time.Millisecond},
+	)
+	if !errors.Is(err, ErrSaveHoldTimeout) {
+		t.Errorf("unexpected error: want %s: got %v", ErrSaveHoldTimeout, err)
+	}
 }
 
 func TestSaveResume(t *testing.T) {
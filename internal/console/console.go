@@ -0,0 +1,407 @@
+// Package console implements a line editor for interactive sessions in a terminal which is in raw mode. Output can be
+// written above the line being edited while it is read.
+package console
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ErrInterrupt is returned by ReadLine when the user presses Ctrl-C.
+var ErrInterrupt = errors.New("interrupted")
+
+// Keys which are not printable characters. Control characters are their ASCII codes and escape sequences are given
+// values outside of the unicode range.
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyBackspace = 8
+	keyTab       = 9
+	keyLF        = 10
+	keyCtrlK     = 11
+	keyCR        = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+
+	keyUp = unicode.MaxRune + iota
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDeleteForward
+	keyUnknown
+)
+
+// Completer returns the possible completions of the last word of line, which is the text before the cursor.
+type Completer func(line string) []string
+
+// Editor reads lines typed by the user, with support for moving the cursor, editing, history and tab completion. The
+// terminal must be in raw mode so that input is not echoed or buffered.
+type Editor struct {
+	Prompt   string
+	History  *History  // Lines are added to the history when entered and can be recalled with the arrow keys, if not nil
+	Complete Completer // Called when tab is pressed, if not nil
+
+	in  *bufio.Reader
+	out io.Writer
+
+	mu      sync.Mutex
+	line    []rune
+	pos     int    // The cursor position in line
+	hist    int    // The index of the history line being edited, equal to the length of the history for a new line
+	saved   []rune // The new line, saved while browsing history
+	reading bool   // ReadLine is running and the prompt is shown
+	lastCR  bool   // The last key was a carriage return, so a following line feed is ignored
+}
+
+// New returns an Editor which reads keys from in and writes to out.
+func New(in io.Reader, out io.Writer, prompt string) *Editor {
+	return &Editor{
+		Prompt: prompt,
+		in:     bufio.NewReader(in),
+		out:    out,
+	}
+}
+
+// ReadLine shows the prompt and returns the line entered by the user. ErrInterrupt is returned if the user presses
+// Ctrl-C and io.EOF is returned if they press Ctrl-D on an empty line.
+func (e *Editor) ReadLine() (string, error) {
+	e.mu.Lock()
+	e.line, e.pos, e.saved = nil, 0, nil
+	e.hist = len(e.history())
+	e.reading = true
+	e.refresh()
+	e.mu.Unlock()
+
+	for {
+		k, err := e.readKey()
+		if err != nil {
+			e.stop()
+			return "", err
+		}
+
+		e.mu.Lock()
+		line, done, err := e.handle(k)
+		e.mu.Unlock()
+
+		if done {
+			e.stop()
+			return line, err
+		}
+	}
+}
+
+// stop ends the line and hides the prompt.
+func (e *Editor) stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.reading = false
+	e.write("\r\n")
+}
+
+// Clear hides the prompt and the line being edited. Any line being read is still returned by ReadLine.
+func (e *Editor) Clear() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.reading = false
+	e.write("\r\x1b[K")
+}
+
+// Println writes s above the line being edited.
+func (e *Editor) Println(s string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.write("\r\x1b[K" + strings.ReplaceAll(s, "\n", "\r\n") + "\r\n")
+
+	if e.reading {
+		e.refresh()
+	}
+}
+
+// handle applies the key to the line. If the line is complete it is returned with done set to true.
+func (e *Editor) handle(k rune) (line string, done bool, err error) {
+	lastCR := e.lastCR
+	e.lastCR = k == keyCR
+
+	switch k {
+	case keyCR, keyLF:
+		if k == keyLF && lastCR {
+			return "", false, nil
+		}
+
+		line = string(e.line)
+
+		if e.History != nil {
+			if err := e.History.Add(line); err != nil {
+				return line, true, fmt.Errorf("saving history: %w", err)
+			}
+		}
+
+		return line, true, nil
+	case keyCtrlC:
+		return "", true, ErrInterrupt
+	case keyCtrlD:
+		if len(e.line) == 0 {
+			return "", true, io.EOF
+		}
+
+		e.deleteForward()
+	case keyCtrlA, keyHome:
+		e.pos = 0
+	case keyCtrlE, keyEnd:
+		e.pos = len(e.line)
+	case keyCtrlB, keyLeft:
+		if e.pos > 0 {
+			e.pos--
+		}
+	case keyCtrlF, keyRight:
+		if e.pos < len(e.line) {
+			e.pos++
+		}
+	case keyBackspace, keyDelete:
+		if e.pos > 0 {
+			e.line = append(e.line[:e.pos-1], e.line[e.pos:]...)
+			e.pos--
+		}
+	case keyDeleteForward:
+		e.deleteForward()
+	case keyCtrlK:
+		e.line = e.line[:e.pos]
+	case keyCtrlU:
+		e.line = append([]rune{}, e.line[e.pos:]...)
+		e.pos = 0
+	case keyCtrlW:
+		start := wordStart(e.line, e.pos)
+		e.line = append(e.line[:start], e.line[e.pos:]...)
+		e.pos = start
+	case keyCtrlP, keyUp:
+		e.previous()
+	case keyCtrlN, keyDown:
+		e.next()
+	case keyTab:
+		e.complete()
+	default:
+		if k > unicode.MaxRune || !unicode.IsPrint(k) {
+			return "", false, nil
+		}
+
+		e.line = append(e.line[:e.pos], append([]rune{k}, e.line[e.pos:]...)...)
+		e.pos++
+	}
+
+	e.refresh()
+
+	return "", false, nil
+}
+
+func (e *Editor) deleteForward() {
+	if e.pos < len(e.line) {
+		e.line = append(e.line[:e.pos], e.line[e.pos+1:]...)
+	}
+}
+
+// previous replaces the line with the previous line in the history.
+func (e *Editor) previous() {
+	h := e.history()
+	if e.hist == 0 {
+		return
+	}
+
+	if e.hist == len(h) {
+		e.saved = e.line
+	}
+
+	e.hist--
+	e.setLine([]rune(h[e.hist]))
+}
+
+// next replaces the line with the next line in the history, or the new line if there are no more.
+func (e *Editor) next() {
+	h := e.history()
+	if e.hist >= len(h) {
+		return
+	}
+
+	e.hist++
+
+	if e.hist == len(h) {
+		e.setLine(e.saved)
+		return
+	}
+
+	e.setLine([]rune(h[e.hist]))
+}
+
+func (e *Editor) setLine(l []rune) {
+	e.line = append([]rune{}, l...)
+	e.pos = len(e.line)
+}
+
+func (e *Editor) history() []string {
+	if e.History == nil {
+		return nil
+	}
+
+	return e.History.Lines()
+}
+
+// complete replaces the word before the cursor with its completion. If there are multiple possible completions, the
+// word is extended to their longest common prefix. If it can't be extended, the possible completions are printed.
+func (e *Editor) complete() {
+	if e.Complete == nil {
+		return
+	}
+
+	start := e.pos
+	for start > 0 && e.line[start-1] != ' ' {
+		start--
+	}
+
+	word := string(e.line[start:e.pos])
+
+	candidates := e.Complete(string(e.line[:e.pos]))
+
+	var completion string
+
+	switch len(candidates) {
+	case 0:
+		return
+	case 1:
+		completion = candidates[0] + " "
+	default:
+		completion = commonPrefix(candidates)
+
+		if len(completion) <= len(word) {
+			sorted := append([]string{}, candidates...)
+			sort.Strings(sorted)
+
+			e.write("\r\x1b[K" + strings.Join(sorted, "  ") + "\r\n")
+
+			return
+		}
+	}
+
+	tail := append([]rune{}, e.line[e.pos:]...)
+	e.line = append(append(e.line[:start], []rune(completion)...), tail...)
+	e.pos = start + len([]rune(completion))
+}
+
+// refresh redraws the prompt and line and moves the cursor to its position.
+func (e *Editor) refresh() {
+	s := "\r\x1b[K" + e.Prompt + string(e.line)
+
+	if back := len(e.line) - e.pos; back > 0 {
+		s += fmt.Sprintf("\x1b[%dD", back)
+	}
+
+	e.write(s)
+}
+
+func (e *Editor) write(s string) {
+	// Errors writing to the terminal will also be returned by the next read
+	_, _ = io.WriteString(e.out, s)
+}
+
+// readKey reads a key press from the input. Escape sequences for special keys are read as a single key.
+func (e *Editor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != keyEscape {
+		return r, err
+	}
+
+	// Escape sequences begin with ESC [ or ESC O and end with a byte in the range 0x40 to 0x7e
+	b, err := e.in.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	if b != '[' && b != 'O' {
+		return keyUnknown, nil
+	}
+
+	params := make([]byte, 0)
+
+	for {
+		b, err = e.in.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		if b >= 0x40 && b <= 0x7e {
+			break
+		}
+
+		params = append(params, b)
+	}
+
+	switch b {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case 'C':
+		return keyRight, nil
+	case 'D':
+		return keyLeft, nil
+	case 'H':
+		return keyHome, nil
+	case 'F':
+		return keyEnd, nil
+	case '~':
+		switch string(params) {
+		case "1", "7":
+			return keyHome, nil
+		case "4", "8":
+			return keyEnd, nil
+		case "3":
+			return keyDeleteForward, nil
+		}
+	}
+
+	return keyUnknown, nil
+}
+
+// wordStart returns the index of the start of the word before pos, including any spaces between the word and pos.
+func wordStart(line []rune, pos int) int {
+	i := pos
+	for i > 0 && line[i-1] == ' ' {
+		i--
+	}
+
+	for i > 0 && line[i-1] != ' ' {
+		i--
+	}
+
+	return i
+}
+
+// commonPrefix returns the longest prefix shared by all of the strings.
+func commonPrefix(s []string) string {
+	prefix := []rune(s[0])
+
+	for _, c := range s[1:] {
+		for !strings.HasPrefix(c, string(prefix)) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	return string(prefix)
+}
@@ -0,0 +1,180 @@
+package console
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEditor_ReadLine(t *testing.T) {
+	cases := map[string]struct {
+		input string
+		want  string
+	}{
+		"plain":                 {input: "time set 0600\r", want: "time set 0600"},
+		"line feed":             {input: "list\n", want: "list"},
+		"backspace":             {input: "lisx\x7ft\r", want: "list"},
+		"left and insert":       {input: "lst\x1b[D\x1b[Di\r", want: "list"},
+		"home and end":          {input: "ist\x1b[Hl\x1b[F!\r", want: "list!"},
+		"ctrl-a and ctrl-e":     {input: "ist\x01l\x05!\r", want: "list!"},
+		"delete forward":        {input: "lixst\x1b[D\x1b[D\x1b[D\x1b[3~\r", want: "list"},
+		"ctrl-k":                {input: "list all\x1b[D\x1b[D\x1b[D\x1b[D\x0b\r", want: "list"},
+		"ctrl-u":                {input: "say hi\x1b[D\x1b[D\x15\r", want: "hi"},
+		"ctrl-w":                {input: "say hello there\x17\x17bye\r", want: "say bye"},
+		"unknown escape":        {input: "li\x1b[15~st\r", want: "list"},
+		"control characters":    {input: "li\x07st\r", want: "list"},
+		"crlf is a single line": {input: "list\r\n", want: "list"},
+	}
+
+	for name, tc := range cases {
+		e := New(strings.NewReader(tc.input), ioutil.Discard, "> ")
+
+		got, err := e.ReadLine()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+			continue
+		}
+
+		if got != tc.want {
+			t.Errorf("%s: want %q: got %q", name, tc.want, got)
+		}
+	}
+}
+
+func TestEditor_ReadLine_Detach(t *testing.T) {
+	e := New(strings.NewReader("list\x03"), ioutil.Discard, "> ")
+	if _, err := e.ReadLine(); !errors.Is(err, ErrInterrupt) {
+		t.Errorf("unexpected error for ctrl-c: want %s: got %v", ErrInterrupt, err)
+	}
+
+	e = New(strings.NewReader("\x04"), ioutil.Discard, "> ")
+	if _, err := e.ReadLine(); !errors.Is(err, io.EOF) {
+		t.Errorf("unexpected error for ctrl-d: want %s: got %v", io.EOF, err)
+	}
+
+	// Ctrl-D deletes forward on a line which isn't empty
+	e = New(strings.NewReader("lisxt\x1b[D\x1b[D\x04\r"), ioutil.Discard, "> ")
+	if got, err := e.ReadLine(); err != nil || got != "list" {
+		t.Errorf("unexpected result for ctrl-d: want 'list': got %q, %v", got, err)
+	}
+}
+
+func TestEditor_History(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h, err := LoadHistory(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := New(strings.NewReader("one\rtwo\rtwo\r\rthree\r\x1b[A\x1b[A\rpartial\x1b[A\x1b[B\r"), ioutil.Discard, "> ")
+	e.History = h
+
+	want := []string{"one", "two", "two", "", "three", "two", "partial"}
+
+	for i, w := range want {
+		got, err := e.ReadLine()
+		if err != nil {
+			t.Fatalf("line %d: unexpected error: %s", i, err)
+		}
+
+		if got != w {
+			t.Errorf("line %d: want %q: got %q", i, w, got)
+		}
+	}
+
+	// Repeated and empty lines are not saved and only the newest 3 lines are kept
+	if got, want := h.Lines(), []string{"three", "two", "partial"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected history: want %v: got %v", want, got)
+	}
+
+	loaded, err := LoadHistory(path, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := loaded.Lines(), []string{"three", "two", "partial"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected history loaded from file: want %v: got %v", want, got)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Count(string(data), "\n"); got != 3 {
+		t.Errorf("history file was not trimmed: want 3 lines: got %d", got)
+	}
+}
+
+func TestEditor_Complete(t *testing.T) {
+	complete := func(line string) []string {
+		words := []string{"time", "tell", "tellraw", "say"}
+		word := line[strings.LastIndex(line, " ")+1:]
+
+		matches := make([]string, 0)
+
+		for _, w := range words {
+			if strings.HasPrefix(w, word) {
+				matches = append(matches, w)
+			}
+		}
+
+		return matches
+	}
+
+	cases := map[string]struct {
+		input string
+		want  string
+	}{
+		"unique":          {input: "ti\tset\r", want: "time set"},
+		"common prefix":   {input: "te\traw\r", want: "tellraw"},
+		"no match":        {input: "x\t\r", want: "x"},
+		"later word":      {input: "say s\t\r", want: "say say "},
+		"before the tail": {input: "s 1\x1b[D\x1b[D\t\r", want: "say  1"},
+	}
+
+	for name, tc := range cases {
+		e := New(strings.NewReader(tc.input), ioutil.Discard, "> ")
+		e.Complete = complete
+
+		got, err := e.ReadLine()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+			continue
+		}
+
+		if got != tc.want {
+			t.Errorf("%s: want %q: got %q", name, tc.want, got)
+		}
+	}
+
+	// Ambiguous completions are printed
+	out := &bytes.Buffer{}
+	e := New(strings.NewReader("t\t\r"), out, "> ")
+	e.Complete = complete
+
+	if _, err := e.ReadLine(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "tell  tellraw  time") {
+		t.Errorf("possible completions were not printed: %q", out.String())
+	}
+}
+
+func TestEditor_Println(t *testing.T) {
+	out := &bytes.Buffer{}
+	e := New(strings.NewReader(""), out, "> ")
+
+	e.Println("a\nb")
+
+	if want := "\r\x1b[Ka\r\nb\r\n"; out.String() != want {
+		t.Errorf("unexpected output: want %q: got %q", want, out.String())
+	}
+}
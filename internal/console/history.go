@@ -0,0 +1,93 @@
+package console
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// History is a list of previously entered lines, oldest first, which is saved to a file.
+type History struct {
+	path  string
+	max   int
+	lines []string
+}
+
+// LoadHistory reads the history saved in the file at path, keeping only the newest max lines. The file is created when
+// the first line is added if it doesn't exist. If path is empty, the history is not saved.
+func LoadHistory(path string, max int) (*History, error) {
+	h := &History{path: path, max: max, lines: make([]string, 0)}
+
+	if path == "" {
+		return h, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.lines = append(h.lines, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading history file: %w", err)
+	}
+
+	if len(h.lines) <= max {
+		return h, nil
+	}
+
+	// Rewrite the file so it doesn't grow indefinitely
+	h.lines = h.lines[len(h.lines)-max:]
+
+	data := []byte(strings.Join(h.lines, "\n") + "\n")
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return nil, fmt.Errorf("trimming history file: %w", err)
+	}
+
+	return h, nil
+}
+
+// Add adds the line to the end of the history and appends it to the history file. Empty lines and lines which repeat
+// the last line are ignored.
+func (h *History) Add(line string) error {
+	if strings.TrimSpace(line) == "" || (len(h.lines) > 0 && h.lines[len(h.lines)-1] == line) {
+		return nil
+	}
+
+	h.lines = append(h.lines, line)
+	if len(h.lines) > h.max {
+		h.lines = h.lines[len(h.lines)-h.max:]
+	}
+
+	if h.path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Lines returns the lines in the history, oldest first.
+func (h *History) Lines() []string {
+	return h.lines
+}
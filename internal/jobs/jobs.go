@@ -0,0 +1,362 @@
+// Package jobs runs scheduled and one-off jobs in the background. Jobs which share a lock never run at the same time
+// and the result of each run is recorded in a history.
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Status of a job run.
+const (
+	StatusRunning = "running" // The job is running
+	StatusOK      = "ok"      // The job completed without error
+	StatusFailed  = "failed"  // The job returned an error
+	StatusSkipped = "skipped" // The job was due but not run because another job held its lock
+)
+
+// maxRecords is the number of records kept in memory. All records are kept in the history file.
+const maxRecords = 1000
+
+// ErrLocked is returned when a job can't be run because another job holds its lock.
+var ErrLocked = errors.New("another job is running")
+
+// Func is the work done by a job. It should return when ctx is cancelled.
+type Func func(ctx context.Context) error
+
+// Schedule returns the next time a job is due after the given time, or the zero time if it is never due again.
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+// Job is a function which is run on a schedule.
+type Job struct {
+	Name     string
+	Lock     string // Jobs with the same lock never run at the same time e.g. jobs for the same server
+	Schedule Schedule
+	Run      Func
+}
+
+// Record is the result of a job run. It is the schema for machine-readable output, fields may be added but existing
+// fields should not be changed or removed. Times are RFC3339.
+type Record struct {
+	ID     int    `json:"id" yaml:"id"` // Unique for the lifetime of the Runner and in its history file
+	Job    string `json:"job" yaml:"job"`
+	Status string `json:"status" yaml:"status"` // StatusRunning, StatusOK, StatusFailed or StatusSkipped
+	Start  string `json:"start" yaml:"start"`
+	End    string `json:"end,omitempty" yaml:"end,omitempty"`
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Runner runs jobs and records their results.
+type Runner struct {
+	HistoryFile string      // Finished records are appended to this file as JSON lines, if it is not empty
+	Log         *log.Logger // Successful runs are logged here, if not nil
+	ErrorLog    *log.Logger // Failed and skipped runs and errors writing the history are logged here, if not nil
+	Now         func() time.Time
+
+	mu      sync.Mutex
+	locks   map[string]bool
+	records []*Record
+	nextID  int
+	seeded  bool // nextID continues from the records in the history file
+	wg      sync.WaitGroup
+}
+
+// Run starts the function in the background and returns the record of the run. The context passed to fn is derived
+// from ctx and is cancelled when fn returns. If another job holds the lock, ErrLocked is returned with a skipped
+// record.
+func (r *Runner) Run(ctx context.Context, name, lock string, fn Func) (Record, error) {
+	rec, err := r.begin(name, lock)
+	if err != nil {
+		return *rec, err
+	}
+
+	// Copy the record before the job can update it
+	started := *rec
+
+	r.wg.Add(1)
+
+	go func() {
+		defer r.wg.Done()
+
+		r.end(rec, lock, call(ctx, fn))
+	}()
+
+	return started, nil
+}
+
+// Do runs the function and returns the record of the run when it returns, along with the function's error. The context
+// passed to fn is cancelled when fn returns. If another job holds the lock, ErrLocked is returned with a skipped record
+// and the function is not run.
+func (r *Runner) Do(ctx context.Context, name, lock string, fn Func) (Record, error) {
+	rec, err := r.begin(name, lock)
+	if err != nil {
+		return *rec, err
+	}
+
+	err = call(ctx, fn)
+
+	return r.end(rec, lock, err), err
+}
+
+// call runs fn with a context which is cancelled when it returns, so anything fn leaves running with the context, such
+// as a log stream, is closed.
+func call(ctx context.Context, fn Func) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	return fn(ctx)
+}
+
+// begin records the start of a run and takes the lock. If the lock is held, a skipped record is returned with
+// ErrLocked.
+func (r *Runner) begin(name, lock string) (*Record, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.locks == nil {
+		r.locks = make(map[string]bool)
+	}
+
+	if !r.seeded {
+		r.seedID()
+	}
+
+	r.nextID++
+	rec := &Record{ID: r.nextID, Job: name, Status: StatusRunning, Start: r.now().Format(time.RFC3339)}
+
+	if r.locks[lock] {
+		rec.Status = StatusSkipped
+		rec.End = rec.Start
+		rec.Error = fmt.Sprintf("%s: %s", ErrLocked, lock)
+
+		r.add(rec)
+		r.finish(rec)
+
+		return rec, fmt.Errorf("%w: %s", ErrLocked, lock)
+	}
+
+	r.locks[lock] = true
+	r.add(rec)
+
+	return rec, nil
+}
+
+// seedID sets nextID to the highest id in the history file so that ids are unique across runs of the program. r.mu
+// must be held.
+func (r *Runner) seedID() {
+	r.seeded = true
+
+	if r.HistoryFile == "" {
+		return
+	}
+
+	records, err := ReadHistory(r.HistoryFile)
+	if err != nil {
+		r.errorf("reading job history: %s", err)
+		return
+	}
+
+	for _, rec := range records {
+		if rec.ID > r.nextID {
+			r.nextID = rec.ID
+		}
+	}
+}
+
+// end records the result of a run which was started by begin and releases the lock.
+func (r *Runner) end(rec *Record, lock string, err error) Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.locks, lock)
+
+	rec.End = r.now().Format(time.RFC3339)
+	rec.Status = StatusOK
+
+	if err != nil {
+		rec.Status = StatusFailed
+		rec.Error = err.Error()
+	}
+
+	r.finish(rec)
+
+	return *rec
+}
+
+// Schedule runs each job when it is due until ctx is cancelled, then waits for running jobs to return. A job which is
+// due while it, or another job with the same lock, is still running is skipped.
+func (r *Runner) Schedule(ctx context.Context, jobs []Job) {
+	var wg sync.WaitGroup
+
+	for _, j := range jobs {
+		wg.Add(1)
+
+		go func(j Job) {
+			defer wg.Done()
+
+			r.schedule(ctx, j)
+		}(j)
+	}
+
+	wg.Wait()
+	r.Wait()
+}
+
+func (r *Runner) schedule(ctx context.Context, j Job) {
+	for {
+		next := j.Schedule.Next(time.Now())
+		if next.IsZero() {
+			r.errorf("%s: job will not run again", j.Name)
+			return
+		}
+
+		t := time.NewTimer(time.Until(next))
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return
+		}
+
+		// Errors are recorded in the history
+		_, _ = r.Run(ctx, j.Name, j.Lock, j.Run)
+	}
+}
+
+// Wait waits for all running jobs to return.
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// Records returns the records of recent and running jobs, oldest first.
+func (r *Runner) Records() []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	records := make([]Record, len(r.records))
+	for i, rec := range r.records {
+		records[i] = *rec
+	}
+
+	return records
+}
+
+// Record returns the record with the given id and false if it doesn't exist.
+func (r *Runner) Record(id int) (Record, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, rec := range r.records {
+		if rec.ID == id {
+			return *rec, true
+		}
+	}
+
+	return Record{}, false
+}
+
+func (r *Runner) add(rec *Record) {
+	r.records = append(r.records, rec)
+
+	if len(r.records) > maxRecords {
+		r.records = r.records[len(r.records)-maxRecords:]
+	}
+}
+
+// finish logs the result of a run and appends it to the history file. r.mu must be held.
+func (r *Runner) finish(rec *Record) {
+	if rec.Error != "" {
+		r.errorf("%s: %s: %s", rec.Job, rec.Status, rec.Error)
+	} else {
+		r.logf("%s: %s", rec.Job, rec.Status)
+	}
+
+	if r.HistoryFile == "" {
+		return
+	}
+
+	if err := appendRecord(r.HistoryFile, *rec); err != nil {
+		r.errorf("writing job history: %s", err)
+	}
+}
+
+func appendRecord(path string, rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644) //nolint:gosec
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// ReadHistory returns the records in a history file, oldest first. If the file doesn't exist, no records are returned.
+func ReadHistory(path string) ([]Record, error) {
+	records := make([]Record, 0)
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return records, nil
+		}
+
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+
+	for n := 1; scanner.Scan(); n++ {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("reading job history line %d: %w", n, err)
+		}
+
+		records = append(records, rec)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading job history: %w", err)
+	}
+
+	return records, nil
+}
+
+func (r *Runner) logf(format string, v ...interface{}) {
+	if r.Log != nil {
+		r.Log.Printf(format, v...)
+	}
+}
+
+func (r *Runner) errorf(format string, v ...interface{}) {
+	if r.ErrorLog != nil {
+		r.ErrorLog.Printf(format, v...)
+	}
+}
+
+func (r *Runner) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+
+	return time.Now()
+}
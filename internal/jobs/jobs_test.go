@@ -0,0 +1,250 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// every is a schedule which is due at a fixed interval.
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+func TestRunner_Run(t *testing.T) {
+	ctx := context.Background()
+	history := filepath.Join(t.TempDir(), "history.jsonl")
+
+	r := &Runner{HistoryFile: history}
+
+	release := make(chan struct{})
+
+	rec, err := r.Run(ctx, "backup", "srv", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error starting job: %s", err)
+	}
+
+	if rec.Status != StatusRunning {
+		t.Errorf("unexpected status for a running job: %s", rec.Status)
+	}
+
+	// Jobs with the same lock can't run at the same time
+	if _, err := r.Run(ctx, "restart", "srv", func(ctx context.Context) error { return nil }); !errors.Is(err, ErrLocked) {
+		t.Errorf("unexpected error starting a job with the same lock: want %s: got %v", ErrLocked, err)
+	}
+
+	other, err := r.Run(ctx, "other", "other-srv", func(ctx context.Context) error { return errors.New("failed") })
+	if err != nil {
+		t.Errorf("unexpected error starting a job with a different lock: %s", err)
+	}
+
+	close(release)
+	r.Wait()
+
+	want := map[string]string{"backup": StatusOK, "restart": StatusSkipped, "other": StatusFailed}
+
+	records := r.Records()
+	if len(records) != len(want) {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+
+	for _, rec := range records {
+		if rec.Status != want[rec.Job] {
+			t.Errorf("%s: unexpected status: want %s: got %s", rec.Job, want[rec.Job], rec.Status)
+		}
+	}
+
+	if got, ok := r.Record(other.ID); !ok || got.Error != "failed" {
+		t.Errorf("unexpected record for failed job: %+v", got)
+	}
+
+	saved, err := ReadHistory(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(saved) != len(want) {
+		t.Fatalf("unexpected history: %+v", saved)
+	}
+
+	for _, rec := range saved {
+		if rec.Status != want[rec.Job] || rec.End == "" {
+			t.Errorf("%s: unexpected record in history: %+v", rec.Job, rec)
+		}
+	}
+
+	// The lock is released when the job returns
+	if _, err := r.Run(ctx, "restart", "srv", func(ctx context.Context) error { return nil }); err != nil {
+		t.Errorf("unexpected error starting a job after the lock was released: %s", err)
+	}
+
+	r.Wait()
+}
+
+func TestRunner_Run_HistoryIDs(t *testing.T) {
+	ctx := context.Background()
+	history := filepath.Join(t.TempDir(), "history.jsonl")
+
+	// Each Runner is a run of the program which appends to the same history
+	for i := 0; i < 2; i++ {
+		r := &Runner{HistoryFile: history}
+
+		for _, lock := range []string{"a", "b"} {
+			if _, err := r.Do(ctx, "job", lock, func(ctx context.Context) error { return nil }); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	records, err := ReadHistory(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, rec := range records {
+		if rec.ID != i+1 {
+			t.Errorf("unexpected id of record %d in history: want %d: got %d", i, i+1, rec.ID)
+		}
+	}
+}
+
+func TestRunner_Do(t *testing.T) {
+	ctx := context.Background()
+	r := &Runner{}
+
+	release := make(chan struct{})
+
+	if _, err := r.Run(ctx, "backup", "srv", func(ctx context.Context) error {
+		<-release
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ran := false
+
+	rec, err := r.Do(ctx, "export", "srv", func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+	if !errors.Is(err, ErrLocked) || ran || rec.Status != StatusSkipped {
+		t.Errorf("unexpected result running a job with a held lock: ran %t: %+v, %v", ran, rec, err)
+	}
+
+	close(release)
+	r.Wait()
+
+	failed := errors.New("failed")
+
+	rec, err = r.Do(ctx, "export", "srv", func(ctx context.Context) error {
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("unexpected error: want %s: got %v", failed, err)
+	}
+
+	if rec.Status != StatusFailed || rec.End == "" || rec.Error != "failed" {
+		t.Errorf("unexpected record for a failed job: %+v", rec)
+	}
+
+	if _, err := r.Do(ctx, "export", "srv", func(ctx context.Context) error { return nil }); err != nil {
+		t.Errorf("the lock was not released after a failed job: %s", err)
+	}
+}
+
+func TestRunner_Run_Cancelled(t *testing.T) {
+	r := &Runner{}
+
+	jobCtx := make(chan context.Context, 1)
+
+	fn := func(ctx context.Context) error {
+		jobCtx <- ctx
+		return nil
+	}
+
+	if _, err := r.Run(context.Background(), "backup", "srv", fn); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Wait()
+
+	if err := (<-jobCtx).Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("the context of a job run was not cancelled when it returned: %v", err)
+	}
+
+	if _, err := r.Do(context.Background(), "export", "srv", fn); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (<-jobCtx).Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("the context of a job done was not cancelled when it returned: %v", err)
+	}
+}
+
+func TestRunner_Schedule(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	r := &Runner{}
+
+	var fast, slow int32
+
+	r.Schedule(ctx, []Job{
+		{
+			Name:     "fast",
+			Lock:     "a",
+			Schedule: every(10 * time.Millisecond),
+			Run: func(ctx context.Context) error {
+				atomic.AddInt32(&fast, 1)
+				return nil
+			},
+		},
+		{
+			Name:     "slow",
+			Lock:     "b",
+			Schedule: every(10 * time.Millisecond),
+			Run: func(ctx context.Context) error {
+				atomic.AddInt32(&slow, 1)
+				<-ctx.Done()
+
+				return ctx.Err()
+			},
+		},
+	})
+
+	if n := atomic.LoadInt32(&fast); n < 5 {
+		t.Errorf("fast job ran %d times, expected at least 5", n)
+	}
+
+	// The slow job doesn't return until ctx is cancelled so it never runs again
+	if n := atomic.LoadInt32(&slow); n != 1 {
+		t.Errorf("slow job ran %d times, expected once", n)
+	}
+
+	skipped := 0
+
+	for _, rec := range r.Records() {
+		if rec.Job == "slow" && rec.Status == StatusSkipped {
+			skipped++
+		}
+	}
+
+	if skipped == 0 {
+		t.Errorf("overlapping runs of the slow job were not recorded as skipped")
+	}
+}
+
+func TestReadHistory_NotExist(t *testing.T) {
+	records, err := ReadHistory(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil || len(records) != 0 {
+		t.Errorf("unexpected result for missing history file: %v, %v", records, err)
+	}
+}
@@ -11,12 +11,12 @@ import (
 	rotatelogs "github.com/lestrrat/go-file-rotatelogs"
 )
 
-// Global loggers
+// Global loggers. Output is discarded until Init is called.
 //nolint:gochecknoglobals
 var (
-	Info  *log.Logger
-	Warn  *log.Logger
-	Error *log.Logger
+	Info  = log.New(ioutil.Discard, "", 0)
+	Warn  = log.New(ioutil.Discard, "", 0)
+	Error = log.New(ioutil.Discard, "", 0)
 )
 
 // Init creates loggers
@@ -0,0 +1,343 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/danhale-git/craft/craft"
+	"github.com/danhale-git/craft/mclog"
+	"github.com/danhale-git/craft/server"
+	docker "github.com/docker/docker/api/types"
+)
+
+// serverLabel is the label added to every sample, its value is the server name.
+const serverLabel = "server"
+
+// DefaultPlayersInterval is the default minimum time between counting the players of a server.
+const DefaultPlayersInterval = 30 * time.Second
+
+// Collector collects metrics about each running and stopped server.
+type Collector struct {
+	Manager  *craft.Manager
+	ErrorLog *log.Logger // Errors collecting some of a server's metrics are logged here, if not nil
+	Now      func() time.Time
+
+	// PlayersInterval is the minimum time between counting the players of a server, DefaultPlayersInterval if zero.
+	// Collections in between report the last count.
+	PlayersInterval time.Duration
+
+	mu      sync.Mutex
+	players map[string]playerCount // Last count of each server's players
+}
+
+// playerCount is the result of counting a server's players.
+type playerCount struct {
+	online, slots int
+	time          time.Time
+}
+
+// serverMetrics are the values collected for one server. Values which could not be collected are nil.
+type serverMetrics struct {
+	name    string
+	up      bool
+	players *int
+	slots   *int     // Maximum number of players
+	cpu     *float64 // Seconds
+	memory  *float64 // Bytes
+	limit   *float64 // Bytes
+	uptime  *float64 // Seconds
+	backups *craft.BackupStats
+	newest  *craft.BackupInfo // Newest backup file, used if the stats have no successful backup
+}
+
+// Collect returns the metrics of every server. Metrics of running servers are collected at the same time. Players are
+// counted by running `list` in each running server, at most once per PlayersInterval. If a metric can't be collected
+// for a server, the error is logged and the metric is left out for that server.
+func (c *Collector) Collect(ctx context.Context) ([]Family, error) {
+	infos, err := c.Manager.Servers(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	servers := make([]serverMetrics, len(infos))
+
+	var wg sync.WaitGroup
+
+	for i, info := range infos {
+		servers[i] = serverMetrics{name: info.Name, up: info.State == craft.StateRunning}
+
+		stats, err := c.Manager.BackupStats(info.Name)
+		if err != nil {
+			c.errorf("%s: reading backup stats: %s", info.Name, err)
+		} else {
+			servers[i].backups = &stats
+		}
+
+		// Backups taken before stats were recorded
+		if err == nil && stats.LastSuccess == "" {
+			if servers[i].newest, err = c.newestBackup(info.Name); err != nil {
+				c.errorf("%s: reading backups: %s", info.Name, err)
+			}
+		}
+
+		if !servers[i].up {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(sm *serverMetrics) {
+			defer wg.Done()
+
+			c.collectServer(ctx, sm)
+		}(&servers[i])
+	}
+
+	wg.Wait()
+
+	return families(servers), nil
+}
+
+// collectServer sets the metrics of a running server which come from its container and server process.
+func (c *Collector) collectServer(ctx context.Context, sm *serverMetrics) {
+	s, err := c.Manager.GetServer(ctx, sm.name)
+	if err != nil {
+		c.errorf("%s: %s", sm.name, err)
+		return
+	}
+
+	if err := c.containerStats(ctx, s, sm); err != nil {
+		c.errorf("%s: getting container stats: %s", sm.name, err)
+	}
+
+	if err := c.uptime(ctx, s, sm); err != nil {
+		c.errorf("%s: getting uptime: %s", sm.name, err)
+	}
+
+	if err := c.countPlayers(ctx, s, sm); err != nil {
+		c.errorf("%s: counting players: %s", sm.name, err)
+	}
+}
+
+// newestBackup returns the newest backup file of the named server, or nil if it has none.
+func (c *Collector) newestBackup(name string) (*craft.BackupInfo, error) {
+	backups, err := c.Manager.Backups(name)
+	if err != nil || len(backups) == 0 {
+		return nil, err
+	}
+
+	return &backups[len(backups)-1], nil
+}
+
+// countPlayers sets the number of online players and the maximum number of players. The last count is used if it was
+// taken less than PlayersInterval ago.
+func (c *Collector) countPlayers(ctx context.Context, s *server.Server, sm *serverMetrics) error {
+	interval := c.PlayersInterval
+	if interval == 0 {
+		interval = DefaultPlayersInterval
+	}
+
+	now := c.now()
+
+	c.mu.Lock()
+	last, ok := c.players[sm.name]
+	c.mu.Unlock()
+
+	if ok && now.Sub(last.time) < interval {
+		sm.players, sm.slots = &last.online, &last.slots
+		return nil
+	}
+
+	if err := players(ctx, s, sm); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.players == nil {
+		c.players = make(map[string]playerCount)
+	}
+
+	c.players[sm.name] = playerCount{online: *sm.players, slots: *sm.slots, time: now}
+
+	return nil
+}
+
+func (c *Collector) containerStats(ctx context.Context, s *server.Server, sm *serverMetrics) error {
+	resp, err := s.ContainerStats(ctx, s.ContainerID, false)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var stats docker.StatsJSON
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return err
+	}
+
+	cpu := float64(stats.CPUStats.CPUUsage.TotalUsage) / float64(time.Second)
+	memory := float64(memoryUsage(stats.MemoryStats))
+	limit := float64(stats.MemoryStats.Limit)
+
+	sm.cpu, sm.memory, sm.limit = &cpu, &memory, &limit
+
+	return nil
+}
+
+// memoryUsage returns the memory used by a container. As in `docker stats`, inactive page cache is not counted because
+// it can be reclaimed.
+func memoryUsage(m docker.MemoryStats) uint64 {
+	// cgroup v1 and v2 respectively
+	for _, k := range []string{"total_inactive_file", "inactive_file"} {
+		if v, ok := m.Stats[k]; ok && v < m.Usage {
+			return m.Usage - v
+		}
+	}
+
+	return m.Usage
+}
+
+func (c *Collector) uptime(ctx context.Context, s *server.Server, sm *serverMetrics) error {
+	inspect, err := s.ContainerInspect(ctx, s.ContainerID)
+	if err != nil {
+		return err
+	}
+
+	started, err := time.Parse(time.RFC3339Nano, inspect.State.StartedAt)
+	if err != nil {
+		return fmt.Errorf("parsing start time: %w", err)
+	}
+
+	uptime := c.now().Sub(started).Seconds()
+	sm.uptime = &uptime
+
+	return nil
+}
+
+// players runs `list` in the server cli and sets the number of online players and the maximum number of players.
+func players(ctx context.Context, s *server.Server, sm *serverMetrics) error {
+	resp, err := s.Exec(ctx, "list")
+	if err != nil {
+		return err
+	}
+
+	for _, l := range resp.Lines {
+		e := mclog.Parse(l)
+		if e.Kind != mclog.KindPlayerList {
+			continue
+		}
+
+		var online, slots int
+		if _, err := fmt.Sscanf(e.Value, "%d/%d", &online, &slots); err != nil {
+			return fmt.Errorf("parsing player count '%s': %w", e.Value, err)
+		}
+
+		sm.players, sm.slots = &online, &slots
+
+		return nil
+	}
+
+	return fmt.Errorf("no player count in the output of 'list'")
+}
+
+// families returns the metric families for the collected values, with samples in the order of servers.
+func families(servers []serverMetrics) []Family {
+	up := Family{Name: "craft_server_up", Type: TypeGauge,
+		Help: "Whether the server's container is running (1) or not (0)."}
+	players := Family{Name: "craft_server_players_online", Type: TypeGauge,
+		Help: "Number of players connected to the server."}
+	maxPlayers := Family{Name: "craft_server_players_max", Type: TypeGauge,
+		Help: "Maximum number of players who can connect to the server."}
+	cpu := Family{Name: "craft_server_cpu_seconds_total", Type: TypeCounter,
+		Help: "CPU time used by the server's container since it started, in seconds."}
+	memory := Family{Name: "craft_server_memory_bytes", Type: TypeGauge,
+		Help: "Memory used by the server's container, excluding inactive page cache."}
+	limit := Family{Name: "craft_server_memory_limit_bytes", Type: TypeGauge,
+		Help: "Memory limit of the server's container, the host's memory if it has no limit."}
+	uptime := Family{Name: "craft_server_uptime_seconds", Type: TypeGauge,
+		Help: "Time since the server's container started, in seconds."}
+	lastSuccess := Family{Name: "craft_backup_last_success_timestamp_seconds", Type: TypeGauge,
+		Help: "Unix time the last successful backup of the server finished."}
+	duration := Family{Name: "craft_backup_last_duration_seconds", Type: TypeGauge,
+		Help: "Time taken by the last successful backup of the server, in seconds."}
+	size := Family{Name: "craft_backup_last_size_bytes", Type: TypeGauge,
+		Help: "Size of the file written by the last successful backup of the server."}
+	successes := Family{Name: "craft_backup_successes_total", Type: TypeCounter,
+		Help: "Number of successful backups of the server."}
+	failures := Family{Name: "craft_backup_failures_total", Type: TypeCounter,
+		Help: "Number of failed backups of the server."}
+
+	for _, sm := range servers {
+		labels := []Label{{Name: serverLabel, Value: sm.name}}
+
+		add := func(f *Family, v float64) {
+			f.Samples = append(f.Samples, Sample{Labels: labels, Value: v})
+		}
+
+		addInt := func(f *Family, v *int) {
+			if v != nil {
+				add(f, float64(*v))
+			}
+		}
+
+		addFloat := func(f *Family, v *float64) {
+			if v != nil {
+				add(f, *v)
+			}
+		}
+
+		if sm.up {
+			add(&up, 1)
+		} else {
+			add(&up, 0)
+		}
+
+		addInt(&players, sm.players)
+		addInt(&maxPlayers, sm.slots)
+		addFloat(&cpu, sm.cpu)
+		addFloat(&memory, sm.memory)
+		addFloat(&limit, sm.limit)
+		addFloat(&uptime, sm.uptime)
+
+		if b := sm.backups; b != nil {
+			if t, err := time.Parse(time.RFC3339, b.LastSuccess); err == nil {
+				add(&lastSuccess, float64(t.Unix()))
+				add(&duration, b.LastDuration)
+				add(&size, float64(b.LastSize))
+			} else if n := sm.newest; n != nil {
+				// The duration of a backup is only known from the stats
+				if t, err := time.Parse(time.RFC3339, n.Time); err == nil {
+					add(&lastSuccess, float64(t.Unix()))
+					add(&size, float64(n.Size))
+				}
+			}
+
+			add(&successes, float64(b.Successes))
+			add(&failures, float64(b.Failures))
+		}
+	}
+
+	return []Family{
+		up, players, maxPlayers, cpu, memory, limit, uptime,
+		lastSuccess, duration, size, successes, failures,
+	}
+}
+
+func (c *Collector) errorf(format string, v ...interface{}) {
+	if c.ErrorLog != nil {
+		c.ErrorLog.Printf(format, v...)
+	}
+}
+
+func (c *Collector) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+
+	return time.Now()
+}
@@ -0,0 +1,94 @@
+// Package metrics collects metrics about craft servers and their backups and writes them in the Prometheus text
+// exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the content type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metric types.
+const (
+	TypeGauge   = "gauge"
+	TypeCounter = "counter"
+)
+
+// Family is a named metric and its samples.
+type Family struct {
+	Name    string
+	Help    string
+	Type    string // TypeGauge or TypeCounter
+	Samples []Sample
+}
+
+// Sample is a value of a metric with a set of labels.
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// Label is the name and value of a sample label.
+type Label struct {
+	Name, Value string
+}
+
+// Write writes the families to w in the Prometheus text exposition format. Families with no samples are not written.
+func Write(w io.Writer, families []Family) error {
+	bw := bufio.NewWriter(w)
+
+	for _, f := range families {
+		if len(f.Samples) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.Name, escapeHelp(f.Help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.Name, f.Type)
+
+		for _, s := range f.Samples {
+			bw.WriteString(f.Name)
+
+			if len(s.Labels) > 0 {
+				labels := make([]string, len(s.Labels))
+				for i, l := range s.Labels {
+					labels[i] = fmt.Sprintf(`%s="%s"`, l.Name, escapeLabel(l.Value))
+				}
+
+				fmt.Fprintf(bw, "{%s}", strings.Join(labels, ","))
+			}
+
+			fmt.Fprintf(bw, " %s\n", formatValue(s.Value))
+		}
+	}
+
+	return bw.Flush()
+}
+
+// escapeHelp escapes backslashes and line feeds in help text.
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+// escapeLabel escapes backslashes, double quotes and line feeds in a label value.
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danhale-git/craft/craft"
+	"github.com/danhale-git/craft/internal/mock"
+	"github.com/danhale-git/craft/server"
+)
+
+func TestWrite(t *testing.T) {
+	families := []Family{
+		{
+			Name: "test_gauge",
+			Help: "A gauge.\nWith a \\ backslash.",
+			Type: TypeGauge,
+			Samples: []Sample{
+				{Labels: []Label{{"server", "a"}}, Value: 1.5},
+				{Labels: []Label{{"server", "b \"quoted\"\n"}, {"other", `\`}}, Value: math.Inf(1)},
+				{Value: math.NaN()},
+			},
+		},
+		{Name: "test_empty", Help: "Not written.", Type: TypeCounter},
+		{
+			Name:    "test_counter_total",
+			Help:    "A counter.",
+			Type:    TypeCounter,
+			Samples: []Sample{{Labels: []Label{{"server", "a"}}, Value: 1e6}},
+		},
+	}
+
+	want := `# HELP test_gauge A gauge.\nWith a \\ backslash.
+# TYPE test_gauge gauge
+test_gauge{server="a"} 1.5
+test_gauge{server="b \"quoted\"\n",other="\\"} +Inf
+test_gauge NaN
+# HELP test_counter_total A counter.
+# TYPE test_counter_total counter
+test_counter_total{server="a"} 1e+06
+`
+
+	var buf bytes.Buffer
+	if err := Write(&buf, families); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected output:\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestCollector_Collect(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	d := mock.NewDocker(server.ImageName)
+	m := &craft.Manager{Client: d, BackupDir: t.TempDir(), Now: time.Now}
+
+	for _, name := range []string{"running", "stopped"} {
+		s, err := m.NewServer(ctx, name, server.Config{}, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = s.RunBedrock(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := m.CopyBackup(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stopped, err := m.GetServer(ctx, "stopped")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.StopServer(ctx, stopped); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := d.Container("running")
+	b.Connect("Steve", "1234")
+
+	// A server with a backup taken before backup stats were recorded
+	old := "old_10-00_01-02-2021.zip"
+	if err := os.MkdirAll(filepath.Join(m.BackupDir, "old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(m.BackupDir, "old", old), []byte("zip"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Add(time.Minute)
+	c := &Collector{Manager: m, Now: func() time.Time { return now }}
+
+	families, err := c.Collect(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got := make(map[string]float64)
+
+	for _, f := range families {
+		for _, s := range f.Samples {
+			got[f.Name+"/"+s.Labels[0].Value] = s.Value
+		}
+	}
+
+	want := map[string]float64{
+		"craft_server_up/running":              1,
+		"craft_server_up/stopped":              0,
+		"craft_server_players_online/running":  1,
+		"craft_server_players_max/running":     10,
+		"craft_backup_successes_total/running": 1,
+		"craft_backup_successes_total/stopped": 1,
+		"craft_backup_failures_total/running":  0,
+		"craft_backup_last_size_bytes/old":     3,
+
+		"craft_backup_last_success_timestamp_seconds/old": float64(
+			time.Date(2021, 2, 1, 10, 0, 0, 0, time.Local).Unix()),
+	}
+
+	for k, v := range want {
+		if g, ok := got[k]; !ok || g != v {
+			t.Errorf("%s: want %v: got %v (present: %t)", k, v, g, ok)
+		}
+	}
+
+	positive := []string{
+		"craft_server_cpu_seconds_total/running",
+		"craft_server_memory_bytes/running",
+		"craft_server_memory_limit_bytes/running",
+		"craft_server_uptime_seconds/running",
+		"craft_backup_last_success_timestamp_seconds/stopped",
+		"craft_backup_last_size_bytes/stopped",
+	}
+
+	for _, k := range positive {
+		if got[k] <= 0 {
+			t.Errorf("%s: expected a positive value, got %v", k, got[k])
+		}
+	}
+
+	if _, ok := got["craft_backup_last_duration_seconds/old"]; ok {
+		t.Errorf("unexpected backup duration for a server with no backup stats")
+	}
+
+	// Stopped servers only have backup metrics
+	for k := range got {
+		if strings.HasSuffix(k, "/stopped") && strings.HasPrefix(k, "craft_server_") && k != "craft_server_up/stopped" {
+			t.Errorf("unexpected metric for a stopped server: %s", k)
+		}
+	}
+
+	// Players are counted again once the interval has passed
+	b.Connect("Alex", "5678")
+
+	for _, tc := range []struct {
+		after time.Duration
+		want  float64
+	}{{time.Second, 1}, {DefaultPlayersInterval, 2}} {
+		now = now.Add(tc.after)
+
+		if families, err = c.Collect(ctx); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		for _, f := range families {
+			if f.Name == "craft_server_players_online" && f.Samples[0].Value != tc.want {
+				t.Errorf("%s later: unexpected players online: want %v: got %v", tc.after, tc.want, f.Samples[0].Value)
+			}
+		}
+	}
+}
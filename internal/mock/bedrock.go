@@ -0,0 +1,245 @@
+package mock
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	serverDirectory = "/bedrock"
+	maxPlayers      = 10
+)
+
+// Bedrock simulates the console of a bedrock_server process running in a fake container. It responds to the commands
+// used by craft and writes output to the container logs in the same format as bedrock_server.
+type Bedrock struct {
+	d *Docker
+	c *fakeContainer
+
+	level   string   // The name of the world directory
+	players []player // Players who are online
+
+	held    bool // `save hold` has been run without `save resume`
+	queries int  // The number of times `save query` has run since `save hold`
+	exited  bool
+}
+
+type player struct {
+	name, xuid string
+}
+
+func newBedrock(d *Docker, c *fakeContainer) *Bedrock {
+	return &Bedrock{d: d, c: c}
+}
+
+// start creates the world if it doesn't exist and writes the startup messages.
+func (b *Bedrock) start() {
+	b.level = b.property("level-name")
+	if b.level == "" {
+		b.level = "Bedrock level"
+	}
+
+	world := b.worldDirectory()
+
+	if _, ok := b.d.fsFor(b.c, path.Join(world, "levelname.txt"))[path.Join(world, "levelname.txt")]; !ok {
+		for name, content := range map[string]string{
+			"db/CURRENT":         "MANIFEST-000001\n",
+			"db/MANIFEST-000001": "manifest",
+			"db/000003.log":      "log",
+			"level.dat":          "level data",
+			"level.dat_old":      "level data",
+			"levelname.txt":      b.level,
+		} {
+			b.d.writeFile(b.c, path.Join(world, name), []byte(content))
+		}
+	}
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+
+	b.write(
+		"NO LOG FILE! - setting up server logging...",
+		fmt.Sprintf("[%s INFO] Starting Server", now),
+		fmt.Sprintf("[%s INFO] Version 1.16.201.2", now),
+		fmt.Sprintf("[%s INFO] Session ID c20875b8-bc46-44e0-b862-2b7fb9563d14", now),
+		fmt.Sprintf("[%s INFO] Level Name: %s", now, b.level),
+		fmt.Sprintf("[%s INFO] Game mode: 0 Survival", now),
+		fmt.Sprintf("[%s INFO] Difficulty: 1 EASY", now),
+		fmt.Sprintf("[INFO] opening worlds/%s/db", b.level),
+		"[INFO] IPv4 supported, port: 19132",
+		"[INFO] IPv6 not supported",
+		"[INFO] Server started.",
+	)
+}
+
+// property returns the value of a field in server.properties.
+func (b *Bedrock) property(key string) string {
+	p := path.Join(serverDirectory, "server.properties")
+
+	for _, line := range strings.Split(string(b.d.fsFor(b.c, p)[p]), "\n") {
+		kv := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(kv) == 2 && kv[0] == key {
+			return kv[1]
+		}
+	}
+
+	return ""
+}
+
+func (b *Bedrock) worldDirectory() string {
+	return path.Join(serverDirectory, "worlds", b.level)
+}
+
+func (b *Bedrock) write(lines ...string) {
+	for _, l := range lines {
+		b.c.logs.write(l)
+	}
+}
+
+// run responds to a line of input to the bedrock_server console.
+func (b *Bedrock) run(line string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+
+	args := fields[1:]
+
+	switch fields[0] {
+	case "save":
+		b.save(args)
+	case "stop":
+		b.write("Stopping server...", "Quit correctly")
+		b.exited = true
+	case "list":
+		names := make([]string, len(b.players))
+		for i, p := range b.players {
+			names[i] = p.name
+		}
+
+		b.write(fmt.Sprintf("There are %d/%d players online:", len(b.players), maxPlayers), strings.Join(names, ", "))
+	case "say", "tellraw":
+		// Messages are only shown to players
+	case "time":
+		if len(args) == 2 && args[0] == "set" {
+			b.write(fmt.Sprintf("Set the time to %s", args[1]))
+			return
+		}
+
+		b.syntaxError(line)
+	case "gamerule":
+		if len(args) == 2 {
+			b.write(fmt.Sprintf("Game rule %s has been updated to %s", args[0], args[1]))
+			return
+		}
+
+		b.syntaxError(line)
+	default:
+		b.syntaxError(line)
+	}
+}
+
+func (b *Bedrock) syntaxError(line string) {
+	word := strings.Fields(line)[0]
+	b.write(fmt.Sprintf(`Syntax error: Unexpected "%s": at ">>%s<<"`, word, word))
+}
+
+func (b *Bedrock) save(args []string) {
+	if len(args) != 1 {
+		b.syntaxError("save")
+		return
+	}
+
+	switch args[0] {
+	case "hold":
+		if b.held {
+			b.write("The command is already running")
+			return
+		}
+
+		b.held = true
+		b.queries = 0
+
+		b.write("Saving...")
+	case "query":
+		if !b.held || b.queries < b.d.SaveQueryRetries {
+			b.queries++
+			b.write("A previous save has not been completed.")
+
+			return
+		}
+
+		b.write("Data saved. Files are now ready to be copied.", b.worldFiles())
+
+		// The server continues to append to the database log after files are ready to be copied
+		logFile := path.Join(b.worldDirectory(), "db", "000003.log")
+		b.d.writeFile(b.c, logFile, append(b.d.fsFor(b.c, logFile)[logFile], []byte(" appended")...))
+	case "resume":
+		b.held = false
+		b.write("Changes to the level are resumed.")
+	default:
+		b.syntaxError(args[0])
+	}
+}
+
+// worldFiles returns the world files and their lengths in the format used by `save query`.
+func (b *Bedrock) worldFiles() string {
+	worlds := path.Join(serverDirectory, "worlds") + "/"
+	fs := b.d.fsFor(b.c, b.worldDirectory())
+
+	files := make([]string, 0)
+
+	for p, content := range fs {
+		if !strings.HasPrefix(p, b.worldDirectory()+"/") || strings.HasSuffix(p, "/") {
+			continue
+		}
+
+		files = append(files, fmt.Sprintf("%s:%d", strings.TrimPrefix(p, worlds), len(content)))
+	}
+
+	sort.Strings(files)
+
+	return strings.Join(files, ", ")
+}
+
+// Connect simulates a player joining the server.
+func (b *Bedrock) Connect(name, xuid string) {
+	b.d.mu.Lock()
+	defer b.d.mu.Unlock()
+
+	b.players = append(b.players, player{name: name, xuid: xuid})
+	b.write(fmt.Sprintf("[INFO] Player connected: %s, xuid: %s", name, xuid))
+}
+
+// Disconnect simulates a player leaving the server.
+func (b *Bedrock) Disconnect(name string) {
+	b.d.mu.Lock()
+	defer b.d.mu.Unlock()
+
+	for i, p := range b.players {
+		if p.name == name {
+			b.players = append(b.players[:i], b.players[i+1:]...)
+			b.write(fmt.Sprintf("[INFO] Player disconnected: %s, xuid: %s", p.name, p.xuid))
+
+			return
+		}
+	}
+}
+
+// Log writes arbitrary lines to the server output.
+func (b *Bedrock) Log(lines ...string) {
+	b.d.mu.Lock()
+	defer b.d.mu.Unlock()
+
+	b.write(lines...)
+}
+
+// Held returns true if saving is on hold following a `save hold` command.
+func (b *Bedrock) Held() bool {
+	b.d.mu.Lock()
+	defer b.d.mu.Unlock()
+
+	return b.held
+}
@@ -0,0 +1,1061 @@
+package mock
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	timetypes "github.com/docker/docker/api/types/time"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// dockerTimeLayout is the format of time strings returned by the docker API.
+const dockerTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// Docker is an in-memory fake of the docker daemon. Containers, volumes, images, logs and the container file system are
+// simulated. Each container runs a shell which starts a simulated bedrock_server process (see Bedrock) when the
+// command used by craft to run the server is written to its stdin.
+//
+// Methods of client.CommonAPIClient which are not faked will panic.
+type Docker struct {
+	client.CommonAPIClient
+
+	// Images are the tags of the images which exist. Containers may only be created from these images.
+	Images []string
+
+	// ImageFiles are the files present in every image, keyed by their absolute path.
+	ImageFiles map[string][]byte
+
+	// ImageLabels are the labels of every image.
+	ImageLabels map[string]string
+
+	// SaveQueryRetries is the number of times `save query` reports that a save hasn't completed before reporting that
+	// files are ready to be copied.
+	SaveQueryRetries int
+
+	logStreams int32 // Number of log streams which haven't ended, accessed atomically
+
+	mu         sync.Mutex
+	containers map[string]*fakeContainer // Containers by ID
+	volumes    map[string]fileSystem     // Volume file systems by volume name
+	nextID     int
+}
+
+// NewDocker returns a fake docker daemon with the given images. Every image contains a bedrock server directory with a
+// default server.properties file and has the labels of the craft server image.
+func NewDocker(images ...string) *Docker {
+	return &Docker{
+		Images:      images,
+		ImageFiles:  DefaultImageFiles(),
+		ImageLabels: DefaultImageLabels(),
+		containers:  make(map[string]*fakeContainer),
+		volumes:     make(map[string]fileSystem),
+	}
+}
+
+// DefaultImageLabels returns the labels of the craft server image (see server/Dockerfile).
+func DefaultImageLabels() map[string]string {
+	return map[string]string{"danhale-git/craft.user": "1000:1000"}
+}
+
+// DefaultImageFiles returns the files in the bedrock server directory of the craft server image. The image contains an
+// empty default world directory (see server/Dockerfile).
+func DefaultImageFiles() map[string][]byte {
+	return map[string][]byte{
+		"/bedrock/":                         nil,
+		"/bedrock/bedrock_server":           []byte("ELF"),
+		"/bedrock/server.properties":        []byte(DefaultServerProperties),
+		"/bedrock/worlds/":                  nil,
+		"/bedrock/worlds/Bedrock level/":    nil,
+		"/bedrock/worlds/Bedrock level/db/": nil,
+	}
+}
+
+// DefaultServerProperties is a subset of the default bedrock server.properties file.
+const DefaultServerProperties = `server-name=Dedicated Server
+gamemode=survival
+difficulty=easy
+allow-cheats=false
+max-players=10
+online-mode=true
+server-port=19132
+server-portv6=19133
+enable-lan-visibility=true
+view-distance=32
+level-name=Bedrock level
+level-seed=
+default-player-permission-level=member
+`
+
+type fakeContainer struct {
+	id, name   string
+	config     *container.Config
+	hostConfig *container.HostConfig
+	mounts     []types.MountPoint
+
+	created               time.Time
+	startedAt, finishedAt time.Time
+	running               bool
+
+	fs      fileSystem // Files which are not in a volume
+	logs    *logBuffer
+	stopped chan struct{} // Closed when the current run of the container ends
+	removed chan struct{} // Closed when the container is removed
+	bedrock *Bedrock      // The bedrock_server process, nil if it isn't running
+}
+
+// fileSystem maps absolute paths to file contents. Directories are stored with a trailing slash and nil content.
+type fileSystem map[string][]byte
+
+// Container returns the named container's console, allowing tests to simulate player activity. The second return value
+// is false if the container doesn't exist or isn't running bedrock_server.
+func (d *Docker) Container(name string) (*Bedrock, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, err := d.find(name)
+	if err != nil || c.bedrock == nil {
+		return nil, false
+	}
+
+	return c.bedrock, true
+}
+
+// ReadFile returns the content of a file in the named container.
+func (d *Docker) ReadFile(name, p string) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, err := d.find(name)
+	if err != nil {
+		return nil, err
+	}
+
+	b, ok := d.fsFor(c, p)[p]
+	if !ok {
+		return nil, errdefs.NotFound(fmt.Errorf("no such file: %s", p))
+	}
+
+	return b, nil
+}
+
+// find returns the container with the given name or ID. d.mu must be held.
+func (d *Docker) find(nameOrID string) (*fakeContainer, error) {
+	if c, ok := d.containers[nameOrID]; ok {
+		return c, nil
+	}
+
+	for _, c := range d.containers {
+		if c.name == strings.TrimPrefix(nameOrID, "/") {
+			return c, nil
+		}
+	}
+
+	return nil, errdefs.NotFound(fmt.Errorf("No such container: %s", nameOrID))
+}
+
+// fsFor returns the file system where the file at p is stored. d.mu must be held.
+func (d *Docker) fsFor(c *fakeContainer, p string) fileSystem {
+	if v := volumeFor(c, p); v != "" {
+		return d.volumes[v]
+	}
+
+	return c.fs
+}
+
+// volumeFor returns the name of the volume mounted at p, or an empty string if p is not in a volume.
+func volumeFor(c *fakeContainer, p string) string {
+	for _, m := range c.mounts {
+		if p == m.Destination || strings.HasPrefix(p, m.Destination+"/") {
+			return m.Name
+		}
+	}
+
+	return ""
+}
+
+// writeFile writes a file to the container, creating any parent directories. d.mu must be held.
+func (d *Docker) writeFile(c *fakeContainer, p string, b []byte) {
+	d.mkdirAll(c, path.Dir(p))
+	d.fsFor(c, p)[p] = b
+}
+
+// mkdirAll creates a directory and any parent directories. d.mu must be held.
+func (d *Docker) mkdirAll(c *fakeContainer, dir string) {
+	for ; dir != "/" && dir != "."; dir = path.Dir(dir) {
+		d.fsFor(c, dir)[dir+"/"] = nil
+	}
+}
+
+// ContainerCreate creates a container from one of the fake images. Named volumes which are empty are populated with
+// the image files at the mount target.
+//
+//nolint:lll // mock method
+func (d *Docker) ContainerCreate(_ context.Context, config *container.Config, hostConfig *container.HostConfig, _ *network.NetworkingConfig, _ *v1.Platform, name string) (container.ContainerCreateCreatedBody, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.imageExists(config.Image) {
+		return container.ContainerCreateCreatedBody{}, errdefs.NotFound(fmt.Errorf("No such image: %s", config.Image))
+	}
+
+	if _, err := d.find(name); err == nil {
+		return container.ContainerCreateCreatedBody{}, errdefs.Conflict(
+			fmt.Errorf("Conflict. The container name \"/%s\" is already in use", name))
+	}
+
+	if hostConfig == nil {
+		hostConfig = &container.HostConfig{}
+	}
+
+	d.nextID++
+
+	c := &fakeContainer{
+		id:         fmt.Sprintf("%s_ID%d", name, d.nextID),
+		name:       name,
+		config:     config,
+		hostConfig: hostConfig,
+		created:    time.Now(),
+		fs:         make(fileSystem),
+		logs:       &logBuffer{changed: make(chan struct{})},
+		stopped:    make(chan struct{}),
+		removed:    make(chan struct{}),
+	}
+	close(c.stopped)
+
+	for _, m := range hostConfig.Mounts {
+		if m.Type != mount.TypeVolume {
+			continue
+		}
+
+		vol, ok := d.volumes[m.Source]
+		if !ok {
+			vol = make(fileSystem)
+			d.volumes[m.Source] = vol
+		}
+
+		// Docker copies image files into empty volumes
+		if len(vol) == 0 {
+			for p, b := range d.ImageFiles {
+				if strings.HasPrefix(p, m.Target+"/") {
+					vol[p] = b
+				}
+			}
+		}
+
+		c.mounts = append(c.mounts, types.MountPoint{
+			Type:        mount.TypeVolume,
+			Name:        m.Source,
+			Destination: m.Target,
+			RW:          true,
+		})
+	}
+
+	for p, b := range d.ImageFiles {
+		if volumeFor(c, p) == "" {
+			c.fs[p] = b
+		}
+	}
+
+	d.containers[c.id] = c
+
+	return container.ContainerCreateCreatedBody{ID: c.id}, nil
+}
+
+func (d *Docker) imageExists(image string) bool {
+	for _, img := range d.Images {
+		if img == image {
+			return true
+		}
+	}
+
+	return false
+}
+
+//nolint:lll // mock method
+func (d *Docker) ContainerStart(_ context.Context, id string, _ types.ContainerStartOptions) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, err := d.find(id)
+	if err != nil {
+		return err
+	}
+
+	if c.running {
+		return nil
+	}
+
+	c.running = true
+	c.startedAt = time.Now()
+	c.stopped = make(chan struct{})
+
+	return nil
+}
+
+// ContainerStop stops the container, killing bedrock_server if it is running. Containers created with AutoRemove
+// are removed.
+//
+//nolint:lll // mock method
+func (d *Docker) ContainerStop(_ context.Context, id string, _ *time.Duration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, err := d.find(id)
+	if err != nil {
+		return err
+	}
+
+	d.stop(c)
+
+	return nil
+}
+
+// stop ends the current run of the container. d.mu must be held.
+func (d *Docker) stop(c *fakeContainer) {
+	if !c.running {
+		return
+	}
+
+	c.running = false
+	c.bedrock = nil
+	c.finishedAt = time.Now()
+	close(c.stopped)
+
+	if c.hostConfig.AutoRemove {
+		d.remove(c)
+	}
+}
+
+// remove deletes the container. d.mu must be held.
+func (d *Docker) remove(c *fakeContainer) {
+	if _, ok := d.containers[c.id]; !ok {
+		return
+	}
+
+	delete(d.containers, c.id)
+	close(c.removed)
+}
+
+//nolint:lll // mock method
+func (d *Docker) ContainerRemove(_ context.Context, id string, options types.ContainerRemoveOptions) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, err := d.find(id)
+	if err != nil {
+		return err
+	}
+
+	if c.running && !options.Force {
+		return errdefs.Conflict(fmt.Errorf("You cannot remove a running container %s", c.id))
+	}
+
+	d.stop(c)
+	d.remove(c)
+
+	if options.RemoveVolumes {
+		for _, m := range c.mounts {
+			delete(d.volumes, m.Name)
+		}
+	}
+
+	return nil
+}
+
+// ContainerWait supports the removed and not-running conditions. Any other condition is treated as not-running.
+//nolint:lll // mock method
+func (d *Docker) ContainerWait(ctx context.Context, id string, condition container.WaitCondition) (<-chan container.ContainerWaitOKBody, <-chan error) {
+	resultC := make(chan container.ContainerWaitOKBody, 1)
+	errC := make(chan error, 1)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, err := d.find(id)
+	if err != nil {
+		errC <- err
+		return resultC, errC
+	}
+
+	done := c.stopped
+	if condition == container.WaitConditionRemoved {
+		done = c.removed
+	}
+
+	go func() {
+		select {
+		case <-done:
+			resultC <- container.ContainerWaitOKBody{}
+		case <-ctx.Done():
+			errC <- ctx.Err()
+		}
+	}()
+
+	return resultC, errC
+}
+
+//nolint:lll // mock method
+func (d *Docker) ContainerList(_ context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	containers := make([]types.Container, 0)
+
+	for _, c := range d.containers {
+		if !c.running && !options.All {
+			continue
+		}
+
+		state := "exited"
+		if c.running {
+			state = "running"
+		}
+
+		containers = append(containers, types.Container{
+			ID:      c.id,
+			Names:   []string{"/" + c.name},
+			Image:   c.config.Image,
+			Created: c.created.Unix(),
+			Labels:  c.config.Labels,
+			State:   state,
+			Mounts:  c.mounts,
+		})
+	}
+
+	// Map iteration order is random, docker lists the newest containers first
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].Created > containers[j].Created
+	})
+
+	return containers, nil
+}
+
+//nolint:lll // mock method
+func (d *Docker) ContainerInspect(_ context.Context, id string) (types.ContainerJSON, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, err := d.find(id)
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+
+	state := &types.ContainerState{
+		Status:  "created",
+		Running: c.running,
+	}
+
+	if !c.startedAt.IsZero() {
+		state.StartedAt = c.startedAt.UTC().Format(dockerTimeLayout)
+		state.Status = "running"
+	}
+
+	if !c.running && !c.finishedAt.IsZero() {
+		state.FinishedAt = c.finishedAt.UTC().Format(dockerTimeLayout)
+		state.Status = "exited"
+	}
+
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:         c.id,
+			Name:       "/" + c.name,
+			Created:    c.created.UTC().Format(dockerTimeLayout),
+			Image:      c.config.Image,
+			State:      state,
+			HostConfig: c.hostConfig,
+		},
+		Mounts:          c.mounts,
+		Config:          c.config,
+		NetworkSettings: &types.NetworkSettings{},
+	}, nil
+}
+
+// ContainerUpdate replaces the container's resource limits.
+//
+//nolint:lll // mock method
+func (d *Docker) ContainerUpdate(_ context.Context, id string, updateConfig container.UpdateConfig) (container.ContainerUpdateOKBody, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, err := d.find(id)
+	if err != nil {
+		return container.ContainerUpdateOKBody{}, err
+	}
+
+	// Copy the host config, previous inspect results may still be in use
+	hc := *c.hostConfig
+	hc.Resources = updateConfig.Resources
+	c.hostConfig = &hc
+
+	return container.ContainerUpdateOKBody{}, nil
+}
+
+// Simulated resource usage reported by ContainerStats.
+const (
+	statsCPUFraction = 0.1       // Fraction of one CPU used while the container is running
+	statsMemory      = 256 << 20 // Memory used by a running container in bytes
+	statsHostMemory  = 8 << 30   // Memory limit reported for containers without one, as docker reports the host's memory
+)
+
+// ContainerStats returns a single sample of the container's resource usage. A running container uses a fixed amount of
+// memory and a fraction of one CPU since it started. Stopped containers use nothing.
+//
+//nolint:lll // mock method
+func (d *Docker) ContainerStats(_ context.Context, id string, _ bool) (types.ContainerStats, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, err := d.find(id)
+	if err != nil {
+		return types.ContainerStats{}, err
+	}
+
+	var stats types.StatsJSON
+
+	stats.Read = time.Now()
+
+	if c.running {
+		stats.CPUStats.CPUUsage.TotalUsage = uint64(float64(time.Since(c.startedAt)) * statsCPUFraction)
+		stats.MemoryStats.Usage = statsMemory
+		stats.MemoryStats.Limit = statsHostMemory
+
+		if c.hostConfig.Memory > 0 {
+			stats.MemoryStats.Limit = uint64(c.hostConfig.Memory)
+		}
+	}
+
+	b, err := json.Marshal(stats)
+	if err != nil {
+		return types.ContainerStats{}, err
+	}
+
+	return types.ContainerStats{Body: ioutil.NopCloser(bytes.NewReader(b)), OSType: "linux"}, nil
+}
+
+// ContainerAttach returns a connection to the container's stdin. Each line written to the connection is echoed to the
+// container logs, as it would be by a TTY, and then run by the container's shell or bedrock_server process.
+//
+//nolint:lll // mock method
+func (d *Docker) ContainerAttach(_ context.Context, id string, _ types.ContainerAttachOptions) (types.HijackedResponse, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, err := d.find(id)
+	if err != nil {
+		return types.HijackedResponse{}, err
+	}
+
+	if !c.running {
+		return types.HijackedResponse{}, errdefs.Conflict(fmt.Errorf("container %s is not running", c.id))
+	}
+
+	clientConn, containerConn := net.Pipe()
+
+	go func() {
+		defer containerConn.Close()
+
+		scanner := bufio.NewScanner(containerConn)
+		for scanner.Scan() {
+			d.input(c, scanner.Text())
+		}
+	}()
+
+	return types.HijackedResponse{
+		Conn:   clientConn,
+		Reader: bufio.NewReader(clientConn),
+	}, nil
+}
+
+// input handles a line written to the container's stdin.
+func (d *Docker) input(c *fakeContainer, line string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !c.running {
+		return
+	}
+
+	c.logs.write(line)
+
+	if c.bedrock != nil {
+		c.bedrock.run(line)
+
+		if c.bedrock.exited {
+			c.bedrock = nil
+		}
+
+		return
+	}
+
+	// The shell is running
+	if strings.TrimSpace(line) == RunBedrockCommand {
+		c.bedrock = newBedrock(d, c)
+		c.bedrock.start()
+
+		return
+	}
+
+	if fields := strings.Fields(line); len(fields) > 0 {
+		c.logs.write(fmt.Sprintf("bash: %s: command not found", fields[0]))
+	}
+}
+
+// RunBedrockCommand is the shell command which runs the bedrock_server process.
+const RunBedrockCommand = "cd bedrock; LD_LIBRARY_PATH=. ./bedrock_server"
+
+// ContainerLogs returns the container's console output. Tail, Follow, Since, Until and Timestamps options are
+// supported. When following, the reader returns EOF once the container stops. Following stops immediately if Until is
+// given.
+//
+//nolint:lll // mock method
+func (d *Docker) ContainerLogs(ctx context.Context, id string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, err := d.find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	start := 0
+
+	if options.Tail != "" && options.Tail != "all" {
+		tail, err := strconv.Atoi(options.Tail)
+		if err != nil {
+			return nil, errdefs.InvalidParameter(err)
+		}
+
+		if tail >= 0 {
+			start = c.logs.len() - tail
+		}
+	}
+
+	if start < 0 {
+		start = 0
+	}
+
+	f := logFilter{timestamps: options.Timestamps}
+
+	for _, t := range []struct {
+		value string
+		time  *time.Time
+	}{{options.Since, &f.since}, {options.Until, &f.until}} {
+		if t.value == "" {
+			continue
+		}
+
+		ts, err := timetypes.GetTimestamp(t.value, time.Now())
+		if err != nil {
+			return nil, errdefs.InvalidParameter(err)
+		}
+
+		sec, nsec, err := timetypes.ParseTimestamps(ts, 0)
+		if err != nil {
+			return nil, errdefs.InvalidParameter(err)
+		}
+
+		*t.time = time.Unix(sec, nsec)
+	}
+
+	stopped := c.stopped
+	if !options.Follow || !c.running || !f.until.IsZero() {
+		// Return the current logs only
+		stopped = make(chan struct{})
+		close(stopped)
+	}
+
+	pr, pw := io.Pipe()
+
+	atomic.AddInt32(&d.logStreams, 1)
+
+	go func() {
+		defer atomic.AddInt32(&d.logStreams, -1)
+
+		c.logs.stream(ctx, pw, start, stopped, f)
+	}()
+
+	return pr, nil
+}
+
+// LogStreams returns the number of log streams returned by ContainerLogs which haven't ended. A stream which follows
+// the logs of a running container ends when the context passed to ContainerLogs is cancelled.
+func (d *Docker) LogStreams() int {
+	return int(atomic.LoadInt32(&d.logStreams))
+}
+
+//nolint:lll // mock method
+func (d *Docker) CopyFromContainer(_ context.Context, id string, srcPath string) (io.ReadCloser, types.ContainerPathStat, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, err := d.find(id)
+	if err != nil {
+		return nil, types.ContainerPathStat{}, err
+	}
+
+	srcPath = path.Clean(srcPath)
+	fs := d.fsFor(c, srcPath)
+
+	var buf bytes.Buffer
+
+	tw := tar.NewWriter(&buf)
+
+	if b, ok := fs[srcPath]; ok {
+		// Copy a single file
+		if err := writeTarFile(tw, path.Base(srcPath), b); err != nil {
+			return nil, types.ContainerPathStat{}, err
+		}
+	} else if _, ok := fs[srcPath+"/"]; ok {
+		// Copy a directory, paths in the archive begin with the name of the directory
+		tree := d.tree(c, srcPath)
+		paths := make([]string, 0, len(tree))
+
+		for p := range tree {
+			paths = append(paths, p)
+		}
+
+		sort.Strings(paths)
+
+		if err := tw.WriteHeader(dirHeader(path.Base(srcPath) + "/")); err != nil {
+			return nil, types.ContainerPathStat{}, err
+		}
+
+		for _, p := range paths {
+			name := path.Join(path.Base(srcPath), strings.TrimPrefix(p, srcPath+"/"))
+
+			if strings.HasSuffix(p, "/") {
+				err = tw.WriteHeader(dirHeader(name + "/"))
+			} else {
+				err = writeTarFile(tw, name, tree[p])
+			}
+
+			if err != nil {
+				return nil, types.ContainerPathStat{}, err
+			}
+		}
+	} else {
+		return nil, types.ContainerPathStat{}, errdefs.NotFound(
+			fmt.Errorf("Could not find the file %s in container %s", srcPath, c.name))
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, types.ContainerPathStat{}, err
+	}
+
+	return io.NopCloser(&buf), types.ContainerPathStat{Name: path.Base(srcPath)}, nil
+}
+
+// tree returns the files and directories in the directory at dir, including those in volumes mounted in it. d.mu must
+// be held.
+func (d *Docker) tree(c *fakeContainer, dir string) fileSystem {
+	tree := make(fileSystem)
+
+	add := func(fs fileSystem, volume string) {
+		for p, b := range fs {
+			// Files in a file system are hidden by a volume mounted over them
+			if strings.HasPrefix(p, dir+"/") && volumeFor(c, strings.TrimSuffix(p, "/")) == volume {
+				tree[p] = b
+			}
+		}
+	}
+
+	add(d.fsFor(c, dir), volumeFor(c, dir))
+
+	for _, m := range c.mounts {
+		if strings.HasPrefix(m.Destination, dir+"/") {
+			add(d.volumes[m.Name], m.Name)
+		}
+	}
+
+	return tree
+}
+
+func dirHeader(name string) *tar.Header {
+	return &tar.Header{Typeflag: tar.TypeDir, Name: name, Mode: 0755}
+}
+
+func writeTarFile(tw *tar.Writer, name string, b []byte) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(b)),
+		ModTime:  time.Now(),
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err := tw.Write(b)
+
+	return err
+}
+
+// CopyToContainer extracts the tar archive at dstPath, which must be an existing directory. Missing parent
+// directories of files in the archive are created.
+//
+//nolint:lll // mock method
+func (d *Docker) CopyToContainer(_ context.Context, id, dstPath string, content io.Reader, _ types.CopyToContainerOptions) error {
+	// Read the archive before locking, the caller may be streaming it
+	tr := tar.NewReader(content)
+
+	type file struct {
+		path string
+		data []byte
+		dir  bool
+	}
+
+	extracted := make([]file, 0)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("reading tar archive: %w", err)
+		}
+
+		p := path.Join(dstPath, hdr.Name)
+
+		if hdr.Typeflag == tar.TypeDir {
+			extracted = append(extracted, file{path: p, dir: true})
+			continue
+		}
+
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("reading tar archive: %w", err)
+		}
+
+		extracted = append(extracted, file{path: p, data: b})
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c, err := d.find(id)
+	if err != nil {
+		return err
+	}
+
+	dstPath = path.Clean(dstPath)
+	if _, ok := d.fsFor(c, dstPath)[dstPath+"/"]; !ok && dstPath != "/" {
+		return errdefs.NotFound(fmt.Errorf("Could not find the file %s in container %s", dstPath, c.name))
+	}
+
+	for _, f := range extracted {
+		if f.dir {
+			d.mkdirAll(c, f.path)
+			continue
+		}
+
+		d.writeFile(c, f.path, f.data)
+	}
+
+	return nil
+}
+
+//nolint:lll // mock method
+func (d *Docker) VolumeCreate(_ context.Context, options volume.VolumeCreateBody) (types.Volume, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.volumes[options.Name]; !ok {
+		d.volumes[options.Name] = make(fileSystem)
+	}
+
+	return types.Volume{Name: options.Name, Driver: "local", Scope: "local"}, nil
+}
+
+//nolint:lll // mock method
+func (d *Docker) VolumeRemove(_ context.Context, volumeID string, _ bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, c := range d.containers {
+		for _, m := range c.mounts {
+			if m.Name == volumeID {
+				return errdefs.Conflict(fmt.Errorf("volume is in use - [%s]", c.id))
+			}
+		}
+	}
+
+	delete(d.volumes, volumeID)
+
+	return nil
+}
+
+//nolint:lll // mock method
+func (d *Docker) ImageList(_ context.Context, _ types.ImageListOptions) ([]types.ImageSummary, error) {
+	images := make([]types.ImageSummary, len(d.Images))
+
+	for i, img := range d.Images {
+		images[i] = types.ImageSummary{
+			ID:       fmt.Sprintf("sha256:%d", i),
+			RepoTags: []string{img},
+		}
+	}
+
+	return images, nil
+}
+
+func (d *Docker) ImageInspectWithRaw(_ context.Context, image string) (types.ImageInspect, []byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.imageExists(image) {
+		return types.ImageInspect{}, nil, errdefs.NotFound(fmt.Errorf("No such image: %s", image))
+	}
+
+	labels := make(map[string]string, len(d.ImageLabels))
+	for k, v := range d.ImageLabels {
+		labels[k] = v
+	}
+
+	return types.ImageInspect{
+		RepoTags: []string{image},
+		Config:   &container.Config{Labels: labels},
+	}, nil, nil
+}
+
+// logBuffer holds the console output of a container.
+type logBuffer struct {
+	mu      sync.Mutex
+	lines   []logLine
+	changed chan struct{} // Closed and replaced when a line is written
+}
+
+type logLine struct {
+	time time.Time
+	text string
+}
+
+// logFilter selects the lines written by logBuffer.stream.
+type logFilter struct {
+	since, until time.Time // Ignored if zero
+	timestamps   bool      // Prefix lines with the time they were written
+}
+
+func (f logFilter) format(l logLine) (string, bool) {
+	if (!f.since.IsZero() && l.time.Before(f.since)) || (!f.until.IsZero() && l.time.After(f.until)) {
+		return "", false
+	}
+
+	if f.timestamps {
+		return l.time.UTC().Format(time.RFC3339Nano) + " " + l.text, true
+	}
+
+	return l.text, true
+}
+
+// write appends a line of output. Lines end with \r\n as they would from a TTY.
+func (l *logBuffer) write(line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lines = append(l.lines, logLine{time: time.Now(), text: line + "\r\n"})
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+func (l *logBuffer) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.lines)
+}
+
+// stream writes lines selected by f to w from the given index until ctx is cancelled, w is closed or stopped is closed
+// and all lines have been written.
+func (l *logBuffer) stream(ctx context.Context, w *io.PipeWriter, i int, stopped <-chan struct{}, f logFilter) {
+	// Unblock writes when ctx is cancelled, as closing the connection to the docker daemon would
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = w.CloseWithError(ctx.Err())
+		case <-done:
+		}
+	}()
+
+	write := func(lines []logLine) bool {
+		for _, line := range lines {
+			text, ok := f.format(line)
+			if !ok {
+				continue
+			}
+
+			if _, err := w.Write([]byte(text)); err != nil {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	for {
+		l.mu.Lock()
+		lines := l.lines[i:]
+		changed := l.changed
+		l.mu.Unlock()
+
+		if !write(lines) {
+			return
+		}
+
+		i += len(lines)
+
+		select {
+		case <-changed:
+			continue
+		default:
+		}
+
+		select {
+		case <-changed:
+		case <-stopped:
+			// Write any lines logged before the container stopped
+			l.mu.Lock()
+			lines = l.lines[i:]
+			l.mu.Unlock()
+
+			if !write(lines) {
+				return
+			}
+
+			_ = w.Close()
+
+			return
+		case <-ctx.Done():
+			_ = w.CloseWithError(ctx.Err())
+			return
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Package schedule parses cron expressions and finds the times at which they are due.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxYears is how far ahead Next searches for a matching time. Expressions which never match e.g. '0 0 30 2 *' are
+// only detected once this is exceeded.
+const maxYears = 5
+
+// aliases are the supported shorthand expressions.
+var aliases = map[string]string{ //nolint:gochecknoglobals
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// field is the range of values for each of the five fields of an expression.
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{ //nolint:gochecknoglobals
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Schedule is a parsed cron expression. Each field is a set of bits where bit n is set if the value n matches.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// If either day field begins with '*', a day must match both of them. Otherwise it matches if it matches either of
+	// them, as in vixie cron.
+	dayAnd bool
+}
+
+// Parse parses a standard five field cron expression: minute, hour, day of month, month and day of week. Fields may
+// be '*', a value, a range e.g. '1-5' or a comma separated list of these. Each may be followed by a step e.g. '*/15'.
+// Sunday is 0 or 7. If the day of month or day of week field begins with '*', a day must match both day fields,
+// otherwise it must match either of them. The aliases @yearly, @annually, @monthly, @weekly, @daily, @midnight and
+// @hourly are supported.
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+
+	if a, ok := aliases[strings.ToLower(expr)]; ok {
+		expr = a
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return Schedule{}, fmt.Errorf("invalid cron expression '%s': expected %d fields, got %d",
+			expr, len(fields), len(parts))
+	}
+
+	sets := make([]uint64, len(fields))
+
+	for i, f := range fields {
+		set, err := parseField(parts[i], f)
+		if err != nil {
+			return Schedule{}, fmt.Errorf("invalid cron expression '%s': %s: %w", expr, f.name, err)
+		}
+
+		sets[i] = set
+	}
+
+	// Sunday is 0 or 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return Schedule{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		dayAnd: strings.HasPrefix(parts[2], "*") || strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+// parseField returns the set of values matched by a field.
+func parseField(s string, f field) (uint64, error) {
+	var set uint64
+
+	for _, part := range strings.Split(s, ",") {
+		rng, step := part, 1
+
+		if i := strings.Index(part, "/"); i >= 0 {
+			rng = part[:i]
+
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step '%s'", part[i+1:])
+			}
+
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2) //nolint:gomnd
+
+			var err error
+			if lo, err = value(bounds[0], f); err != nil {
+				return 0, err
+			}
+
+			if hi, err = value(bounds[1], f); err != nil {
+				return 0, err
+			}
+
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range '%s'", rng)
+			}
+		default:
+			v, err := value(rng, f)
+			if err != nil {
+				return 0, err
+			}
+
+			// A value with a step e.g. 5/15 runs from the value to the maximum
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
+
+func value(s string, f field) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value '%s'", s)
+	}
+
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", v, f.min, f.max)
+	}
+
+	return v, nil
+}
+
+// Next returns the first time after t which matches the schedule, to the minute, in t's location. The zero time is
+// returned if the schedule doesn't match any time in the next five years.
+func (s Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	end := t.AddDate(maxYears, 0, 0)
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	for t.Before(end) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (s Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.dayAnd {
+		return dom && dow
+	}
+
+	return dom || dow
+}
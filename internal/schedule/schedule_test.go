@@ -0,0 +1,89 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule_Next(t *testing.T) {
+	// Monday
+	from := time.Date(2021, 2, 1, 10, 7, 30, 0, time.UTC)
+
+	cases := map[string]time.Time{
+		"* * * * *":        time.Date(2021, 2, 1, 10, 8, 0, 0, time.UTC),
+		"0 * * * *":        time.Date(2021, 2, 1, 11, 0, 0, 0, time.UTC),
+		"@hourly":          time.Date(2021, 2, 1, 11, 0, 0, 0, time.UTC),
+		"*/15 * * * *":     time.Date(2021, 2, 1, 10, 15, 0, 0, time.UTC),
+		"5/20 * * * *":     time.Date(2021, 2, 1, 10, 25, 0, 0, time.UTC),
+		"30 4 * * *":       time.Date(2021, 2, 2, 4, 30, 0, 0, time.UTC),
+		"0 9-17/4 * * *":   time.Date(2021, 2, 1, 13, 0, 0, 0, time.UTC),
+		"0 0 * * 0":        time.Date(2021, 2, 7, 0, 0, 0, 0, time.UTC),
+		"0 0 * * 7":        time.Date(2021, 2, 7, 0, 0, 0, 0, time.UTC),
+		"0 0 * * 6,7":      time.Date(2021, 2, 6, 0, 0, 0, 0, time.UTC),
+		"0 0 1 * *":        time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":       time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		"0 12 15 * 5":      time.Date(2021, 2, 5, 12, 0, 0, 0, time.UTC), // Day of month or Friday
+		"0 12 */2 * 5":     time.Date(2021, 2, 5, 12, 0, 0, 0, time.UTC), // Odd days which are Fridays
+		"0 0 */2 * *":      time.Date(2021, 2, 3, 0, 0, 0, 0, time.UTC),
+		"0 0 * * */2":      time.Date(2021, 2, 2, 0, 0, 0, 0, time.UTC),
+		"0 0 1 1 *":        time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		"0,30 10,22 * * *": time.Date(2021, 2, 1, 10, 30, 0, 0, time.UTC),
+		" 0   0  * *   * ": time.Date(2021, 2, 2, 0, 0, 0, 0, time.UTC),
+		"0 0 30 2 *":       {},
+	}
+
+	for expr, want := range cases {
+		s, err := Parse(expr)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", expr, err)
+			continue
+		}
+
+		if got := s.Next(from); !got.Equal(want) {
+			t.Errorf("%q: want %s: got %s", expr, want, got)
+		}
+	}
+}
+
+func TestSchedule_Next_DayStep(t *testing.T) {
+	s, err := Parse("0 0 */2 * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Odd days of the month, the step restarts each month
+	for _, day := range []int{3, 5, 7, 9} {
+		next = s.Next(next)
+		if want := time.Date(2021, 1, day, 0, 0, 0, 0, time.UTC); !next.Equal(want) {
+			t.Fatalf("want %s: got %s", want, next)
+		}
+	}
+
+	next = s.Next(time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC))
+	if !next.Equal(time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected time after the last odd day of the month: %s", next)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@often",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("%q: no error returned for invalid expression", expr)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Package mclog parses the console output of a bedrock server into typed events.
+package mclog
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeLayout is the format of the timestamp at the start of bedrock log lines, after the final ':' is replaced by '.'.
+const TimeLayout = "2006-01-02 15:04:05.000"
+
+const timeLayoutSeconds = "2006-01-02 15:04:05"
+
+// Level is the severity of a log line.
+type Level int
+
+// Log levels in order of severity. Lines without a level, such as command responses, have LevelNone.
+const (
+	LevelNone Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{ //nolint:gochecknoglobals
+	LevelInfo:  "INFO",
+	LevelWarn:  "WARN",
+	LevelError: "ERROR",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel returns the level with the given name e.g. 'warn', ignoring case.
+func ParseLevel(s string) (Level, error) {
+	for l, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return l, nil
+		}
+	}
+
+	return LevelNone, fmt.Errorf("invalid log level '%s', must be one of info, warn or error", s)
+}
+
+// Kind is the type of event a log line reports.
+type Kind int
+
+// Kinds of event. Lines which are not recognised have KindOther.
+const (
+	KindOther              Kind = iota
+	KindServerStarted           // The server has started and players can connect
+	KindVersion                 // Event.Value is the server version
+	KindLevelName               // Event.Value is the name of the world
+	KindPlayerConnected         // Event.Player and Event.XUID identify the player
+	KindPlayerDisconnected      // Event.Player and Event.XUID identify the player
+	KindPlayerList              // Response to `list`, Event.Value is the player count e.g. 1/10, the next line lists them
+	KindSaveHeld                // Response to `save hold`, saving is paused
+	KindSaveNotReady            // Response to `save query` when files are not ready to be copied
+	KindSaveReady               // Response to `save query` when files are ready, the next line lists them
+	KindSaveResumed             // Response to `save resume`
+	KindCommandError            // A command could not be run, Event.Message is the error
+	KindStopping                // The server is stopping
+	KindQuit                    // The server process has stopped cleanly
+	KindCrash                   // The server process crashed
+)
+
+var kindNames = map[Kind]string{ //nolint:gochecknoglobals
+	KindOther:              "other",
+	KindServerStarted:      "server_started",
+	KindVersion:            "version",
+	KindLevelName:          "level_name",
+	KindPlayerConnected:    "player_connected",
+	KindPlayerDisconnected: "player_disconnected",
+	KindPlayerList:         "player_list",
+	KindSaveHeld:           "save_held",
+	KindSaveNotReady:       "save_not_ready",
+	KindSaveReady:          "save_ready",
+	KindSaveResumed:        "save_resumed",
+	KindCommandError:       "command_error",
+	KindStopping:           "stopping",
+	KindQuit:               "quit",
+	KindCrash:              "crash",
+}
+
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// Event is a parsed line of bedrock server output.
+type Event struct {
+	Raw     string    // The line without surrounding whitespace
+	Time    time.Time // Zero if the line has no timestamp
+	Level   Level
+	Kind    Kind
+	Message string // The line without the timestamp and level prefix
+
+	Player string // The player name for player events
+	XUID   string // The player's xbox user id for player events
+	Value  string // The version or level name for those events
+}
+
+// messages maps exact messages to their kind.
+var messages = map[string]Kind{ //nolint:gochecknoglobals
+	"Server started.": KindServerStarted,
+	"Saving...":       KindSaveHeld,
+	"A previous save has not been completed.": KindSaveNotReady,
+	"Changes to the level are resumed.":       KindSaveResumed,
+	"Stopping server...":                      KindStopping,
+	"Quit correctly":                          KindQuit,
+}
+
+// prefixes maps message prefixes to their kind, in the order they are checked.
+var prefixes = []struct { //nolint:gochecknoglobals
+	prefix string
+	kind   Kind
+}{
+	{"Data saved. Files are now ready to be copied.", KindSaveReady},
+	{"Player connected:", KindPlayerConnected},
+	{"Player disconnected:", KindPlayerDisconnected},
+	{"Level Name:", KindLevelName},
+	{"Version:", KindVersion},
+	{"Version ", KindVersion},
+	{"Syntax error:", KindCommandError},
+	{"Unknown command:", KindCommandError},
+	{"Crash", KindCrash},
+	{"Segmentation fault", KindCrash},
+}
+
+// Parse parses a line of bedrock server output. Lines which aren't recognised are returned with KindOther.
+func Parse(line string) Event {
+	e := Event{Raw: strings.TrimSpace(line)}
+	e.Message = e.Raw
+
+	// [2021-02-01 10:00:00:123 INFO] message or [INFO] message
+	if strings.HasPrefix(e.Raw, "[") {
+		if end := strings.Index(e.Raw, "]"); end > 0 {
+			if fields := strings.Fields(e.Raw[1:end]); len(fields) > 0 {
+				if l, err := ParseLevel(fields[len(fields)-1]); err == nil {
+					e.Level = l
+					e.Time = parseTime(strings.Join(fields[:len(fields)-1], " "))
+					e.Message = strings.TrimSpace(e.Raw[end+1:])
+				}
+			}
+		}
+	}
+
+	if k, ok := messages[e.Message]; ok {
+		e.Kind = k
+		return e
+	}
+
+	// There are 1/10 players online:
+	if strings.HasPrefix(e.Message, "There are ") && strings.HasSuffix(e.Message, " players online:") {
+		e.Kind = KindPlayerList
+		e.Value = strings.TrimSuffix(strings.TrimPrefix(e.Message, "There are "), " players online:")
+
+		return e
+	}
+
+	for _, p := range prefixes {
+		if !strings.HasPrefix(e.Message, p.prefix) {
+			continue
+		}
+
+		e.Kind = p.kind
+
+		switch e.Kind {
+		case KindPlayerConnected, KindPlayerDisconnected:
+			e.Player, e.XUID = parsePlayer(strings.TrimPrefix(e.Message, p.prefix))
+		case KindVersion, KindLevelName:
+			e.Value = strings.TrimSpace(strings.TrimPrefix(e.Message, p.prefix))
+		}
+
+		break
+	}
+
+	return e
+}
+
+// parsePlayer returns the name and xuid from the fields of a player event in the format 'name, xuid: 123'. Newer
+// versions of the server may add further fields after the xuid.
+func parsePlayer(s string) (name, xuid string) {
+	fields := strings.Split(s, ",")
+	name = strings.TrimSpace(fields[0])
+
+	for _, f := range fields[1:] {
+		kv := strings.SplitN(f, ":", 2) //nolint:gomnd
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == "xuid" {
+			xuid = strings.TrimSpace(kv[1])
+		}
+	}
+
+	return name, xuid
+}
+
+// parseTime parses a bedrock timestamp e.g. '2021-02-01 10:00:00:123'. Older versions of the server don't log
+// milliseconds. The zero time is returned if it isn't valid.
+func parseTime(s string) time.Time {
+	if t, err := time.Parse(timeLayoutSeconds, s); err == nil {
+		return t
+	}
+
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(TimeLayout, s[:i]+"."+s[i+1:])
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
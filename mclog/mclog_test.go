@@ -0,0 +1,71 @@
+package mclog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	cases := map[string]Event{
+		"[2021-02-01 10:00:05:123 INFO] Server started.\r": {
+			Time:  time.Date(2021, 2, 1, 10, 0, 5, 123000000, time.UTC),
+			Level: LevelInfo, Kind: KindServerStarted, Message: "Server started.",
+		},
+		"[INFO] Server started.": {Level: LevelInfo, Kind: KindServerStarted, Message: "Server started."},
+		"[2020-12-22 20:24:38 INFO] Version 1.16.200.2": {
+			Time:  time.Date(2020, 12, 22, 20, 24, 38, 0, time.UTC),
+			Level: LevelInfo, Kind: KindVersion, Message: "Version 1.16.200.2", Value: "1.16.200.2",
+		},
+		"[INFO] Version: 1.20.1.02": {Level: LevelInfo, Kind: KindVersion, Message: "Version: 1.20.1.02", Value: "1.20.1.02"},
+		"[INFO] Level Name: Bedrock level": {
+			Level: LevelInfo, Kind: KindLevelName, Message: "Level Name: Bedrock level", Value: "Bedrock level",
+		},
+		"[INFO] Player connected: Steve, xuid: 2535416409681153": {
+			Level: LevelInfo, Kind: KindPlayerConnected, Message: "Player connected: Steve, xuid: 2535416409681153",
+			Player: "Steve", XUID: "2535416409681153",
+		},
+		"[INFO] Player disconnected: Alex Two, xuid: 123, pfid: abc": {
+			Level: LevelInfo, Kind: KindPlayerDisconnected, Message: "Player disconnected: Alex Two, xuid: 123, pfid: abc",
+			Player: "Alex Two", XUID: "123",
+		},
+		"There are 2/10 players online:": {
+			Kind: KindPlayerList, Message: "There are 2/10 players online:", Value: "2/10",
+		},
+		"Saving...": {Kind: KindSaveHeld, Message: "Saving..."},
+		"A previous save has not been completed.": {Kind: KindSaveNotReady, Message: "A previous save has not been completed."},
+		"Data saved. Files are now ready to be copied.": {
+			Kind: KindSaveReady, Message: "Data saved. Files are now ready to be copied.",
+		},
+		"Changes to the level are resumed.": {Kind: KindSaveResumed, Message: "Changes to the level are resumed."},
+		`Syntax error: Unexpected "x": at ">>x<<"`: {
+			Kind: KindCommandError, Message: `Syntax error: Unexpected "x": at ">>x<<"`,
+		},
+		"[2021-02-01 10:00:05:123 ERROR] Crash dump written": {
+			Time:  time.Date(2021, 2, 1, 10, 0, 5, 123000000, time.UTC),
+			Level: LevelError, Kind: KindCrash, Message: "Crash dump written",
+		},
+		"Quit correctly":                              {Kind: KindQuit, Message: "Quit correctly"},
+		"[WARN] something happened":                   {Level: LevelWarn, Message: "something happened"},
+		"[not a level] text":                          {Message: "[not a level] text"},
+		"NO LOG FILE! - setting up server logging...": {Message: "NO LOG FILE! - setting up server logging..."},
+	}
+
+	for line, want := range cases {
+		got := Parse(line)
+		want.Raw = got.Raw
+
+		if got != want {
+			t.Errorf("%q: unexpected event:\nwant %+v\ngot  %+v", line, want, got)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if l, err := ParseLevel("warn"); err != nil || l != LevelWarn {
+		t.Errorf("unexpected level: want %s: got %s (%v)", LevelWarn, l, err)
+	}
+
+	if _, err := ParseLevel("debug"); err == nil {
+		t.Errorf("no error returned for an invalid level")
+	}
+}
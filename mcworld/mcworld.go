@@ -3,7 +3,7 @@ package mcworld
 import (
 	"archive/zip"
 	"fmt"
-	"path/filepath"
+	"path"
 )
 
 // ZipOpener returns a zip.ReadCloser containing world data.
@@ -30,7 +30,7 @@ func (w MCWorld) Open() (*zip.ReadCloser, error) {
 
 func (w MCWorld) Check() error {
 	expected := []string{
-		filepath.Join("db", "CURRENT"),
+		path.Join("db", "CURRENT"),
 		"level.dat",
 		"levelname.txt",
 	}
@@ -0,0 +1,372 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	docker "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+)
+
+const (
+	HostNetwork = "host"      // Network name which runs the server in the host's network namespace
+	DefaultUser = "1000:1000" // User servers run as if no other user is configured, owns the server files in the image
+	rootUser    = "root"
+	userLabel   = CraftLabel + ".user" // Image label naming the user which owns the server files, see Dockerfile
+
+	noNewPrivileges = "no-new-privileges"
+	logDriver       = "json-file"
+	logMaxSize      = "50m"  // Size of each container log file before it is rotated
+	logMaxFiles     = "10"   // Number of container log files kept, older files are deleted
+	logCompress     = "true" // Rotated container log files are compressed to save disk space
+	cpuPeriod       = 100000 // CFS period in microseconds, CPU quotas are relative to this
+
+	portLabel     = CraftLabel + ".port"      // Records the server's port, used when no port is bound
+	ipv6PortLabel = CraftLabel + ".port-ipv6" // Records the server's IPv6 port, used when no port is bound
+)
+
+// Config is the configuration used to create a server's container. It is saved alongside backups so that a stopped
+// server can be created again with the same configuration.
+type Config struct {
+	Port     int               `json:"port"`                // Host port for player connections, 0 uses the next available port
+	IPv6Port int               `json:"ipv6_port,omitempty"` // Host port for IPv6 player connections, 0 doesn't publish it
+	BindIP   string            `json:"bind_ip,omitempty"`   // Host IP the ports are bound to, all IPv4 addresses if empty
+	Network  string            `json:"network,omitempty"`   // Docker network to attach to, HostNetwork or the default if empty
+	Volume   bool              `json:"volume"`              // Mount a volume to persist the server files
+	Image    string            `json:"image"`               // Docker image, ImageName if empty
+	Tags     map[string]string `json:"tags,omitempty"`      // Added to the container labels
+
+	Resources  Resources `json:"resources"`            // Limits on the host resources the server can use
+	User       string    `json:"user,omitempty"`       // User the server runs as, DefaultUser if empty
+	Unconfined bool      `json:"unconfined,omitempty"` // Don't drop capabilities or prevent privileges being gained
+}
+
+// Update returns the configuration with each non-zero setting in u replacing the existing setting. Tags in u are added
+// to the existing tags, replacing any with the same name, and resources are updated with Resources.Update. Volume,
+// User and Unconfined are not changed.
+func (c Config) Update(u Config) Config {
+	if u.Port != 0 {
+		c.Port = u.Port
+	}
+
+	if u.IPv6Port != 0 {
+		c.IPv6Port = u.IPv6Port
+	}
+
+	if u.BindIP != "" {
+		c.BindIP = u.BindIP
+	}
+
+	if u.Network != "" {
+		c.Network = u.Network
+	}
+
+	if u.Image != "" {
+		c.Image = u.Image
+	}
+
+	if len(u.Tags) > 0 {
+		tags := make(map[string]string, len(c.Tags)+len(u.Tags))
+
+		for _, t := range []map[string]string{c.Tags, u.Tags} {
+			for k, v := range t {
+				tags[k] = v
+			}
+		}
+
+		c.Tags = tags
+	}
+
+	c.Resources = c.Resources.Update(u.Resources)
+
+	return c
+}
+
+// Resources limits the host resources a server's container can use. Zero values are unlimited.
+type Resources struct {
+	Memory    int64 `json:"memory,omitempty"`     // Memory limit in bytes, swap is not used
+	CPUShares int64 `json:"cpu_shares,omitempty"` // CPU weight relative to other containers, 1024 is docker's default
+	CPUQuota  int64 `json:"cpu_quota,omitempty"`  // Microseconds of CPU time per 100ms e.g. 150000 for 1.5 CPUs
+	PidsLimit int64 `json:"pids_limit,omitempty"` // Maximum number of processes
+}
+
+// Update returns the resources with each non-zero value in u replacing the existing value.
+func (r Resources) Update(u Resources) Resources {
+	if u.Memory != 0 {
+		r.Memory = u.Memory
+	}
+
+	if u.CPUShares != 0 {
+		r.CPUShares = u.CPUShares
+	}
+
+	if u.CPUQuota != 0 {
+		r.CPUQuota = u.CPUQuota
+	}
+
+	if u.PidsLimit != 0 {
+		r.PidsLimit = u.PidsLimit
+	}
+
+	return r
+}
+
+func (r Resources) container() container.Resources {
+	res := container.Resources{
+		Memory:     r.Memory,
+		MemorySwap: r.Memory,
+		CPUShares:  r.CPUShares,
+		CPUQuota:   r.CPUQuota,
+	}
+
+	if r.CPUQuota != 0 {
+		res.CPUPeriod = cpuPeriod
+	}
+
+	if r.PidsLimit != 0 {
+		pids := r.PidsLimit
+		res.PidsLimit = &pids
+	}
+
+	return res
+}
+
+func resources(r container.Resources) Resources {
+	res := Resources{
+		Memory:    r.Memory,
+		CPUShares: r.CPUShares,
+		CPUQuota:  r.CPUQuota,
+	}
+
+	if r.PidsLimit != nil && *r.PidsLimit > 0 {
+		res.PidsLimit = *r.PidsLimit
+	}
+
+	return res
+}
+
+// UpdateResources changes the resource limits of the server's container. Zero values in r are left unchanged.
+func (s *Server) UpdateResources(ctx context.Context, r Resources) error {
+	inspect, err := s.ContainerInspect(ctx, s.ContainerID)
+	if err != nil {
+		return fmt.Errorf("inspecting container: %w", err)
+	}
+
+	_, err = s.ContainerUpdate(ctx, s.ContainerID, container.UpdateConfig{
+		Resources: resources(inspect.HostConfig.Resources).Update(r).container(),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: updating container resources: %w", s.ContainerName, err)
+	}
+
+	return nil
+}
+
+// Properties returns the server.properties values which the configuration depends on, as 'key=value' strings. With
+// host networking the server process listens on the host's ports directly, so they must be set in server.properties.
+func (c Config) Properties() []string {
+	if c.Network != HostNetwork {
+		return nil
+	}
+
+	props := []string{fmt.Sprintf("server-port=%d", c.Port)}
+
+	if c.IPv6Port != 0 {
+		props = append(props, fmt.Sprintf("server-portv6=%d", c.IPv6Port))
+	}
+
+	return props
+}
+
+func (c Config) image() string {
+	if c.Image == "" {
+		return ImageName
+	}
+
+	return c.Image
+}
+
+// user returns the user the server runs as. If no user is configured, it is the user named by the image's user label.
+// Images built before servers ran as a non-root user don't have the label and their server files are owned by root,
+// so servers created from them run as root.
+func (c Config) user(ctx context.Context, images client.ImageAPIClient) (string, error) {
+	if c.User != "" {
+		return c.User, nil
+	}
+
+	img, _, err := images.ImageInspectWithRaw(ctx, c.image())
+	if err != nil {
+		return "", fmt.Errorf("inspecting image '%s': %w", c.image(), err)
+	}
+
+	if img.Config == nil || img.Config.Labels[userLabel] == "" {
+		return rootUser, nil
+	}
+
+	return img.Config.Labels[userLabel], nil
+}
+
+// hostConfig returns the host configuration of the server's container, excluding port bindings and mounts. Container
+// logs are rotated so that they can't grow without limit. The limit is large enough to hold the output of a long
+// running server, which is archived when it is stopped, but the oldest output is lost once it is reached.
+func (c Config) hostConfig() *container.HostConfig {
+	hc := &container.HostConfig{
+		NetworkMode: container.NetworkMode(c.Network),
+		AutoRemove:  !c.Volume,
+		Resources:   c.Resources.container(),
+		LogConfig: container.LogConfig{
+			Type:   logDriver,
+			Config: map[string]string{"max-size": logMaxSize, "max-file": logMaxFiles, "compress": logCompress},
+		},
+	}
+
+	if !c.Unconfined {
+		hc.CapDrop = []string{"ALL"}
+		hc.SecurityOpt = []string{noNewPrivileges}
+	}
+
+	return hc
+}
+
+func (c Config) labels() map[string]string {
+	labels := map[string]string{CraftLabel: ""}
+
+	for k, v := range c.Tags {
+		labels[k] = v
+	}
+
+	labels[portLabel] = strconv.Itoa(c.Port)
+
+	if c.IPv6Port != 0 {
+		labels[ipv6PortLabel] = strconv.Itoa(c.IPv6Port)
+	}
+
+	return labels
+}
+
+// bindIP returns the host IP which ports are bound to.
+func (c Config) bindIP() string {
+	if c.BindIP == "" {
+		return anyIP
+	}
+
+	return c.BindIP
+}
+
+// Config returns the configuration of the server's container.
+func (s *Server) Config(ctx context.Context) (Config, error) {
+	inspect, err := s.ContainerInspect(ctx, s.ContainerID)
+	if err != nil {
+		return Config{}, fmt.Errorf("inspecting container: %w", err)
+	}
+
+	port, err := s.Port(ctx)
+	if err != nil {
+		return Config{}, err
+	}
+
+	v6Port, _, err := hostPort(inspect, ipv6Port, ipv6PortLabel)
+	if err != nil {
+		return Config{}, err
+	}
+
+	cfg := Config{
+		Port:      port,
+		IPv6Port:  v6Port,
+		Volume:    len(inspect.Mounts) > 0,
+		Image:     inspect.Config.Image,
+		Resources: resources(inspect.HostConfig.Resources),
+	}
+
+	if b, ok := binding(inspect, defaultPort); ok && b.HostIP != anyIP {
+		cfg.BindIP = b.HostIP
+	}
+
+	switch u := inspect.Config.User; u {
+	case DefaultUser:
+	case "":
+		// Servers created before DefaultUser was introduced run as the image's user
+		cfg.User = rootUser
+	default:
+		cfg.User = u
+	}
+
+	cfg.Unconfined = !confined(inspect.HostConfig)
+
+	switch n := string(inspect.HostConfig.NetworkMode); n {
+	case "", "default", "bridge":
+	default:
+		cfg.Network = n
+	}
+
+	for k, v := range inspect.Config.Labels {
+		if k == CraftLabel || strings.HasPrefix(k, CraftLabel+".") {
+			continue
+		}
+
+		if cfg.Tags == nil {
+			cfg.Tags = make(map[string]string)
+		}
+
+		cfg.Tags[k] = v
+	}
+
+	return cfg, nil
+}
+
+// confined returns true if the container has no capabilities and can't gain privileges.
+func confined(hc *container.HostConfig) bool {
+	dropAll, noNew := false, false
+
+	for _, c := range hc.CapDrop {
+		dropAll = dropAll || strings.EqualFold(c, "ALL")
+	}
+
+	for _, o := range hc.SecurityOpt {
+		noNew = noNew || o == noNewPrivileges || o == noNewPrivileges+":true"
+	}
+
+	return dropAll && noNew && len(hc.CapAdd) == 0
+}
+
+// binding returns the host binding of the given UDP container port.
+func binding(inspect docker.ContainerJSON, containerPort int) (nat.PortBinding, bool) {
+	for p, bindings := range inspect.HostConfig.PortBindings {
+		if p.Int() != containerPort || !strings.EqualFold(p.Proto(), protocol) {
+			continue
+		}
+
+		for _, b := range bindings {
+			if b.HostPort != "" {
+				return b, true
+			}
+		}
+	}
+
+	return nat.PortBinding{}, false
+}
+
+// hostPort returns the host port for the given UDP container port. If the port isn't bound, as with host networking,
+// the port recorded in the given label is returned. If neither exist, false is returned.
+func hostPort(inspect docker.ContainerJSON, containerPort int, label string) (int, bool, error) {
+	v := inspect.Config.Labels[label]
+
+	if b, ok := binding(inspect, containerPort); ok {
+		v = b.HostPort
+	}
+
+	if v == "" {
+		return 0, false, nil
+	}
+
+	p, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, false, fmt.Errorf("reading host port for container port %d: %w", containerPort, err)
+	}
+
+	return p, true, nil
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/danhale-git/craft/internal/mock"
+)
+
+func TestServer_Config(t *testing.T) {
+	ctx := context.Background()
+	d := mock.NewDocker(ImageName)
+
+	cases := map[string]Config{
+		"default": {Port: 19140, Image: ImageName},
+		"bridge": {
+			Port: 19141, IPv6Port: 19142, BindIP: "192.168.1.10", Network: "mynetwork", Volume: true, Image: ImageName,
+			Tags:      map[string]string{"owner": "me"},
+			Resources: Resources{Memory: 2 << 30, CPUShares: 512, CPUQuota: 150000, PidsLimit: 200},
+		},
+		"unconfined": {Port: 19145, Image: ImageName, User: "root", Unconfined: true},
+		"host":       {Port: 19143, IPv6Port: 19144, Network: HostNetwork, Image: ImageName},
+	}
+
+	for name, want := range cases {
+		s, err := New(ctx, d, name, want)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		got, err := s.Config(ctx)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: unexpected config: want %+v: got %+v", name, want, got)
+		}
+	}
+}
+
+func TestServer_Config_OldImage(t *testing.T) {
+	ctx := context.Background()
+	d := mock.NewDocker(ImageName)
+
+	// Images built before servers ran as a non-root user have no user label
+	d.ImageLabels = nil
+
+	s, err := New(ctx, d, "old", Config{Port: 19146})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := s.Config(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.User != rootUser {
+		t.Errorf("unexpected user for a server created from an image without the user label: want %s: got %s",
+			rootUser, cfg.User)
+	}
+
+	if s, err = New(ctx, d, "configured", Config{Port: 19147, User: DefaultUser}); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg, err = s.Config(ctx); err != nil || cfg.User != "" {
+		t.Errorf("unexpected user for a server configured with the default user: '%s' (%v)", cfg.User, err)
+	}
+}
+
+func TestServer_Port(t *testing.T) {
+	ctx := context.Background()
+	d := mock.NewDocker(ImageName)
+
+	s, err := New(ctx, d, "ipv6", Config{Port: 19150, IPv6Port: 19151})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The IPv6 binding must not be reported as the server's port
+	for i := 0; i < 20; i++ {
+		if p, err := s.Port(ctx); err != nil || p != 19150 {
+			t.Fatalf("unexpected port: want 19150: got %d (%v)", p, err)
+		}
+	}
+
+	s, err = New(ctx, d, "host", Config{Port: 19152, Network: HostNetwork})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p, err := s.Port(ctx); err != nil || p != 19152 {
+		t.Errorf("unexpected port with host networking: want 19152: got %d (%v)", p, err)
+	}
+}
+
+func TestConfig_Properties(t *testing.T) {
+	if p := (Config{Port: 19132}).Properties(); p != nil {
+		t.Errorf("unexpected properties without host networking: %v", p)
+	}
+
+	want := []string{"server-port=19200", "server-portv6=19201"}
+
+	if got := (Config{Port: 19200, IPv6Port: 19201, Network: HostNetwork}).Properties(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected properties: want %v: got %v", want, got)
+	}
+}
+
+func TestServer_UpdateResources(t *testing.T) {
+	ctx := context.Background()
+	d := mock.NewDocker(ImageName)
+
+	s, err := New(ctx, d, "srv", Config{Port: 19160, Resources: Resources{Memory: 1 << 30, PidsLimit: 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.UpdateResources(ctx, Resources{Memory: 2 << 30, CPUQuota: 50000}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := s.Config(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Resources{Memory: 2 << 30, CPUQuota: 50000, PidsLimit: 100}
+	if cfg.Resources != want {
+		t.Errorf("unexpected resources: want %+v: got %+v", want, cfg.Resources)
+	}
+}
+
+func TestConfig_hostConfig(t *testing.T) {
+	hc := Config{}.hostConfig()
+
+	if !confined(hc) {
+		t.Errorf("default host config doesn't drop capabilities and prevent new privileges: %+v", hc)
+	}
+
+	if hc.LogConfig.Config["max-size"] == "" || hc.LogConfig.Config["max-file"] == "" {
+		t.Errorf("container log size is not limited: %+v", hc.LogConfig)
+	}
+
+	if hc := (Config{Unconfined: true}).hostConfig(); confined(hc) {
+		t.Errorf("unconfined host config is confined: %+v", hc)
+	}
+}
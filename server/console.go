@@ -0,0 +1,178 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/danhale-git/craft/mclog"
+)
+
+const (
+	DefaultQuietPeriod = 500 * time.Millisecond // Time without output after which a command is assumed to be complete
+	echoTimeout        = 5 * time.Second        // Time allowed for a command to be echoed by the server cli
+)
+
+// Response is the output of a command run in the server cli.
+type Response struct {
+	Command string   `json:"command"`
+	Lines   []string `json:"lines"` // Output produced by the command, excluding the echo of the command
+}
+
+// CommandError is returned when the server cli reports that a command could not be run e.g. because of a syntax error.
+type CommandError struct {
+	Command string
+	Message string // The error reported by the server
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("command '%s' failed: %s", e.Command, e.Message)
+}
+
+// Is implements Is(error) to support errors.Is
+func (e *CommandError) Is(tgt error) bool {
+	_, ok := tgt.(*CommandError)
+	return ok
+}
+
+// Console runs commands in the server cli and returns their output. It holds a connection to the container, so
+// multiple commands can be run without attaching again. Close must be called when the console is no longer needed.
+type Console struct {
+	QuietPeriod time.Duration // Time without output after which a command is complete, DefaultQuietPeriod if zero
+
+	conn   net.Conn
+	lines  chan string // Lines of output, closed when the log reader ends
+	cancel context.CancelFunc
+}
+
+// Console attaches to the server cli and returns a Console which runs commands in it. Only output logged after this
+// function is called is read.
+func (s *Server) Console(ctx context.Context) (*Console, error) {
+	logCtx, cancel := context.WithCancel(ctx)
+
+	logs, err := s.LogReader(logCtx, 0)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	conn, err := s.CommandWriter(ctx)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("attaching to server cli: %w", err)
+	}
+
+	c := &Console{
+		conn:   conn,
+		lines:  make(chan string),
+		cancel: cancel,
+	}
+
+	go c.read(logCtx, logs)
+
+	return c, nil
+}
+
+// read sends each line of output to c.lines until ctx is cancelled or the end of the logs.
+func (c *Console) read(ctx context.Context, logs *bufio.Reader) {
+	defer close(c.lines)
+
+	scanner := bufio.NewScanner(logs)
+
+	for scanner.Scan() {
+		select {
+		case c.lines <- strings.TrimRight(scanner.Text(), "\r"):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Exec runs the command and returns its output. Output logged before the server cli echoes the command is ignored.
+// The command is complete when no output is logged for the quiet period, the server reports a command error or the
+// server process quits. If the server reports a command error, the response is returned with an error of type
+// CommandError.
+func (c *Console) Exec(ctx context.Context, command string) (Response, error) {
+	command = strings.TrimSpace(command)
+	resp := Response{Command: command, Lines: make([]string, 0)}
+
+	if _, err := c.conn.Write([]byte(command + "\n")); err != nil {
+		return resp, fmt.Errorf("writing command '%s': %w", command, err)
+	}
+
+	// Wait for the echo of the command
+	echo := time.NewTimer(echoTimeout)
+	defer echo.Stop()
+
+	for echoed := false; !echoed; {
+		select {
+		case l, ok := <-c.lines:
+			if !ok {
+				return resp, fmt.Errorf("end of server output before command '%s' was echoed", command)
+			}
+
+			echoed = strings.TrimSpace(l) == command
+		case <-echo.C:
+			return resp, fmt.Errorf("command '%s' was not echoed by the server cli within %s", command, echoTimeout)
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		}
+	}
+
+	quietPeriod := c.QuietPeriod
+	if quietPeriod == 0 {
+		quietPeriod = DefaultQuietPeriod
+	}
+
+	quiet := time.NewTimer(quietPeriod)
+	defer quiet.Stop()
+
+	for {
+		select {
+		case l, ok := <-c.lines:
+			if !ok {
+				return resp, nil
+			}
+
+			resp.Lines = append(resp.Lines, l)
+
+			switch e := mclog.Parse(l); e.Kind { //nolint:exhaustive
+			case mclog.KindCommandError:
+				return resp, &CommandError{Command: command, Message: e.Message}
+			case mclog.KindQuit:
+				return resp, nil
+			}
+
+			if !quiet.Stop() {
+				<-quiet.C
+			}
+
+			quiet.Reset(quietPeriod)
+		case <-quiet.C:
+			return resp, nil
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		}
+	}
+}
+
+// Close detaches from the server cli and stops reading its output.
+func (c *Console) Close() error {
+	c.cancel()
+
+	return c.conn.Close()
+}
+
+// Exec runs the command in the server cli and returns its output. See Console.Exec.
+func (s *Server) Exec(ctx context.Context, command string) (Response, error) {
+	c, err := s.Console(ctx)
+	if err != nil {
+		return Response{}, err
+	}
+	defer c.Close()
+
+	return c.Exec(ctx, command)
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/danhale-git/craft/internal/mock"
+)
+
+func TestConsole_Exec(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	d := mock.NewDocker(ImageName)
+
+	s, err := New(ctx, d, "srv", Config{Volume: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.RunBedrock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := d.Container("srv")
+	b.Connect("Steve", "123")
+
+	c, err := s.Console(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.QuietPeriod = 50 * time.Millisecond
+
+	// Output logged before the command is echoed is not part of the response
+	b.Log("[INFO] Running AutoCompaction...")
+
+	resp, err := c.Exec(ctx, "list")
+	if err != nil {
+		t.Fatalf("error returned for a valid command: %s", err)
+	}
+
+	if len(resp.Lines) != 2 || resp.Lines[0] != "There are 1/10 players online:" || resp.Lines[1] != "Steve" {
+		t.Errorf("unexpected response to list: %q", resp.Lines)
+	}
+
+	// Commands without output return once the quiet period has passed
+	if resp, err = c.Exec(ctx, "say hello"); err != nil || len(resp.Lines) != 0 {
+		t.Errorf("unexpected response to say: %q (%v)", resp.Lines, err)
+	}
+
+	resp, err = c.Exec(ctx, "notacommand")
+
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("unexpected error for an invalid command: want CommandError: got %v", err)
+	}
+
+	if cmdErr.Message != `Syntax error: Unexpected "notacommand": at ">>notacommand<<"` || len(resp.Lines) != 1 {
+		t.Errorf("unexpected command error: %s: %q", cmdErr.Message, resp.Lines)
+	}
+}
+
+func TestServer_Exec(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	d := mock.NewDocker(ImageName)
+
+	s, err := New(ctx, d, "srv", Config{Volume: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.RunBedrock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := s.Exec(ctx, "time set 0600")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Lines) != 1 || resp.Lines[0] != "Set the time to 0600" {
+		t.Errorf("unexpected response: %q", resp.Lines)
+	}
+}
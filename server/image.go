@@ -18,8 +18,8 @@ import (
 )
 
 // DockerImageExists returns true if the craft server image exists.
-func DockerImageExists(c client.ImageAPIClient) (bool, error) {
-	images, err := c.ImageList(context.Background(), docker.ImageListOptions{})
+func DockerImageExists(ctx context.Context, c client.ImageAPIClient) (bool, error) {
+	images, err := c.ImageList(ctx, docker.ImageListOptions{})
 	if err != nil {
 		return false, err
 	}
@@ -37,7 +37,7 @@ func DockerImageExists(c client.ImageAPIClient) (bool, error) {
 var dockerfile []byte //nolint:gochecknoglobals // embed needs a global
 
 // BuildDockerImage builds the server image.
-func BuildDockerImage(serverURL string, noCache bool) error {
+func BuildDockerImage(ctx context.Context, c client.ImageAPIClient, serverURL string, noCache bool) error {
 	var buf bytes.Buffer
 	tw := tar.NewWriter(&buf)
 
@@ -59,8 +59,8 @@ func BuildDockerImage(serverURL string, noCache bool) error {
 	}
 
 	// Build image
-	response, err := dockerClient().ImageBuild(
-		context.Background(),
+	response, err := c.ImageBuild(
+		ctx,
 		&buf,
 		docker.ImageBuildOptions{
 			Dockerfile: "Dockerfile",
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	docker "github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// PortRange is an inclusive range of host ports which may be allocated to servers.
+type PortRange struct {
+	Min, Max int
+}
+
+// DefaultPortRange is the range of ports allocated to servers when no other range is configured.
+var DefaultPortRange = PortRange{Min: defaultPort, Max: defaultPort + 99} //nolint:gochecknoglobals
+
+// ParsePortRange parses a port range in the format 'min-max' e.g. '19132-19231'.
+func ParsePortRange(s string) (PortRange, error) {
+	split := strings.SplitN(s, "-", 2)
+	if len(split) != 2 { //nolint:gomnd
+		return PortRange{}, fmt.Errorf("invalid port range '%s' should be 'min-max'", s)
+	}
+
+	min, err := strconv.Atoi(strings.TrimSpace(split[0]))
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port range '%s': %w", s, err)
+	}
+
+	max, err := strconv.Atoi(strings.TrimSpace(split[1]))
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port range '%s': %w", s, err)
+	}
+
+	if min < 1 || max > 65535 || min > max {
+		return PortRange{}, fmt.Errorf("invalid port range '%s': ports must be 1-65535 and min must not exceed max", s)
+	}
+
+	return PortRange{Min: min, Max: max}, nil
+}
+
+func (r PortRange) String() string {
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// hostPortAvailable returns true if the UDP port is not in use on the host. It may be replaced in tests.
+var hostPortAvailable = func(port int) bool { //nolint:gochecknoglobals
+	conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+
+	_ = conn.Close()
+
+	return true
+}
+
+// NextAvailablePort returns the lowest port in the range which is not bound by any docker container, running or
+// stopped, is not reserved and is not in use on the host. If every port is unavailable, an error wrapping
+// ErrNoAvailablePort is returned.
+func NextAvailablePort(ctx context.Context, c client.ContainerAPIClient, r PortRange, reserved []int) (int, error) {
+	unavailable, err := unavailablePorts(ctx, c, reserved)
+	if err != nil {
+		return 0, err
+	}
+
+	for p := r.Min; p <= r.Max; p++ {
+		if unavailable[p] || !hostPortAvailable(p) {
+			continue
+		}
+
+		return p, nil
+	}
+
+	return 0, fmt.Errorf("%w: all ports from %d to %d are in use", ErrNoAvailablePort, r.Min, r.Max)
+}
+
+// CheckPortAvailable returns an error wrapping ErrPortUnavailable if the port is bound by any docker container, running
+// or stopped, is reserved or is in use on the host.
+func CheckPortAvailable(ctx context.Context, c client.ContainerAPIClient, port int, reserved []int) error {
+	unavailable, err := unavailablePorts(ctx, c, reserved)
+	if err != nil {
+		return err
+	}
+
+	if unavailable[port] || !hostPortAvailable(port) {
+		return fmt.Errorf("%w: %d is in use by another server or on the host", ErrPortUnavailable, port)
+	}
+
+	return nil
+}
+
+// unavailablePorts returns the ports bound by docker containers and the reserved ports.
+func unavailablePorts(ctx context.Context, c client.ContainerAPIClient, reserved []int) (map[int]bool, error) {
+	unavailable, err := boundPorts(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range reserved {
+		unavailable[p] = true
+	}
+
+	return unavailable, nil
+}
+
+// boundPorts returns the host ports bound by all docker containers, including stopped containers which will bind them
+// again when they start.
+func boundPorts(ctx context.Context, c client.ContainerAPIClient) (map[int]bool, error) {
+	containers, err := c.ContainerList(ctx, docker.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, fmt.Errorf("listing docker containers: %s", err)
+	}
+
+	ports := make(map[int]bool)
+
+	for _, ctr := range containers {
+		inspect, err := c.ContainerInspect(ctx, ctr.ID)
+		if err != nil {
+			if client.IsErrNotFound(err) {
+				// Removed since listing
+				continue
+			}
+
+			return nil, fmt.Errorf("inspecting container: %w", err)
+		}
+
+		for _, bindings := range inspect.HostConfig.PortBindings {
+			for _, b := range bindings {
+				if p, err := strconv.Atoi(b.HostPort); err == nil {
+					ports[p] = true
+				}
+			}
+		}
+
+		// Servers using host networking bind no ports but record the ports they listen on
+		for _, l := range []string{portLabel, ipv6PortLabel} {
+			if p, err := strconv.Atoi(inspect.Config.Labels[l]); err == nil {
+				ports[p] = true
+			}
+		}
+	}
+
+	return ports, nil
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/danhale-git/craft/internal/mock"
+)
+
+func TestParsePortRange(t *testing.T) {
+	r, err := ParsePortRange("19132-19140")
+	if err != nil {
+		t.Fatalf("error returned for valid input: %s", err)
+	}
+
+	if r != (PortRange{Min: 19132, Max: 19140}) {
+		t.Errorf("unexpected range: %+v", r)
+	}
+
+	for _, invalid := range []string{"19132", "a-b", "19140-19132", "0-10", "1-70000"} {
+		if _, err := ParsePortRange(invalid); err == nil {
+			t.Errorf("no error returned for invalid range '%s'", invalid)
+		}
+	}
+}
+
+func TestNextAvailablePort(t *testing.T) {
+	ctx := context.Background()
+	d := mock.NewDocker(ImageName)
+
+	// 19133 is in use on the host
+	defer func(f func(int) bool) { hostPortAvailable = f }(hostPortAvailable)
+	hostPortAvailable = func(p int) bool { return p != 19133 }
+
+	// 19132 is bound by a stopped container
+	s, err := New(ctx, d, "stopped", Config{Port: 19132, Volume: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.StopContainer(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	r := PortRange{Min: 19132, Max: 19135}
+
+	// 19134 is reserved
+	p, err := NextAvailablePort(ctx, d, r, []int{19134})
+	if err != nil {
+		t.Fatalf("error returned when a port is available: %s", err)
+	}
+
+	if p != 19135 {
+		t.Errorf("unexpected port: want 19135: got %d", p)
+	}
+
+	_, err = NextAvailablePort(ctx, d, r, []int{19134, 19135})
+	if !errors.Is(err, ErrNoAvailablePort) {
+		t.Errorf("unexpected error when all ports are unavailable: want ErrNoAvailablePort: got %v", err)
+	}
+}
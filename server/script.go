@@ -0,0 +1,122 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Status of a command run as part of a script.
+const (
+	StatusOK      = "ok"      // The command ran without error
+	StatusFailed  = "failed"  // The server reported an error or the command could not be run
+	StatusSkipped = "skipped" // The command was not run because an earlier command failed
+)
+
+// Step is a command or a wait directive in a script.
+type Step struct {
+	Line    int           // The line number in the script, starting at 1
+	Command string        // Empty for a wait directive
+	Wait    time.Duration // The time to wait before running the next step
+}
+
+// ScriptResult is the result of running one command in a script. It is the schema for machine-readable output, fields
+// may be added but existing fields should not be changed or removed.
+type ScriptResult struct {
+	Line    int      `json:"line" yaml:"line"`
+	Command string   `json:"command" yaml:"command"`
+	Status  string   `json:"status" yaml:"status"` // StatusOK, StatusFailed or StatusSkipped
+	Lines   []string `json:"lines" yaml:"lines"`   // Output produced by the command
+	Error   string   `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// ParseScript reads a script with one server command per line. Empty lines and lines beginning with '#' are ignored.
+// A line in the format 'wait <duration>' e.g. 'wait 5s' pauses the script for the duration.
+func ParseScript(r io.Reader) ([]Step, error) {
+	steps := make([]Step, 0)
+	scanner := bufio.NewScanner(r)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if fields[0] != "wait" {
+			steps = append(steps, Step{Line: n, Command: line})
+			continue
+		}
+
+		if len(fields) != 2 { //nolint:gomnd
+			return nil, fmt.Errorf("line %d: wait must be followed by a duration e.g. 'wait 5s'", n)
+		}
+
+		d, err := time.ParseDuration(fields[1])
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("line %d: invalid wait duration '%s'", n, fields[1])
+		}
+
+		steps = append(steps, Step{Line: n, Wait: d})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading script: %w", err)
+	}
+
+	return steps, nil
+}
+
+// RunScript runs each step of the script in order and returns the result of each command. If stopOnError is true,
+// the commands following a failed command are skipped. The error of the first command which failed is returned.
+func (c *Console) RunScript(ctx context.Context, steps []Step, stopOnError bool) ([]ScriptResult, error) {
+	results := make([]ScriptResult, 0)
+
+	var firstErr error
+
+	for _, s := range steps {
+		if s.Command == "" {
+			if firstErr != nil && stopOnError {
+				continue
+			}
+
+			if err := sleep(ctx, s.Wait); err != nil {
+				return results, err
+			}
+
+			continue
+		}
+
+		result := ScriptResult{Line: s.Line, Command: s.Command, Status: StatusSkipped, Lines: make([]string, 0)}
+
+		if firstErr != nil && stopOnError {
+			results = append(results, result)
+			continue
+		}
+
+		resp, err := c.Exec(ctx, s.Command)
+		result.Lines = resp.Lines
+		result.Status = StatusOK
+
+		if err != nil {
+			result.Status = StatusFailed
+			result.Error = err.Error()
+
+			if firstErr == nil {
+				firstErr = fmt.Errorf("line %d: %w", s.Line, err)
+			}
+		}
+
+		results = append(results, result)
+
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+	}
+
+	return results, firstErr
+}
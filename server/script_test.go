@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danhale-git/craft/internal/mock"
+)
+
+func TestParseScript(t *testing.T) {
+	script := `# Reset the arena
+gamerule pvp false
+
+	wait 1m30s
+  time set 0600
+wait 0s`
+
+	got, err := ParseScript(strings.NewReader(script))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []Step{
+		{Line: 2, Command: "gamerule pvp false"},
+		{Line: 4, Wait: 90 * time.Second},
+		{Line: 5, Command: "time set 0600"},
+		{Line: 6},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected steps:\nwant %+v\ngot  %+v", want, got)
+	}
+
+	for _, invalid := range []string{"wait", "wait 5", "wait -1s", "say hi\nwait 5s now"} {
+		if _, err := ParseScript(strings.NewReader(invalid)); err == nil {
+			t.Errorf("no error returned for invalid script %q", invalid)
+		}
+	}
+}
+
+func TestConsole_RunScript(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	d := mock.NewDocker(ImageName)
+
+	s, err := New(ctx, d, "srv", Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.RunBedrock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := s.Console(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.QuietPeriod = 50 * time.Millisecond
+
+	steps, err := ParseScript(strings.NewReader(`time set 0600
+wait 10ms
+notacommand
+gamerule pvp false`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := func(results []ScriptResult) []string {
+		s := make([]string, len(results))
+		for i, r := range results {
+			s[i] = r.Status
+		}
+
+		return s
+	}
+
+	results, err := c.RunScript(ctx, steps, true)
+	if !errors.Is(err, &CommandError{}) {
+		t.Errorf("unexpected error: want CommandError: got %v", err)
+	}
+
+	if got, want := statuses(results), []string{StatusOK, StatusFailed, StatusSkipped}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected statuses when stopping on error: want %v: got %v", want, got)
+	}
+
+	if results[0].Line != 1 || len(results[0].Lines) != 1 || results[0].Lines[0] != "Set the time to 0600" {
+		t.Errorf("unexpected result for the first command: %+v", results[0])
+	}
+
+	if results[1].Line != 3 || results[1].Error == "" {
+		t.Errorf("unexpected result for the failed command: %+v", results[1])
+	}
+
+	results, err = c.RunScript(ctx, steps, false)
+	if !errors.Is(err, &CommandError{}) {
+		t.Errorf("unexpected error: want CommandError: got %v", err)
+	}
+
+	if got, want := statuses(results), []string{StatusOK, StatusFailed, StatusOK}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected statuses when continuing on error: want %v: got %v", want, got)
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/docker/docker/api/types/mount"
 
 	"github.com/danhale-git/craft/internal/logger"
+	"github.com/danhale-git/craft/mclog"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/go-connections/nat"
 
@@ -29,20 +30,24 @@ const (
 	volumeLabel  = "danhale-git_craft"
 	anyIP        = "0.0.0.0"                        // Refers to any/all IPv4 addresses
 	defaultPort  = 19132                            // Default port for player connections
+	ipv6Port     = 19133                            // Default port for IPv6 player connections
 	protocol     = "UDP"                            // MC uses UDP
 	ImageName    = "craft_bedrock_server:autobuild" // The name of the docker image to use
-	stopTimeout  = 30
+	stopTimeout  = 30 * time.Second                 // Time allowed for the server process and container to stop
 	RunMCCommand = "cd bedrock; LD_LIBRARY_PATH=. ./bedrock_server"
+	quitMessage  = "Quit correctly" // Logged by the server process when it has stopped cleanly
 )
 
-func dockerClient() *client.Client {
-	c, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		logger.Error.Fatalf("Error: Failed to create new docker client: %s", err)
-	}
+var (
+	// ErrNoAvailablePort is returned when every port in the range used for craft servers is in use.
+	ErrNoAvailablePort = errors.New("no available port")
 
-	return c
-}
+	// ErrPortUnavailable is returned when a port given for a server is already in use.
+	ErrPortUnavailable = errors.New("port is unavailable")
+
+	// ErrUncleanShutdown is returned when the server process doesn't report that it quit correctly after being stopped.
+	ErrUncleanShutdown = errors.New("server did not shut down cleanly")
+)
 
 // Server is a wrapper for docker's client.ContainerAPIClient which operates on a specific container.
 type Server struct {
@@ -50,39 +55,58 @@ type Server struct {
 	ContainerName, ContainerID string
 }
 
-// New creates a new craft server container and returns a docker client for it.
+// New creates a new craft server container using the given docker client and returns a Server for it.
 // It is the equivalent of the following docker command:
 //
 //    docker run -d -e EULA=TRUE -p <HOST_PORT>:19132/udp <imageName>
 //
-// If mountVolume is true, a local volume will also be mounted and autoremove will be disabled.
-func New(hostPort int, name string, mountVolume bool) (*Server, error) {
-	if hostPort == 0 {
-		hostPort = nextAvailablePort()
+// If cfg.Volume is true, a local volume will also be mounted and autoremove will be disabled. If cfg.IPv6Port is set,
+// it is also bound to the IPv6 port 19133/udp. Ports are not bound if cfg.Network is HostNetwork. Unless
+// cfg.Unconfined is true, all capabilities are dropped and the server process can't gain privileges. If cfg.User is
+// empty, the server runs as the non-root user which owns the server files in the image, or as root if the image was
+// built before this default.
+func New(ctx context.Context, c client.CommonAPIClient, name string, cfg Config) (*Server, error) {
+	var err error
+
+	if cfg.Port == 0 {
+		cfg.Port, err = NextAvailablePort(ctx, c, DefaultPortRange, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.IPv6Port != 0 && cfg.IPv6Port == cfg.Port {
+		return nil, fmt.Errorf("%w: the IPv6 port must not be the same as the port %d", ErrPortUnavailable, cfg.Port)
 	}
 
-	c, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	user, err := cfg.user(ctx, c)
 	if err != nil {
-		logger.Error.Fatalf("Error: Failed to create new docker client: %s", err)
+		return nil, err
 	}
 
-	ctx := context.Background()
+	exposedPorts := nat.PortSet{}
+	portBinding := nat.PortMap{}
 
-	hostBinding := nat.PortBinding{
-		HostIP:   anyIP,
-		HostPort: strconv.Itoa(hostPort),
-	}
+	// -p <BIND_IP>:<HOST_PORT>:19132/udp -p <BIND_IP>:<IPV6_PORT>:19133/udp
+	for containerPort, hostPort := range map[int]int{defaultPort: cfg.Port, ipv6Port: cfg.IPv6Port} {
+		if hostPort == 0 || cfg.Network == HostNetwork {
+			continue
+		}
 
-	// -p <HOST_PORT>:19132/udp
-	containerPort, err := nat.NewPort(protocol, strconv.Itoa(defaultPort))
-	if err != nil {
-		return nil, fmt.Errorf("creating container port: %s", err)
-	}
+		p, err := nat.NewPort(protocol, strconv.Itoa(containerPort))
+		if err != nil {
+			return nil, fmt.Errorf("creating container port: %s", err)
+		}
 
-	portBinding := nat.PortMap{containerPort: []nat.PortBinding{hostBinding}}
+		exposedPorts[p] = struct{}{}
+		portBinding[p] = []nat.PortBinding{{
+			HostIP:   cfg.bindIP(),
+			HostPort: strconv.Itoa(hostPort),
+		}}
+	}
 
 	var mounts []mount.Mount
-	if mountVolume {
+	if cfg.Volume {
 		volName := fmt.Sprintf("%s-%s", volumeLabel, name)
 		vol, err := c.VolumeCreate(ctx, volume.VolumeCreateBody{
 			Name: volName,
@@ -98,23 +122,24 @@ func New(hostPort int, name string, mountVolume bool) (*Server, error) {
 		}}
 	}
 
+	hostConfig := cfg.hostConfig()
+	hostConfig.PortBindings = portBinding
+	hostConfig.Mounts = mounts
+
 	// docker run -d -e EULA=TRUE
 	createResp, err := c.ContainerCreate(
 		ctx,
 		&container.Config{
-			Image:        ImageName,
+			Image:        cfg.image(),
 			Env:          []string{"EULA=TRUE"},
-			ExposedPorts: nat.PortSet{containerPort: struct{}{}},
+			ExposedPorts: exposedPorts,
 			AttachStdin:  true, AttachStdout: true, AttachStderr: true,
 			Tty:       true,
 			OpenStdin: true,
-			Labels:    map[string]string{CraftLabel: ""},
-		},
-		&container.HostConfig{
-			PortBindings: portBinding,
-			AutoRemove:   !mountVolume,
-			Mounts:       mounts,
+			Labels:    cfg.labels(),
+			User:      user,
 		},
+		hostConfig,
 		nil, nil, name,
 	)
 	if err != nil {
@@ -138,8 +163,8 @@ func New(hostPort int, name string, mountVolume bool) (*Server, error) {
 // Get searches for a server with the given name (stopped or running) and checks that it has a label identifying it as
 // a craft server. If no craft server with that name exists, an error of type NotFoundError. If the server is found but
 // is not a craft server, an error of type NotCraftError is returned.
-func Get(cl client.ContainerAPIClient, containerName string) (*Server, error) {
-	id, err := containerID(containerName, cl)
+func Get(ctx context.Context, cl client.ContainerAPIClient, containerName string) (*Server, error) {
+	id, err := containerID(ctx, containerName, cl)
 	if err != nil {
 		return nil, err
 	}
@@ -150,7 +175,7 @@ func Get(cl client.ContainerAPIClient, containerName string) (*Server, error) {
 		ContainerID:        id,
 	}
 
-	containerJSON, err := cl.ContainerInspect(context.Background(), c.ContainerID)
+	containerJSON, err := cl.ContainerInspect(ctx, c.ContainerID)
 	if err != nil {
 		return nil, fmt.Errorf("inspecting container: %s", err)
 	}
@@ -165,99 +190,150 @@ func Get(cl client.ContainerAPIClient, containerName string) (*Server, error) {
 }
 
 // Stop executes a stop command first in the server process cli then on the container itself, stopping the
-// server. The server must be saved separately to persist the world and settings.
-func (s *Server) Stop() error {
-	if err := s.Command([]string{"stop"}); err != nil {
+// server. The server must be saved separately to persist the world and settings. The container is only stopped once
+// the server process reports that it quit correctly. If that isn't reported within the stop timeout, the container is
+// stopped anyway and an error wrapping ErrUncleanShutdown is returned.
+func (s *Server) Stop(ctx context.Context) error {
+	quitCtx, cancel := context.WithTimeout(ctx, stopTimeout)
+	defer cancel()
+
+	// Read logs from before the stop command is run
+	logs, err := s.LogReader(quitCtx, 0)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Command(ctx, []string{"stop"}); err != nil {
 		return fmt.Errorf("%s: running 'stop' command in server cli to stop server process: %s", s.ContainerName, err)
 	}
 
 	logger.Info.Printf("stopping %s\n", s.ContainerName)
 
-	timeout := time.Duration(stopTimeout)
+	quit := waitForQuit(logs)
 
-	err := s.ContainerStop(
-		context.Background(),
-		s.ContainerID,
-		&timeout,
-	)
+	if err := s.StopContainer(ctx); err != nil {
+		return err
+	}
 
-	if err != nil {
-		return fmt.Errorf("%s: stopping docker container: %s", s.ContainerName, err)
+	if !quit {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return fmt.Errorf("%w: '%s' was not logged within %s", ErrUncleanShutdown, quitMessage, stopTimeout)
 	}
 
 	return nil
 }
 
-func (s *Server) IsRunning() bool {
-	inspect, err := s.ContainerInspect(context.Background(), s.ContainerID)
+// waitForQuit reads logs until the server process reports that it quit correctly and returns true. If the end of the
+// logs is reached first, it returns false.
+func waitForQuit(logs *bufio.Reader) bool {
+	scanner := bufio.NewScanner(logs)
+
+	for scanner.Scan() {
+		if mclog.Parse(scanner.Text()).Kind == mclog.KindQuit {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsRunning returns true if the server's container is running.
+func (s *Server) IsRunning(ctx context.Context) (bool, error) {
+	inspect, err := s.ContainerInspect(ctx, s.ContainerID)
 	if err != nil {
-		logger.Error.Panic(err)
+		return false, fmt.Errorf("inspecting container: %w", err)
 	}
 
-	return inspect.State.Running
+	return inspect.State.Running, nil
 }
 
-func (s *Server) HasVolume() bool {
-	inspect, err := s.ContainerInspect(context.Background(), s.ContainerID)
+// HasVolume returns true if a volume is mounted to the server's container.
+func (s *Server) HasVolume(ctx context.Context) (bool, error) {
+	inspect, err := s.ContainerInspect(ctx, s.ContainerID)
 	if err != nil {
-		logger.Error.Panic(err)
+		return false, fmt.Errorf("inspecting container: %w", err)
 	}
 
-	return len(inspect.Mounts) > 0
+	return len(inspect.Mounts) > 0, nil
 }
 
 // RunBedrock runs the bedrock server process and waits for confirmation from the server that the process has started.
-// The server should be join-able when this function returns.
-func (s *Server) RunBedrock() error {
+// The server should be join-able when this function returns. If ctx is cancelled before the server has started, the
+// container is stopped and the context error is returned.
+func (s *Server) RunBedrock(ctx context.Context) error {
 	// New the bedrock_server process
-	if err := s.Command(strings.Split(RunMCCommand, " ")); err != nil {
-		s.StopOrPanic()
-		return err
+	if err := s.Command(ctx, strings.Split(RunMCCommand, " ")); err != nil {
+		return s.stopAfterError(err)
 	}
 
-	logs, err := s.LogReader(1)
+	// Stop reading logs when the server has started
+	logCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	logs, err := s.LogReader(logCtx, 1)
 	if err != nil {
-		s.StopOrPanic()
-		return err
+		return s.stopAfterError(err)
 	}
 
 	scanner := bufio.NewScanner(logs)
 	scanner.Split(bufio.ScanLines)
 
 	for scanner.Scan() {
-		if scanner.Text() == "[INFO] Server started." {
+		if mclog.Parse(scanner.Text()).Kind == mclog.KindServerStarted {
 			// Server has finished starting
 			return nil
 		}
 	}
 
+	if ctx.Err() != nil {
+		return s.stopAfterError(ctx.Err())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading logs: %w", err)
+	}
+
 	return fmt.Errorf("reached end of log reader without finding the 'Server started' message")
 }
 
-// StopOrPanic stops the server's container. The server process may not be stopped gracefully, call Server.Stop() to
-// safely stop the server. If an error occurs while attempting to stop the server the program exits with a panic.
-func (s *Server) StopOrPanic() {
-	logger.Info.Printf("stopping %s\n", s.ContainerName)
-
-	timeout := time.Duration(stopTimeout)
+// StopContainer stops the server's container. The server process may not be stopped gracefully, call Server.Stop() to
+// safely stop the server.
+func (s *Server) StopContainer(ctx context.Context) error {
+	timeout := stopTimeout
 
 	err := s.ContainerStop(
-		context.Background(),
+		ctx,
 		s.ContainerID,
 		&timeout,
 	)
-
 	if err != nil {
-		logger.Error.Panicf("while stopping %s another error occurred: %s\n", s.ContainerName, err)
+		return fmt.Errorf("%s: stopping docker container: %w", s.ContainerName, err)
 	}
+
+	return nil
 }
 
-// Command attaches to the container and runs the given arguments separated by spaces.
-func (s *Server) Command(args []string) error {
-	conn, err := s.CommandWriter()
+// stopAfterError stops the server's container after err has occurred. The returned error wraps err and reports any
+// further error from stopping the container.
+func (s *Server) stopAfterError(err error) error {
+	if stopErr := s.StopContainer(context.Background()); stopErr != nil {
+		return fmt.Errorf("%w (while stopping the server another error occurred: %s)", err, stopErr)
+	}
+
+	return err
+}
+
+// Command attaches to the container and runs the given arguments separated by spaces. The command's output is not read,
+// use Server.Exec to get the output.
+func (s *Server) Command(ctx context.Context, args []string) error {
+	conn, err := s.CommandWriter(ctx)
 	if err != nil {
 		return err
 	}
+	defer conn.Close()
 
 	commandString := strings.Join(args, " ") + "\n"
 
@@ -269,10 +345,10 @@ func (s *Server) Command(args []string) error {
 	return nil
 }
 
-// CommandWriter returns a *net.Conn which streams to the container process stdin.
-func (s *Server) CommandWriter() (net.Conn, error) {
+// CommandWriter returns a *net.Conn which streams to the container process stdin. The caller must close it.
+func (s *Server) CommandWriter(ctx context.Context) (net.Conn, error) {
 	waiter, err := s.ContainerAttach(
-		context.Background(),
+		ctx,
 		s.ContainerID,
 		docker.ContainerAttachOptions{
 			Stdin:  true,
@@ -287,16 +363,33 @@ func (s *Server) CommandWriter() (net.Conn, error) {
 }
 
 // LogReader returns a buffer with the stdout and stderr from the running mc server process. New output will continually
-// be sent to the buffer. A negative tail value will result in the 'all' value being used.
-func (s *Server) LogReader(tail int) (*bufio.Reader, error) {
+// be sent to the buffer until ctx is cancelled. A negative tail value will result in the 'all' value being used.
+func (s *Server) LogReader(ctx context.Context, tail int) (*bufio.Reader, error) {
+	return s.Logs(ctx, LogOptions{Tail: tail, Follow: true})
+}
+
+// LogOptions selects the output returned by Server.Logs.
+type LogOptions struct {
+	Tail       int    // The number of lines from the end of the log, or all lines if negative
+	Since      string // Only output logged after this time, a timestamp or a duration relative to now e.g. 10m
+	Until      string // Only output logged before this time, a timestamp or a duration relative to now
+	Follow     bool   // Continue returning new output until ctx is cancelled or the container stops
+	Timestamps bool   // Prefix each line with the RFC3339Nano time it was logged, followed by a space
+}
+
+// Logs returns a buffer with the stdout and stderr from the server's container, selected by opts.
+func (s *Server) Logs(ctx context.Context, opts LogOptions) (*bufio.Reader, error) {
 	logs, err := s.ContainerLogs(
-		context.Background(),
+		ctx,
 		s.ContainerID,
 		docker.ContainerLogsOptions{
 			ShowStdout: true,
 			ShowStderr: true,
-			Tail:       strconv.Itoa(tail),
-			Follow:     true,
+			Tail:       strconv.Itoa(opts.Tail),
+			Since:      opts.Since,
+			Until:      opts.Until,
+			Follow:     opts.Follow,
+			Timestamps: opts.Timestamps,
 		},
 	)
 
@@ -308,40 +401,28 @@ func (s *Server) LogReader(tail int) (*bufio.Reader, error) {
 }
 
 // Port returns the port players use to connect to this server.
-func (s *Server) Port() (int, error) {
-	cj, err := s.ContainerInspect(context.Background(), s.ContainerID)
+func (s *Server) Port(ctx context.Context) (int, error) {
+	cj, err := s.ContainerInspect(ctx, s.ContainerID)
 	if err != nil {
 		return 0, err
 	}
 
-	portBindings := cj.HostConfig.PortBindings
-
-	if len(portBindings) == 0 {
-		return 0, fmt.Errorf("no ports bound for container %s", s.ContainerName)
-	}
-
-	var port int
-
-	for _, v := range portBindings {
-		p, err := strconv.Atoi(v[0].HostPort)
-		if err != nil {
-			return 0, fmt.Errorf("error reading container port: %s", err)
-		}
-
-		port = p
+	port, ok, err := hostPort(cj, defaultPort, portLabel)
+	if err != nil {
+		return 0, err
 	}
 
-	if port == 0 {
-		panic("port is 0")
+	if !ok || port == 0 {
+		return 0, fmt.Errorf("container %s has no host port", s.ContainerName)
 	}
 
 	return port, nil
 }
 
 // All returns a client for each active server.
-func All(c client.ContainerAPIClient) ([]*Server, error) {
+func All(ctx context.Context, c client.ContainerAPIClient) ([]*Server, error) {
 	containers, err := c.ContainerList(
-		context.Background(),
+		ctx,
 		docker.ContainerListOptions{All: true},
 	)
 	if err != nil {
@@ -356,9 +437,10 @@ func All(c client.ContainerAPIClient) ([]*Server, error) {
 	servers := make([]*Server, 0)
 
 	for _, n := range names {
-		s, err := Get(c, n)
+		s, err := Get(ctx, c, n)
 		if err != nil {
-			if errors.Is(err, &NotCraftError{}) || !s.IsRunning() {
+			// Not a craft server or removed since listing
+			if errors.Is(err, &NotCraftError{}) || errors.Is(err, &NotFoundError{}) {
 				continue
 			}
 
@@ -371,8 +453,8 @@ func All(c client.ContainerAPIClient) ([]*Server, error) {
 	return servers, nil
 }
 
-func containerID(name string, client client.ContainerAPIClient) (string, error) {
-	containers, err := client.ContainerList(context.Background(), docker.ContainerListOptions{All: true})
+func containerID(ctx context.Context, name string, client client.ContainerAPIClient) (string, error) {
+	containers, err := client.ContainerList(ctx, docker.ContainerListOptions{All: true})
 	if err != nil {
 		return "", fmt.Errorf("listing all containers: %s", err)
 	}
@@ -386,42 +468,6 @@ func containerID(name string, client client.ContainerAPIClient) (string, error)
 	return "", &NotFoundError{Name: name}
 }
 
-// nextAvailablePort returns the next available port, starting with the default mc port. It checks the first exposed
-// port of all running containers to determine if a port is in use.
-func nextAvailablePort() int {
-	servers, err := All(dockerClient())
-	if err != nil {
-		panic(err)
-	}
-
-	usedPorts := make([]int, len(servers))
-
-	for i, s := range servers {
-		p, err := s.Port()
-		if err != nil {
-			panic(err)
-		}
-
-		usedPorts[i] = p
-	}
-
-	// Iterate 100 ports starting with the default
-OUTER:
-	for p := defaultPort; p < defaultPort+100; p++ {
-		for _, up := range usedPorts {
-			if p == up {
-				// Another server is using this port
-				continue OUTER
-			}
-		}
-
-		// The port is available
-		return p
-	}
-
-	panic("100 ports were not available")
-}
-
 // NotFoundError tells the caller that no containers were found with the given name.
 type NotFoundError struct {
 	Name string
@@ -2,10 +2,12 @@ package server
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"net"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/danhale-git/craft/internal/mock"
 )
@@ -20,7 +22,7 @@ func TestServer_Command(t *testing.T) {
 	c := []string{"arg1", "arg2", "arg3"}
 
 	go func() {
-		err := s.Command(c)
+		err := s.Command(context.Background(), c)
 		if err != nil {
 			t.Errorf("error returned for valid input")
 		}
@@ -41,7 +43,7 @@ func TestServer_Command(t *testing.T) {
 func TestServer_LogReader(t *testing.T) {
 	s := &Server{ContainerAPIClient: &mock.DockerContainerClient{}}
 
-	r, err := s.LogReader(20)
+	r, err := s.LogReader(context.Background(), 20)
 	if err != nil {
 		t.Errorf("error returned for valid input: %s", err)
 	}
@@ -61,7 +63,7 @@ func TestContainerID(t *testing.T) {
 
 	for i := 1; i <= 3; i++ {
 		want := fmt.Sprintf("mc%d_ID", i)
-		got, err := containerID(fmt.Sprintf("mc%d", i), s)
+		got, err := containerID(context.Background(), fmt.Sprintf("mc%d", i), s)
 
 		if err != nil {
 			t.Errorf("error returned for valid input: %s", err)
@@ -72,3 +74,79 @@ func TestContainerID(t *testing.T) {
 		}
 	}
 }
+
+func TestServer_Stop(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	d := mock.NewDocker(ImageName)
+
+	s, err := New(ctx, d, "srv", Config{Volume: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.RunBedrock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Stop(ctx); err != nil {
+		t.Fatalf("error returned when the server quit correctly: %s", err)
+	}
+
+	running, err := s.IsRunning(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if running {
+		t.Errorf("container is running after the server was stopped")
+	}
+}
+
+func TestServer_Logs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	d := mock.NewDocker(ImageName)
+
+	s, err := New(ctx, d, "srv", Config{Volume: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.RunBedrock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Not following, the reader ends with the existing logs
+	logs, err := s.Logs(ctx, LogOptions{Tail: 1, Timestamps: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := bufio.NewScanner(logs)
+	lines := make([]string, 0)
+
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	if len(lines) != 1 || !strings.HasSuffix(strings.TrimSpace(lines[0]), "[INFO] Server started.") {
+		t.Fatalf("unexpected lines: %q", lines)
+	}
+
+	if _, err := time.Parse(time.RFC3339Nano, strings.Fields(lines[0])[0]); err != nil {
+		t.Errorf("line has no timestamp: %s", err)
+	}
+
+	// The server was created less than an hour ago
+	logs, err = s.Logs(ctx, LogOptions{Tail: -1, Until: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line, err := logs.ReadString('\n'); line != "" {
+		t.Errorf("unexpected output before the until time: %q (%v)", line, err)
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// stopWarnings are the times remaining before a server stops at which players are warned, in addition to the first
+// warning.
+var stopWarnings = []time.Duration{ //nolint:gochecknoglobals
+	10 * time.Minute,
+	5 * time.Minute,
+	time.Minute,
+	30 * time.Second,
+	10 * time.Second,
+	5 * time.Second,
+	4 * time.Second,
+	3 * time.Second,
+	2 * time.Second,
+	time.Second,
+}
+
+// WarnStop broadcasts a countdown to players, starting at d, and returns when the countdown reaches zero. It doesn't
+// stop the server. If ctx is cancelled the countdown ends early and the context error is returned.
+func (s *Server) WarnStop(ctx context.Context, d time.Duration) error {
+	end := time.Now().Add(d)
+
+	if err := s.Say(ctx, fmt.Sprintf("Server stopping in %s", countdownText(d))); err != nil {
+		return err
+	}
+
+	for _, w := range stopWarnings {
+		if w >= d {
+			continue
+		}
+
+		if err := sleep(ctx, time.Until(end.Add(-w))); err != nil {
+			return err
+		}
+
+		if err := s.Say(ctx, fmt.Sprintf("Server stopping in %s", countdownText(w))); err != nil {
+			return err
+		}
+	}
+
+	return sleep(ctx, time.Until(end))
+}
+
+// Say broadcasts a message to all players.
+func (s *Server) Say(ctx context.Context, message string) error {
+	return s.Command(ctx, []string{"say", message})
+}
+
+// countdownText returns a duration as a whole number of minutes or seconds e.g. '1 minute' or '30 seconds'.
+func countdownText(d time.Duration) string {
+	n, unit := int((d+time.Second/2)/time.Second), "second"
+
+	if d >= time.Minute && d%time.Minute == 0 {
+		n, unit = int(d/time.Minute), "minute"
+	}
+
+	if n != 1 {
+		unit += "s"
+	}
+
+	return fmt.Sprintf("%d %s", n, unit)
+}
+
+// sleep waits for the duration d or until ctx is cancelled, in which case the context error is returned.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
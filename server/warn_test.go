@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	docker "github.com/docker/docker/api/types"
+
+	"github.com/danhale-git/craft/internal/mock"
+)
+
+func TestCountdownText(t *testing.T) {
+	cases := map[time.Duration]string{
+		time.Second:             "1 second",
+		1500 * time.Millisecond: "2 seconds",
+		30 * time.Second:        "30 seconds",
+		time.Minute:             "1 minute",
+		90 * time.Second:        "90 seconds",
+		10 * time.Minute:        "10 minutes",
+	}
+
+	for d, want := range cases {
+		if got := countdownText(d); got != want {
+			t.Errorf("unexpected text for %s: want '%s': got '%s'", d, want, got)
+		}
+	}
+}
+
+func TestServer_WarnStop(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	d := mock.NewDocker(ImageName)
+
+	s, err := New(ctx, d, "srv", Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.RunBedrock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+
+	if err = s.WarnStop(ctx, 1500*time.Millisecond); err != nil {
+		t.Fatalf("error returned for valid input: %s", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 1500*time.Millisecond {
+		t.Errorf("countdown returned early after %s", elapsed)
+	}
+
+	// Commands are written to stdin by separate connections, wait for the last one to be logged
+	time.Sleep(100 * time.Millisecond)
+
+	logs, err := d.ContainerLogs(ctx, s.ContainerID, docker.ContainerLogsOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadAll(logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"say Server stopping in 2 seconds", "say Server stopping in 1 second"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("expected '%s' in server logs: got '%s'", want, b)
+		}
+	}
+
+	cancel()
+
+	if err = s.WarnStop(ctx, time.Minute); err == nil {
+		t.Errorf("no error returned when the context was cancelled")
+	}
+}